@@ -22,6 +22,7 @@ type config struct {
 	analyticsRate       float64
 	dataStreamsEnabled  bool
 	groupID             string
+	batchConsume        bool
 }
 
 func defaults(cfg *config) {
@@ -69,6 +70,18 @@ func WithGroupID(groupID string) Option {
 	}
 }
 
+// WithBatchConsume traces the messages received from a PartitionConsumer by
+// batch rather than one by one: a single span is started for the messages
+// which were buffered together, and finished once the next batch is received,
+// when they have been processed. It is tagged with the number of messages and
+// records the span context found in the headers of each, up to 100, which is
+// replaced with its own.
+func WithBatchConsume() Option {
+	return func(cfg *config) {
+		cfg.batchConsume = true
+	}
+}
+
 // WithAnalytics enables Trace Analytics for all started spans.
 func WithAnalytics(on bool) Option {
 	return func(cfg *config) {
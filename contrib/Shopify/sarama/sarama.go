@@ -8,7 +8,9 @@ package sarama // import "gopkg.in/DataDog/dd-trace-go.v1/contrib/Shopify/sarama
 
 import (
 	"context"
+	"fmt"
 	"math"
+	"strings"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/datastreams"
 	"gopkg.in/DataDog/dd-trace-go.v1/datastreams/options"
@@ -54,8 +56,32 @@ func WrapPartitionConsumer(pc sarama.PartitionConsumer, opts ...Option) sarama.P
 	}
 	go func() {
 		msgs := pc.Messages()
-		var prev ddtrace.Span
+		var (
+			prev  ddtrace.Span
+			batch *batchSpan
+		)
 		for msg := range msgs {
+			if cfg.batchConsume {
+				var prevBatch *batchSpan
+				if batch == nil || batch.complete {
+					prevBatch, batch = batch, startBatchSpan(cfg, msg)
+				}
+				batch.add(msg)
+				// the batch is made of the messages which were already
+				// buffered when its first one was received
+				batch.complete = len(msgs) == 0
+				setConsumeCheckpoint(cfg.dataStreamsEnabled, cfg.groupID, msg)
+				trackHighWaterMark(cfg.dataStreamsEnabled, cfg.groupID, pc, msg)
+
+				wrapped.messages <- msg
+
+				// if a message of the next batch was received, finish the
+				// previous batch span
+				if prevBatch != nil {
+					prevBatch.finish()
+				}
+				continue
+			}
 			// create the next span from the message
 			opts := []tracer.StartSpanOption{
 				tracer.ServiceName(cfg.consumerServiceName),
@@ -80,6 +106,7 @@ func WrapPartitionConsumer(pc sarama.PartitionConsumer, opts ...Option) sarama.P
 			// reinject the span context so consumers can pick it up
 			tracer.Inject(next.Context(), carrier)
 			setConsumeCheckpoint(cfg.dataStreamsEnabled, cfg.groupID, msg)
+			trackHighWaterMark(cfg.dataStreamsEnabled, cfg.groupID, pc, msg)
 
 			wrapped.messages <- msg
 
@@ -93,11 +120,75 @@ func WrapPartitionConsumer(pc sarama.PartitionConsumer, opts ...Option) sarama.P
 		if prev != nil {
 			prev.Finish()
 		}
+		if batch != nil {
+			batch.finish()
+		}
 		close(wrapped.messages)
 	}()
 	return wrapped
 }
 
+// maxBatchUpstream caps the number of span contexts recorded by a batch span,
+// to bound the size of its ext.MessagingBatchUpstream tag.
+const maxBatchUpstream = 100
+
+// A batchSpan traces the processing of a batch of messages consumed from a
+// partition.
+type batchSpan struct {
+	ddtrace.Span
+	count    int
+	upstream []string
+	// dropped is the number of span contexts left out of upstream.
+	dropped int
+	// complete reports whether the batch can't receive more messages.
+	complete bool
+}
+
+func startBatchSpan(cfg *config, msg *sarama.ConsumerMessage) *batchSpan {
+	opts := []tracer.StartSpanOption{
+		tracer.ServiceName(cfg.consumerServiceName),
+		tracer.ResourceName("Consume Topic " + msg.Topic),
+		tracer.SpanType(ext.SpanTypeMessageConsumer),
+		tracer.Tag(ext.MessagingKafkaTopic, msg.Topic),
+		tracer.Tag(ext.MessagingKafkaPartition, msg.Partition),
+		tracer.Tag(ext.Component, componentName),
+		tracer.Tag(ext.SpanKind, ext.SpanKindConsumer),
+		tracer.Tag(ext.MessagingSystem, ext.MessagingSystemKafka),
+		tracer.Measured(),
+	}
+	if !math.IsNaN(cfg.analyticsRate) {
+		opts = append(opts, tracer.Tag(ext.EventSampleRate, cfg.analyticsRate))
+	}
+	return &batchSpan{Span: tracer.StartSpan(cfg.consumerSpanName, opts...)}
+}
+
+// add adds msg to the batch. The span context found in its headers is
+// recorded, up to maxBatchUpstream, and replaced with the one of the batch so
+// consumers can pick it up.
+func (b *batchSpan) add(msg *sarama.ConsumerMessage) {
+	b.count++
+	carrier := NewConsumerMessageCarrier(msg)
+	if spanctx, err := tracer.Extract(carrier); err == nil {
+		if len(b.upstream) < maxBatchUpstream {
+			b.upstream = append(b.upstream, fmt.Sprintf("%d:%d", spanctx.TraceID(), spanctx.SpanID()))
+		} else {
+			b.dropped++
+		}
+	}
+	tracer.Inject(b.Context(), carrier)
+}
+
+func (b *batchSpan) finish() {
+	b.SetTag(ext.MessagingBatchMessageCount, b.count)
+	if len(b.upstream) > 0 {
+		b.SetTag(ext.MessagingBatchUpstream, strings.Join(b.upstream, ","))
+	}
+	if b.dropped > 0 {
+		b.SetTag(ext.MessagingBatchUpstreamDropped, b.dropped)
+	}
+	b.Finish()
+}
+
 type consumer struct {
 	sarama.Consumer
 	opts []Option
@@ -354,8 +445,18 @@ func setConsumeCheckpoint(enabled bool, groupID string, msg *sarama.ConsumerMess
 	if groupID != "" {
 		// only track Kafka lag if a consumer group is set.
 		// since there is no ack mechanism, we consider that messages read are committed right away.
-		tracer.TrackKafkaCommitOffset(groupID, msg.Topic, msg.Partition, msg.Offset)
+		// the committed offset is the one of the next message to consume.
+		tracer.TrackKafkaCommitOffset(groupID, msg.Topic, msg.Partition, msg.Offset+1)
+	}
+}
+
+// trackHighWaterMark tracks the high watermark of the partition of msg, as
+// reported by the broker, to compute the Kafka lag of the consumer group.
+func trackHighWaterMark(enabled bool, groupID string, pc sarama.PartitionConsumer, msg *sarama.ConsumerMessage) {
+	if !enabled || groupID == "" {
+		return
 	}
+	tracer.TrackKafkaHighWatermarkOffset(msg.Topic, msg.Partition, pc.HighWaterMarkOffset())
 }
 
 func getProducerMsgSize(msg *sarama.ProducerMessage) (size int64) {
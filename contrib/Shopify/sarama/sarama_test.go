@@ -7,6 +7,8 @@ package sarama
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -178,6 +180,93 @@ func TestConsumer(t *testing.T) {
 	}
 }
 
+type bufferedPartitionConsumer struct {
+	sarama.PartitionConsumer
+	messages chan *sarama.ConsumerMessage
+}
+
+func (pc *bufferedPartitionConsumer) Messages() <-chan *sarama.ConsumerMessage {
+	return pc.messages
+}
+
+func TestConsumerBatch(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	var upstream []string
+	newMessage := func(offset int64) *sarama.ConsumerMessage {
+		msg := &sarama.ConsumerMessage{Topic: "test-topic", Partition: 1, Offset: offset}
+		span := tracer.StartSpan("produce")
+		err := tracer.Inject(span.Context(), NewConsumerMessageCarrier(msg))
+		require.NoError(t, err)
+		span.Finish()
+		upstream = append(upstream, fmt.Sprintf("%d:%d", span.Context().TraceID(), span.Context().SpanID()))
+		return msg
+	}
+	// the messages buffered before the partition consumer is wrapped are
+	// received together
+	pc := &bufferedPartitionConsumer{messages: make(chan *sarama.ConsumerMessage, 2)}
+	msgs := []*sarama.ConsumerMessage{newMessage(0), newMessage(1)}
+	for _, msg := range msgs {
+		pc.messages <- msg
+	}
+	wrapped := WrapPartitionConsumer(pc, WithBatchConsume())
+	for range msgs {
+		<-wrapped.Messages()
+	}
+	// the next message is received after the batch
+	pc.messages <- newMessage(2)
+	<-wrapped.Messages()
+	close(pc.messages)
+	// wait for the channel to be closed
+	<-wrapped.Messages()
+
+	spans := mt.FinishedSpans()[3:] // skip the producer spans
+	require.Len(t, spans, 2)
+	for i, upstream := range [][]string{upstream[:2], upstream[2:]} {
+		s := spans[i]
+		assert.Equal(t, "kafka.consume", s.OperationName())
+		assert.Equal(t, "Consume Topic test-topic", s.Tag(ext.ResourceName))
+		assert.Equal(t, "test-topic", s.Tag(ext.MessagingKafkaTopic))
+		assert.Equal(t, int32(1), s.Tag(ext.MessagingKafkaPartition))
+		assert.Equal(t, len(upstream), s.Tag(ext.MessagingBatchMessageCount))
+		assert.Equal(t, strings.Join(upstream, ","), s.Tag(ext.MessagingBatchUpstream))
+		assert.Equal(t, ext.SpanKindConsumer, s.Tag(ext.SpanKind))
+		assert.Equal(t, "Shopify/sarama", s.Tag(ext.Component))
+	}
+	for _, msg := range msgs {
+		spanctx, err := tracer.Extract(NewConsumerMessageCarrier(msg))
+		require.NoError(t, err)
+		assert.Equal(t, spans[0].SpanID(), spanctx.SpanID(), "the batch span context should be injected into the headers")
+	}
+}
+
+func TestBatchSpanUpstreamCap(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	cfg := new(config)
+	defaults(cfg)
+	var b *batchSpan
+	for i := 0; i < maxBatchUpstream+2; i++ {
+		msg := &sarama.ConsumerMessage{Topic: "test-topic", Partition: 1, Offset: int64(i)}
+		span := tracer.StartSpan("produce")
+		err := tracer.Inject(span.Context(), NewConsumerMessageCarrier(msg))
+		require.NoError(t, err)
+		span.Finish()
+		if b == nil {
+			b = startBatchSpan(cfg, msg)
+		}
+		b.add(msg)
+	}
+	b.finish()
+
+	s := mt.FinishedSpans()[maxBatchUpstream+2]
+	assert.Equal(t, maxBatchUpstream+2, s.Tag(ext.MessagingBatchMessageCount))
+	assert.Len(t, strings.Split(s.Tag(ext.MessagingBatchUpstream).(string), ","), maxBatchUpstream)
+	assert.Equal(t, 2, s.Tag(ext.MessagingBatchUpstreamDropped))
+}
+
 func TestSyncProducer(t *testing.T) {
 	mt := mocktracer.Start()
 	defer mt.Stop()
@@ -105,11 +105,14 @@ func (mw *traceMiddleware) startTraceMiddleware(stack *middleware.Stack) error {
 			opts = append(opts, tracer.Tag(ext.EventSampleRate, mw.cfg.analyticsRate))
 		}
 		span, spanctx := tracer.StartSpanFromContext(ctx, spanName(serviceID, operation), opts...)
+		mw.injectMessages(ctx, span, in)
 
 		// Handle initialize and continue through the middleware chain.
 		out, metadata, err = next.HandleInitialize(spanctx, in)
 		if err != nil && (mw.cfg.errCheck == nil || mw.cfg.errCheck(err)) {
 			span.SetTag(ext.Error, err)
+		} else if err == nil {
+			mw.extractMessages(in, out)
 		}
 		span.Finish()
 
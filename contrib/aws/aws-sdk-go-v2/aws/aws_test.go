@@ -8,6 +8,7 @@ package aws
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -16,20 +17,25 @@ import (
 	"testing"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/contrib/internal/namingschematest"
+	"gopkg.in/DataDog/dd-trace-go.v1/datastreams"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	eventbridgetypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
 	"github.com/aws/aws-sdk-go-v2/service/kinesis"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/sfn"
 	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go/middleware"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -1077,3 +1083,215 @@ func TestWithErrorCheck(t *testing.T) {
 		})
 	}
 }
+
+func TestMessagingInjection(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	server := mockAWS(200)
+	defer server.Close()
+
+	resolver := aws.EndpointResolverFunc(func(service, region string) (aws.Endpoint, error) {
+		return aws.Endpoint{
+			PartitionID:   "aws",
+			URL:           server.URL,
+			SigningRegion: "eu-west-1",
+		}, nil
+	})
+
+	awsCfg := aws.Config{
+		Region:           "eu-west-1",
+		Credentials:      aws.AnonymousCredentials{},
+		EndpointResolver: resolver,
+	}
+
+	AppendMiddleware(&awsCfg, WithDataStreams())
+
+	// assertInjected checks that data holds the context of the only finished
+	// span, and the pathway of the given produce checkpoint.
+	assertInjected := func(t *testing.T, data []byte, edges ...string) {
+		t.Helper()
+		spans := mt.FinishedSpans()
+		require.Len(t, spans, 1)
+		mt.Reset()
+
+		var carrier tracer.TextMapCarrier
+		require.NoError(t, json.Unmarshal(data, &carrier))
+		spanctx, err := tracer.Extract(carrier)
+		require.NoError(t, err)
+		assert.Equal(t, spans[0].TraceID(), spanctx.TraceID())
+		assert.Equal(t, spans[0].SpanID(), spanctx.SpanID())
+
+		p, ok := datastreams.PathwayFromContext(datastreams.ExtractFromBase64Carrier(context.Background(), carrier))
+		require.True(t, ok)
+		expectedCtx, _ := tracer.SetDataStreamsCheckpoint(context.Background(), edges...)
+		expected, _ := datastreams.PathwayFromContext(expectedCtx)
+		assert.Equal(t, expected.GetHash(), p.GetHash())
+	}
+
+	t.Run("sqs", func(t *testing.T) {
+		client := sqs.NewFromConfig(awsCfg)
+		in := &sqs.SendMessageInput{
+			MessageBody: aws.String("foobar"),
+			QueueUrl:    aws.String("https://sqs.us-west-2.amazonaws.com/123456789012/MyQueueName"),
+		}
+		client.SendMessage(context.Background(), in)
+		attr := in.MessageAttributes["_datadog"]
+		assert.Equal(t, "String", aws.ToString(attr.DataType))
+		assertInjected(t, []byte(aws.ToString(attr.StringValue)), "direction:out", "topic:MyQueueName", "type:sqs")
+
+		batch := &sqs.SendMessageBatchInput{
+			Entries:  []types.SendMessageBatchRequestEntry{{Id: aws.String("1"), MessageBody: aws.String("foobar")}},
+			QueueUrl: aws.String("https://sqs.us-west-2.amazonaws.com/123456789012/MyQueueName"),
+		}
+		client.SendMessageBatch(context.Background(), batch)
+		attr = batch.Entries[0].MessageAttributes["_datadog"]
+		assertInjected(t, []byte(aws.ToString(attr.StringValue)), "direction:out", "topic:MyQueueName", "type:sqs")
+
+		full := make(map[string]types.MessageAttributeValue)
+		for i := 0; i < 10; i++ {
+			full[strings.Repeat("a", i+1)] = types.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String("v")}
+		}
+		in = &sqs.SendMessageInput{
+			MessageBody:       aws.String("foobar"),
+			MessageAttributes: full,
+			QueueUrl:          aws.String("https://sqs.us-west-2.amazonaws.com/123456789012/MyQueueName"),
+		}
+		client.SendMessage(context.Background(), in)
+		assert.NotContains(t, in.MessageAttributes, "_datadog", "there is no room for the attribute")
+		mt.Reset()
+
+		receive := &sqs.ReceiveMessageInput{
+			QueueUrl: aws.String("https://sqs.us-west-2.amazonaws.com/123456789012/MyQueueName"),
+		}
+		client.ReceiveMessage(context.Background(), receive)
+		assert.Equal(t, []string{"_datadog"}, receive.MessageAttributeNames)
+		mt.Reset()
+	})
+
+	t.Run("sns", func(t *testing.T) {
+		client := sns.NewFromConfig(awsCfg)
+		in := &sns.PublishInput{
+			Message:  aws.String("message"),
+			TopicArn: aws.String("arn:aws:sns:us-west-2:123456789012:MyTopic"),
+		}
+		client.Publish(context.Background(), in)
+		attr := in.MessageAttributes["_datadog"]
+		assert.Equal(t, "Binary", aws.ToString(attr.DataType))
+		assertInjected(t, attr.BinaryValue, "direction:out", "topic:MyTopic", "type:sns")
+
+		batch := &sns.PublishBatchInput{
+			PublishBatchRequestEntries: []snstypes.PublishBatchRequestEntry{{Id: aws.String("1"), Message: aws.String("message")}},
+			TopicArn:                   aws.String("arn:aws:sns:us-west-2:123456789012:MyTopic"),
+		}
+		client.PublishBatch(context.Background(), batch)
+		attr = batch.PublishBatchRequestEntries[0].MessageAttributes["_datadog"]
+		assertInjected(t, attr.BinaryValue, "direction:out", "topic:MyTopic", "type:sns")
+	})
+
+	t.Run("kinesis", func(t *testing.T) {
+		client := kinesis.NewFromConfig(awsCfg)
+		in := &kinesis.PutRecordInput{
+			Data:         []byte(`{"b": 2, "a": 1} `),
+			PartitionKey: aws.String("key"),
+			StreamName:   aws.String("my-kinesis-stream"),
+		}
+		client.PutRecord(context.Background(), in)
+		assert.True(t, strings.HasPrefix(string(in.Data), `{"b": 2, "a": 1,"_datadog":{`), "the fields are preserved: %s", in.Data)
+		var fields map[string]json.RawMessage
+		require.NoError(t, json.Unmarshal(in.Data, &fields))
+		assertInjected(t, fields["_datadog"], "direction:out", "topic:my-kinesis-stream", "type:kinesis")
+
+		in = &kinesis.PutRecordInput{
+			Data:         []byte("not json"),
+			PartitionKey: aws.String("key"),
+			StreamName:   aws.String("my-kinesis-stream"),
+		}
+		client.PutRecord(context.Background(), in)
+		assert.Equal(t, "not json", string(in.Data))
+		mt.Reset()
+	})
+
+	t.Run("eventbridge", func(t *testing.T) {
+		client := eventbridge.NewFromConfig(awsCfg)
+		in := &eventbridge.PutEventsInput{
+			Entries: []eventbridgetypes.PutEventsRequestEntry{{
+				Detail:       aws.String("{}"),
+				DetailType:   aws.String("type"),
+				EventBusName: aws.String("my-bus"),
+				Source:       aws.String("source"),
+			}},
+		}
+		client.PutEvents(context.Background(), in)
+		var fields map[string]json.RawMessage
+		require.NoError(t, json.Unmarshal([]byte(aws.ToString(in.Entries[0].Detail)), &fields))
+		assert.Len(t, fields, 1)
+		assertInjected(t, fields["_datadog"], "direction:out", "topic:my-bus", "type:bus")
+	})
+}
+
+func TestExtractSQSMessage(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	span := tracer.StartSpan("producer")
+	carrier := make(tracer.TextMapCarrier)
+	require.NoError(t, tracer.Inject(span.Context(), carrier))
+	ctx, _ := tracer.SetDataStreamsCheckpoint(context.Background(), "direction:out", "topic:MyTopic", "type:sns")
+	datastreams.InjectToBase64Carrier(ctx, carrier)
+	data, err := json.Marshal(carrier)
+	require.NoError(t, err)
+	produced, _ := datastreams.PathwayFromContext(ctx)
+
+	t.Run("attribute", func(t *testing.T) {
+		msg := types.Message{
+			Body: aws.String("body"),
+			MessageAttributes: map[string]types.MessageAttributeValue{
+				"_datadog": {DataType: aws.String("String"), StringValue: aws.String(string(data))},
+			},
+		}
+		ctx, spanctx, err := ExtractSQSMessage(context.Background(), msg)
+		require.NoError(t, err)
+		assert.Equal(t, span.Context().SpanID(), spanctx.SpanID())
+		p, ok := datastreams.PathwayFromContext(ctx)
+		require.True(t, ok)
+		assert.Equal(t, produced.GetHash(), p.GetHash())
+	})
+
+	t.Run("sns notification", func(t *testing.T) {
+		body, err := json.Marshal(map[string]interface{}{
+			"Type":    "Notification",
+			"Message": "message",
+			"MessageAttributes": map[string]interface{}{
+				"_datadog": map[string]string{"Type": "Binary", "Value": base64.StdEncoding.EncodeToString(data)},
+			},
+		})
+		require.NoError(t, err)
+		_, spanctx, err := ExtractSQSMessage(context.Background(), types.Message{Body: aws.String(string(body))})
+		require.NoError(t, err)
+		assert.Equal(t, span.Context().SpanID(), spanctx.SpanID())
+	})
+
+	t.Run("consume checkpoint", func(t *testing.T) {
+		mw := traceMiddleware{cfg: &config{dataStreamsEnabled: true}}
+		in := middleware.InitializeInput{Parameters: &sqs.ReceiveMessageInput{
+			QueueUrl: aws.String("https://sqs.us-west-2.amazonaws.com/123456789012/MyQueueName"),
+		}}
+		res := &sqs.ReceiveMessageOutput{Messages: []types.Message{{
+			Body: aws.String("body"),
+			MessageAttributes: map[string]types.MessageAttributeValue{
+				"_datadog": {DataType: aws.String("String"), StringValue: aws.String(string(data))},
+			},
+		}}}
+		mw.extractMessages(in, middleware.InitializeOutput{Result: res})
+
+		ctx, spanctx, err := ExtractSQSMessage(context.Background(), res.Messages[0])
+		require.NoError(t, err)
+		assert.Equal(t, span.Context().SpanID(), spanctx.SpanID())
+		p, ok := datastreams.PathwayFromContext(ctx)
+		require.True(t, ok)
+		expectedCtx, _ := tracer.SetDataStreamsCheckpoint(datastreams.ExtractFromBase64Carrier(context.Background(), carrier), "direction:in", "topic:MyQueueName", "type:sqs")
+		expected, _ := datastreams.PathwayFromContext(expectedCtx)
+		assert.Equal(t, expected.GetHash(), p.GetHash())
+	})
+}
@@ -0,0 +1,387 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package aws
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/datastreams"
+	"gopkg.in/DataDog/dd-trace-go.v1/datastreams/options"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	eventbridgetypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// datadogKey is the name of the message attribute, or of the JSON field for
+// Kinesis records and EventBridge events, holding the propagated trace
+// context and data streams pathway.
+const datadogKey = "_datadog"
+
+const (
+	// maxMessageAttributes is the maximum number of message attributes of an
+	// SQS message or an SNS notification.
+	maxMessageAttributes = 10
+
+	// maxKinesisRecordSize is the maximum size of the data of a Kinesis
+	// record.
+	maxKinesisRecordSize = 1 << 20
+
+	// maxEventBridgeEntrySize is the maximum size of an EventBridge event.
+	maxEventBridgeEntrySize = 256 << 10
+)
+
+// injectMessages injects the context of span into the messages sent by the
+// request, and sets the data streams produce checkpoints if enabled.
+func (mw *traceMiddleware) injectMessages(ctx context.Context, span ddtrace.Span, in middleware.InitializeInput) {
+	switch params := in.Parameters.(type) {
+	case *sqs.SendMessageInput:
+		edges := queueEdges("out", aws.ToString(params.QueueUrl))
+		params.MessageAttributes = mw.injectSQSAttributes(ctx, span, edges, aws.ToString(params.MessageBody), params.MessageAttributes)
+	case *sqs.SendMessageBatchInput:
+		edges := queueEdges("out", aws.ToString(params.QueueUrl))
+		for i := range params.Entries {
+			e := &params.Entries[i]
+			e.MessageAttributes = mw.injectSQSAttributes(ctx, span, edges, aws.ToString(e.MessageBody), e.MessageAttributes)
+		}
+	case *sqs.ReceiveMessageInput:
+		params.MessageAttributeNames = withDatadogAttribute(params.MessageAttributeNames)
+	case *sns.PublishInput:
+		edges := topicEdges(params.TopicArn, params.TargetArn)
+		params.MessageAttributes = mw.injectSNSAttributes(ctx, span, edges, aws.ToString(params.Message), params.MessageAttributes)
+	case *sns.PublishBatchInput:
+		edges := topicEdges(params.TopicArn, nil)
+		for i := range params.PublishBatchRequestEntries {
+			e := &params.PublishBatchRequestEntries[i]
+			e.MessageAttributes = mw.injectSNSAttributes(ctx, span, edges, aws.ToString(e.Message), e.MessageAttributes)
+		}
+	case *kinesis.PutRecordInput:
+		edges := streamEdges(params.StreamName, params.StreamARN)
+		params.Data = mw.injectJSON(ctx, span, edges, params.Data, maxKinesisRecordSize)
+	case *kinesis.PutRecordsInput:
+		edges := streamEdges(params.StreamName, params.StreamARN)
+		for i := range params.Records {
+			r := &params.Records[i]
+			r.Data = mw.injectJSON(ctx, span, edges, r.Data, maxKinesisRecordSize)
+		}
+	case *eventbridge.PutEventsInput:
+		for i := range params.Entries {
+			e := &params.Entries[i]
+			edges := busEdges(e)
+			if e.Detail == nil {
+				mw.setProduceCheckpoint(ctx, edges, 0, nil)
+				continue
+			}
+			detail := mw.injectJSON(ctx, span, edges, []byte(*e.Detail), maxEventBridgeEntrySize-eventBridgeEntrySize(e))
+			e.Detail = aws.String(string(detail))
+		}
+	}
+}
+
+// extractMessages sets the data streams consume checkpoints of the messages
+// received by the request, if enabled.
+func (mw *traceMiddleware) extractMessages(in middleware.InitializeInput, out middleware.InitializeOutput) {
+	if !mw.cfg.dataStreamsEnabled {
+		return
+	}
+	params, ok := in.Parameters.(*sqs.ReceiveMessageInput)
+	if !ok {
+		return
+	}
+	res, ok := out.Result.(*sqs.ReceiveMessageOutput)
+	if !ok {
+		return
+	}
+	edges := queueEdges("in", aws.ToString(params.QueueUrl))
+	for i := range res.Messages {
+		msg := &res.Messages[i]
+		carrier := messageCarrier(*msg)
+		size := sqsMessageSize(aws.ToString(msg.Body), msg.MessageAttributes)
+		ctx, ok := tracer.SetDataStreamsCheckpointWithParams(datastreams.ExtractFromBase64Carrier(context.Background(), carrier), options.CheckpointParams{PayloadSize: size}, edges...)
+		if !ok {
+			continue
+		}
+		// re-inject the pathway so that ExtractSQSMessage continues it
+		datastreams.InjectToBase64Carrier(ctx, carrier)
+		if v, err := json.Marshal(carrier); err == nil {
+			if msg.MessageAttributes == nil {
+				msg.MessageAttributes = make(map[string]sqstypes.MessageAttributeValue, 1)
+			}
+			msg.MessageAttributes[datadogKey] = sqstypes.MessageAttributeValue{
+				DataType:    aws.String("String"),
+				StringValue: aws.String(string(v)),
+			}
+		}
+	}
+}
+
+// ExtractSQSMessage extracts the trace context propagated in the "_datadog"
+// attribute of a message returned by ReceiveMessage, so that the processing
+// of the message can be traced as a child of the span which sent it:
+//
+//	ctx, spanctx, err := aws.ExtractSQSMessage(ctx, msg)
+//	if err == nil {
+//		opts = append(opts, tracer.ChildOf(spanctx))
+//	}
+//	span, ctx := tracer.StartSpanFromContext(ctx, "process.message", opts...)
+//
+// The returned context carries the data streams pathway of the message, so
+// that the messages sent while processing it continue its pathway. Messages
+// delivered to SQS by SNS are supported, with or without raw message
+// delivery.
+func ExtractSQSMessage(ctx context.Context, msg sqstypes.Message) (context.Context, ddtrace.SpanContext, error) {
+	carrier := messageCarrier(msg)
+	ctx = datastreams.ExtractFromBase64Carrier(ctx, carrier)
+	spanctx, err := tracer.Extract(carrier)
+	return ctx, spanctx, err
+}
+
+// messageCarrier returns the values propagated with msg, either in its
+// attributes or in the attributes of the SNS notification it holds.
+func messageCarrier(msg sqstypes.Message) tracer.TextMapCarrier {
+	if carrier := sqsCarrier(msg); len(carrier) > 0 {
+		return carrier
+	}
+	return snsNotificationCarrier(aws.ToString(msg.Body))
+}
+
+// sqsCarrier returns the values propagated in the attributes of msg.
+func sqsCarrier(msg sqstypes.Message) tracer.TextMapCarrier {
+	carrier := make(tracer.TextMapCarrier)
+	v, ok := msg.MessageAttributes[datadogKey]
+	if !ok {
+		return carrier
+	}
+	data := v.BinaryValue
+	if v.StringValue != nil {
+		data = []byte(*v.StringValue)
+	}
+	if err := json.Unmarshal(data, &carrier); err != nil {
+		log.Debug("contrib/aws/aws-sdk-go-v2/aws: Failed to decode the %s message attribute: %v", datadogKey, err)
+	}
+	return carrier
+}
+
+// snsNotificationCarrier returns the propagated values of the SNS
+// notification body, which is the body of the SQS messages delivered by SNS
+// without raw message delivery.
+func snsNotificationCarrier(body string) tracer.TextMapCarrier {
+	carrier := make(tracer.TextMapCarrier)
+	var notification struct {
+		MessageAttributes map[string]struct {
+			Type  string
+			Value string
+		}
+	}
+	if err := json.Unmarshal([]byte(body), &notification); err != nil {
+		return carrier
+	}
+	attr, ok := notification.MessageAttributes[datadogKey]
+	if !ok {
+		return carrier
+	}
+	data := []byte(attr.Value)
+	if attr.Type == "Binary" {
+		// binary attributes are base64 encoded in notifications
+		var err error
+		if data, err = base64.StdEncoding.DecodeString(attr.Value); err != nil {
+			return carrier
+		}
+	}
+	json.Unmarshal(data, &carrier)
+	return carrier
+}
+
+// inject returns the JSON encoded trace context of span, and the pathway of
+// the produce checkpoint if set.
+func (mw *traceMiddleware) inject(ctx context.Context, span ddtrace.Span, edges []string, size int64) ([]byte, error) {
+	carrier := make(tracer.TextMapCarrier)
+	if err := tracer.Inject(span.Context(), carrier); err != nil {
+		return nil, err
+	}
+	mw.setProduceCheckpoint(ctx, edges, size, carrier)
+	return json.Marshal(carrier)
+}
+
+// setProduceCheckpoint sets a produce checkpoint on the pathway of ctx and
+// injects it into carrier, if data streams is enabled and carrier is not nil.
+func (mw *traceMiddleware) setProduceCheckpoint(ctx context.Context, edges []string, size int64, carrier tracer.TextMapCarrier) {
+	if !mw.cfg.dataStreamsEnabled {
+		return
+	}
+	ctx, ok := tracer.SetDataStreamsCheckpointWithParams(ctx, options.CheckpointParams{PayloadSize: size}, edges...)
+	if !ok || carrier == nil {
+		return
+	}
+	datastreams.InjectToBase64Carrier(ctx, carrier)
+}
+
+func (mw *traceMiddleware) injectSQSAttributes(ctx context.Context, span ddtrace.Span, edges []string, body string, attrs map[string]sqstypes.MessageAttributeValue) map[string]sqstypes.MessageAttributeValue {
+	size := sqsMessageSize(body, attrs)
+	if len(attrs) >= maxMessageAttributes {
+		log.Debug("contrib/aws/aws-sdk-go-v2/aws: Cannot inject trace context into an SQS message with %d attributes", len(attrs))
+		mw.setProduceCheckpoint(ctx, edges, size, nil)
+		return attrs
+	}
+	v, err := mw.inject(ctx, span, edges, size)
+	if err != nil {
+		log.Debug("contrib/aws/aws-sdk-go-v2/aws: Failed to inject trace context into an SQS message: %v", err)
+		return attrs
+	}
+	if attrs == nil {
+		attrs = make(map[string]sqstypes.MessageAttributeValue, 1)
+	}
+	attrs[datadogKey] = sqstypes.MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String(string(v)),
+	}
+	return attrs
+}
+
+func (mw *traceMiddleware) injectSNSAttributes(ctx context.Context, span ddtrace.Span, edges []string, msg string, attrs map[string]snstypes.MessageAttributeValue) map[string]snstypes.MessageAttributeValue {
+	size := snsMessageSize(msg, attrs)
+	if len(attrs) >= maxMessageAttributes {
+		log.Debug("contrib/aws/aws-sdk-go-v2/aws: Cannot inject trace context into an SNS message with %d attributes", len(attrs))
+		mw.setProduceCheckpoint(ctx, edges, size, nil)
+		return attrs
+	}
+	v, err := mw.inject(ctx, span, edges, size)
+	if err != nil {
+		log.Debug("contrib/aws/aws-sdk-go-v2/aws: Failed to inject trace context into an SNS message: %v", err)
+		return attrs
+	}
+	if attrs == nil {
+		attrs = make(map[string]snstypes.MessageAttributeValue, 1)
+	}
+	// a binary attribute is used so that SQS subscriptions with raw message
+	// delivery don't filter it out
+	attrs[datadogKey] = snstypes.MessageAttributeValue{
+		DataType:    aws.String("Binary"),
+		BinaryValue: v,
+	}
+	return attrs
+}
+
+// injectJSON returns data, which is expected to be a JSON object, with an
+// additional "_datadog" field. data is returned unchanged if it is not a JSON
+// object, already has the field, or if the result would be larger than
+// maxSize.
+func (mw *traceMiddleware) injectJSON(ctx context.Context, span ddtrace.Span, edges []string, data []byte, maxSize int) []byte {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil || fields == nil {
+		mw.setProduceCheckpoint(ctx, edges, int64(len(data)), nil)
+		return data
+	}
+	if _, ok := fields[datadogKey]; ok {
+		mw.setProduceCheckpoint(ctx, edges, int64(len(data)), nil)
+		return data
+	}
+	v, err := mw.inject(ctx, span, edges, int64(len(data)))
+	if err != nil {
+		log.Debug("contrib/aws/aws-sdk-go-v2/aws: Failed to inject trace context: %v", err)
+		return data
+	}
+	// append the field rather than re-encoding the object, which would
+	// reorder its fields
+	obj := bytes.TrimRight(data, " \t\r\n")
+	injected := make([]byte, 0, len(obj)+len(datadogKey)+len(v)+4)
+	injected = append(injected, obj[:len(obj)-1]...)
+	if len(fields) > 0 {
+		injected = append(injected, ',')
+	}
+	injected = append(injected, `"`+datadogKey+`":`...)
+	injected = append(injected, v...)
+	injected = append(injected, '}')
+	if len(injected) > maxSize {
+		log.Debug("contrib/aws/aws-sdk-go-v2/aws: Cannot inject trace context, the payload would exceed %d bytes", maxSize)
+		return data
+	}
+	return injected
+}
+
+// withDatadogAttribute returns names with the "_datadog" attribute, if not
+// already requested.
+func withDatadogAttribute(names []string) []string {
+	for _, n := range names {
+		if n == datadogKey || n == "All" || n == ".*" {
+			return names
+		}
+	}
+	return append(names, datadogKey)
+}
+
+func queueEdges(direction, queueURL string) []string {
+	parts := strings.Split(queueURL, "/")
+	return []string{"direction:" + direction, "topic:" + parts[len(parts)-1], "type:sqs"}
+}
+
+func topicEdges(topicARN, targetARN *string) []string {
+	arn := aws.ToString(topicARN)
+	if arn == "" {
+		arn = aws.ToString(targetARN)
+	}
+	parts := strings.Split(arn, ":")
+	return []string{"direction:out", "topic:" + parts[len(parts)-1], "type:sns"}
+}
+
+func streamEdges(name, arn *string) []string {
+	stream := aws.ToString(name)
+	if stream == "" {
+		parts := strings.Split(aws.ToString(arn), "/")
+		stream = parts[len(parts)-1]
+	}
+	return []string{"direction:out", "topic:" + stream, "type:kinesis"}
+}
+
+func busEdges(e *eventbridgetypes.PutEventsRequestEntry) []string {
+	bus := aws.ToString(e.EventBusName)
+	if bus == "" {
+		bus = "default"
+	}
+	return []string{"direction:out", "topic:" + bus, "type:bus"}
+}
+
+func sqsMessageSize(body string, attrs map[string]sqstypes.MessageAttributeValue) int64 {
+	size := len(body)
+	for k, v := range attrs {
+		size += len(k) + len(aws.ToString(v.DataType)) + len(aws.ToString(v.StringValue)) + len(v.BinaryValue)
+	}
+	return int64(size)
+}
+
+func snsMessageSize(msg string, attrs map[string]snstypes.MessageAttributeValue) int64 {
+	size := len(msg)
+	for k, v := range attrs {
+		size += len(k) + len(aws.ToString(v.DataType)) + len(aws.ToString(v.StringValue)) + len(v.BinaryValue)
+	}
+	return int64(size)
+}
+
+// eventBridgeEntrySize returns the size of e, excluding its detail, as
+// counted against the size limit of events.
+func eventBridgeEntrySize(e *eventbridgetypes.PutEventsRequestEntry) int {
+	size := len(aws.ToString(e.Source)) + len(aws.ToString(e.DetailType))
+	for _, r := range e.Resources {
+		size += len(r)
+	}
+	if e.Time != nil {
+		size += 14
+	}
+	return size
+}
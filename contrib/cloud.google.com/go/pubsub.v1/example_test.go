@@ -8,6 +8,7 @@ package pubsub_test
 import (
 	"context"
 	"log"
+	"net/http"
 
 	pubsubtrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/cloud.google.com/go/pubsub.v1"
 
@@ -41,3 +42,12 @@ func ExampleSubscription_Receive() {
 		log.Fatal(err)
 	}
 }
+
+func ExampleWrapPushHandler() {
+	// the endpoint of a push subscription, or of the HTTP target tasks of a Cloud Tasks queue
+	http.Handle("/push", pubsubtrace.WrapPushHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// TODO: Handle message, r.Context() holds the receive span.
+		w.WriteHeader(http.StatusNoContent)
+	})))
+	log.Fatal(http.ListenAndServe(":8080", nil))
+}
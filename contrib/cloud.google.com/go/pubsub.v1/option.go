@@ -6,14 +6,17 @@
 package pubsub
 
 import (
+	"gopkg.in/DataDog/dd-trace-go.v1/internal"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/namingschema"
 )
 
 type config struct {
-	serviceName     string
-	publishSpanName string
-	receiveSpanName string
-	measured        bool
+	serviceName        string
+	publishSpanName    string
+	receiveSpanName    string
+	cloudTasksSpanName string
+	measured           bool
+	dataStreamsEnabled bool
 }
 
 func defaultConfig() *config {
@@ -22,28 +25,37 @@ func defaultConfig() *config {
 			"",
 			namingschema.WithOverrideV0(""),
 		).GetName(),
-		publishSpanName: namingschema.NewGCPPubsubOutboundOp().GetName(),
-		receiveSpanName: namingschema.NewGCPPubsubInboundOp().GetName(),
-		measured:        false,
+		publishSpanName:    namingschema.NewGCPPubsubOutboundOp().GetName(),
+		receiveSpanName:    namingschema.NewGCPPubsubInboundOp().GetName(),
+		cloudTasksSpanName: namingschema.NewGCPCloudTasksInboundOp().GetName(),
+		measured:           false,
+		dataStreamsEnabled: internal.BoolEnv("DD_DATA_STREAMS_ENABLED", false),
 	}
 }
 
-// A Option is used to customize spans started by WrapReceiveHandler or Publish.
+// A Option is used to customize spans started by WrapReceiveHandler, WrapPushHandler or Publish.
 type Option func(cfg *config)
 
 // A ReceiveOption has been deprecated in favor of Option.
 type ReceiveOption = Option
 
-// WithServiceName sets the service name tag for traces started by WrapReceiveHandler or Publish.
+// WithServiceName sets the service name tag for traces started by WrapReceiveHandler, WrapPushHandler or Publish.
 func WithServiceName(serviceName string) Option {
 	return func(cfg *config) {
 		cfg.serviceName = serviceName
 	}
 }
 
-// WithMeasured sets the measured tag for traces started by WrapReceiveHandler or Publish.
+// WithMeasured sets the measured tag for traces started by WrapReceiveHandler, WrapPushHandler or Publish.
 func WithMeasured() Option {
 	return func(cfg *config) {
 		cfg.measured = true
 	}
 }
+
+// WithDataStreams enables the Data Streams monitoring product features: https://www.datadoghq.com/product/data-streams-monitoring/
+func WithDataStreams() Option {
+	return func(cfg *config) {
+		cfg.dataStreamsEnabled = true
+	}
+}
@@ -10,6 +10,8 @@ import (
 	"context"
 	"sync"
 
+	"gopkg.in/DataDog/dd-trace-go.v1/datastreams"
+	"gopkg.in/DataDog/dd-trace-go.v1/datastreams/options"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
@@ -63,6 +65,7 @@ func Publish(ctx context.Context, t *pubsub.Topic, msg *pubsub.Message, opts ...
 	if err := tracer.Inject(span.Context(), tracer.TextMapCarrier(msg.Attributes)); err != nil {
 		log.Debug("contrib/cloud.google.com/go/pubsub.v1/: failed injecting tracing attributes: %v", err)
 	}
+	setProduceCheckpoint(ctx, cfg.dataStreamsEnabled, t.ID(), msg)
 	span.SetTag("num_attributes", len(msg.Attributes))
 	return &PublishResult{
 		PublishResult: t.Publish(ctx, msg),
@@ -123,6 +126,43 @@ func WrapReceiveHandler(s *pubsub.Subscription, f func(context.Context, *pubsub.
 			span.SetTag("delivery_attempt", *msg.DeliveryAttempt)
 		}
 		defer span.Finish()
+		ctx = setConsumeCheckpoint(ctx, cfg.dataStreamsEnabled, s.ID(), msg.Data, msg.Attributes)
 		f(ctx, msg)
 	}
 }
+
+func setProduceCheckpoint(ctx context.Context, enabled bool, topic string, msg *pubsub.Message) {
+	if !enabled {
+		return
+	}
+	edges := []string{"direction:out", "topic:" + topic, "type:google-pubsub"}
+	carrier := tracer.TextMapCarrier(msg.Attributes)
+	ctx, ok := tracer.SetDataStreamsCheckpointWithParams(datastreams.ExtractFromBase64Carrier(ctx, carrier), options.CheckpointParams{PayloadSize: getMsgSize(msg.Data, msg.Attributes)}, edges...)
+	if !ok {
+		return
+	}
+	datastreams.InjectToBase64Carrier(ctx, carrier)
+}
+
+// setConsumeCheckpoint sets a consume checkpoint on the pathway found in the
+// attributes of a message received from the subscription, and returns ctx
+// with the resulting pathway, so that it is propagated to the messages
+// produced while processing it.
+func setConsumeCheckpoint(ctx context.Context, enabled bool, subscription string, data []byte, attrs map[string]string) context.Context {
+	if !enabled {
+		return ctx
+	}
+	edges := []string{"direction:in", "subscription:" + subscription, "type:google-pubsub"}
+	pathwayCtx, ok := tracer.SetDataStreamsCheckpointWithParams(datastreams.ExtractFromBase64Carrier(ctx, tracer.TextMapCarrier(attrs)), options.CheckpointParams{PayloadSize: getMsgSize(data, attrs)}, edges...)
+	if !ok {
+		return ctx
+	}
+	return pathwayCtx
+}
+
+func getMsgSize(data []byte, attrs map[string]string) (size int64) {
+	for k, v := range attrs {
+		size += int64(len(k) + len(v))
+	}
+	return size + int64(len(data))
+}
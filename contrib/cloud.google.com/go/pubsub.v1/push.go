@@ -0,0 +1,228 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package pubsub
+
+//go:generate sh -c "go run make_responsewriter.go | gofmt > push_gen.go"
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/datastreams"
+	"gopkg.in/DataDog/dd-trace-go.v1/datastreams/options"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+)
+
+// The headers set by Cloud Tasks on the requests of HTTP target tasks, see
+// https://cloud.google.com/tasks/docs/creating-http-target-tasks#handler.
+const (
+	cloudTasksQueueNameHeader      = "X-CloudTasks-QueueName"
+	cloudTasksTaskNameHeader       = "X-CloudTasks-TaskName"
+	cloudTasksRetryCountHeader     = "X-CloudTasks-TaskRetryCount"
+	cloudTasksExecutionCountHeader = "X-CloudTasks-TaskExecutionCount"
+	cloudTasksETAHeader            = "X-CloudTasks-TaskETA"
+)
+
+// maxPushEnvelopeSize is the size of the largest request body decoded as a
+// push envelope. Messages are at most 10MB, which is about 13.4MB once
+// base64-encoded in the envelope.
+const maxPushEnvelopeSize = 14 << 20
+
+// pushEnvelope is the body of the requests of push subscriptions, see
+// https://cloud.google.com/pubsub/docs/push#receive_push.
+type pushEnvelope struct {
+	Message struct {
+		Attributes  map[string]string `json:"attributes"`
+		Data        []byte            `json:"data"`
+		ID          string            `json:"messageId"`
+		PublishTime time.Time         `json:"publishTime"`
+		OrderingKey string            `json:"orderingKey"`
+	} `json:"message"`
+	Subscription    string `json:"subscription"`
+	DeliveryAttempt *int   `json:"deliveryAttempt"`
+}
+
+// WrapPushHandler returns an http.Handler which traces the messages delivered
+// to h by push subscriptions, and the tasks dispatched to h by Cloud Tasks.
+// The tracing metadata is extracted from the attributes of the messages, which
+// are decoded from the JSON bodies of the requests, up to 14MB, and from the
+// headers of the tasks. A receive
+// span is started and set in the context of the request, and finished once h
+// has responded. Any other request is passed to h untraced.
+func WrapPushHandler(h http.Handler, opts ...Option) http.Handler {
+	cfg := defaultConfig()
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	log.Debug("contrib/cloud.google.com/go/pubsub.v1: Wrapping Push Handler: %#v", cfg)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var span ddtrace.Span
+		if queue := r.Header.Get(cloudTasksQueueNameHeader); queue != "" {
+			span, r = startCloudTasksSpan(cfg, r, queue)
+		} else if env, ok := decodePushEnvelope(r); ok {
+			span, r = startPushSpan(cfg, r, env)
+		} else {
+			h.ServeHTTP(w, r)
+			return
+		}
+		rw, ddrw := wrapResponseWriter(w)
+		h.ServeHTTP(rw, r)
+		status := ddrw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetTag(ext.HTTPCode, strconv.Itoa(status))
+		var err error
+		if status >= 500 {
+			err = fmt.Errorf("%d: %s", status, http.StatusText(status))
+		}
+		span.Finish(tracer.WithError(err))
+	})
+}
+
+// decodePushEnvelope decodes the push envelope sent in the body of r, if it
+// is JSON and at most maxPushEnvelopeSize bytes long. The body is restored for
+// the handler.
+func decodePushEnvelope(r *http.Request) (*pushEnvelope, bool) {
+	if r.Method != http.MethodPost || r.Body == nil {
+		return nil, false
+	}
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+		return nil, false
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPushEnvelopeSize+1))
+	// the rest of the body, if any, is read by the handler
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil {
+		log.Debug("contrib/cloud.google.com/go/pubsub.v1: failed reading push request: %v", err)
+		return nil, false
+	}
+	if len(body) > maxPushEnvelopeSize {
+		return nil, false
+	}
+	var env pushEnvelope
+	if err := json.Unmarshal(body, &env); err != nil || env.Subscription == "" {
+		return nil, false
+	}
+	return &env, true
+}
+
+func startPushSpan(cfg *config, r *http.Request, env *pushEnvelope) (ddtrace.Span, *http.Request) {
+	msg := env.Message
+	opts := []ddtrace.StartSpanOption{
+		tracer.ResourceName(env.Subscription),
+		tracer.SpanType(ext.SpanTypeMessageConsumer),
+		tracer.Tag("subscription", env.Subscription),
+		tracer.Tag("message_size", len(msg.Data)),
+		tracer.Tag("num_attributes", len(msg.Attributes)),
+		tracer.Tag("ordering_key", msg.OrderingKey),
+		tracer.Tag("message_id", msg.ID),
+		tracer.Tag("publish_time", msg.PublishTime.String()),
+		tracer.Tag(ext.Component, componentName),
+		tracer.Tag(ext.SpanKind, ext.SpanKindConsumer),
+		tracer.Tag(ext.MessagingSystem, ext.MessagingSystemGCPPubsub),
+	}
+	if env.DeliveryAttempt != nil {
+		opts = append(opts, tracer.Tag("delivery_attempt", *env.DeliveryAttempt))
+	}
+	span, ctx := startConsumerSpan(r.Context(), cfg, cfg.receiveSpanName, tracer.TextMapCarrier(msg.Attributes), opts)
+	// the subscription is sent by its full name: projects/<project>/subscriptions/<subscription>
+	subscription := env.Subscription[strings.LastIndexByte(env.Subscription, '/')+1:]
+	ctx = setConsumeCheckpoint(ctx, cfg.dataStreamsEnabled, subscription, msg.Data, msg.Attributes)
+	return span, r.WithContext(ctx)
+}
+
+func startCloudTasksSpan(cfg *config, r *http.Request, queue string) (ddtrace.Span, *http.Request) {
+	opts := []ddtrace.StartSpanOption{
+		tracer.ResourceName(queue),
+		tracer.SpanType(ext.SpanTypeMessageConsumer),
+		tracer.Tag("queue_name", queue),
+		tracer.Tag("task_name", r.Header.Get(cloudTasksTaskNameHeader)),
+		tracer.Tag("retry_count", r.Header.Get(cloudTasksRetryCountHeader)),
+		tracer.Tag("execution_count", r.Header.Get(cloudTasksExecutionCountHeader)),
+		tracer.Tag("task_eta", r.Header.Get(cloudTasksETAHeader)),
+		tracer.Tag(ext.Component, componentName),
+		tracer.Tag(ext.SpanKind, ext.SpanKindConsumer),
+		tracer.Tag(ext.MessagingSystem, ext.MessagingSystemGCPCloudTasks),
+	}
+	carrier := tracer.HTTPHeadersCarrier(r.Header)
+	span, ctx := startConsumerSpan(r.Context(), cfg, cfg.cloudTasksSpanName, carrier, opts)
+	if cfg.dataStreamsEnabled {
+		var size int64
+		if r.ContentLength > 0 {
+			size = r.ContentLength
+		}
+		edges := []string{"direction:in", "topic:" + queue, "type:google-cloudtasks"}
+		if pathwayCtx, ok := tracer.SetDataStreamsCheckpointWithParams(datastreams.ExtractFromBase64Carrier(ctx, carrier), options.CheckpointParams{PayloadSize: size}, edges...); ok {
+			ctx = pathwayCtx
+		}
+	}
+	return span, r.WithContext(ctx)
+}
+
+// startConsumerSpan starts a consumer span as a child of the span context
+// found in carrier, or else of the span found in ctx, e.g. the one of the
+// request.
+func startConsumerSpan(ctx context.Context, cfg *config, operationName string, carrier tracer.TextMapReader, opts []ddtrace.StartSpanOption) (ddtrace.Span, context.Context) {
+	if cfg.serviceName != "" {
+		opts = append(opts, tracer.ServiceName(cfg.serviceName))
+	}
+	if cfg.measured {
+		opts = append(opts, tracer.Measured())
+	}
+	if spanctx, err := tracer.Extract(carrier); err == nil {
+		span := tracer.StartSpan(operationName, append(opts, tracer.ChildOf(spanctx))...)
+		return span, tracer.ContextWithSpan(ctx, span)
+	}
+	return tracer.StartSpanFromContext(ctx, operationName, opts...)
+}
+
+// responseWriter is a small wrapper around an http response writer that will
+// intercept and store the status of a request.
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func newResponseWriter(w http.ResponseWriter) *responseWriter {
+	return &responseWriter{w, 0}
+}
+
+// Status returns the status code that was monitored.
+func (w *responseWriter) Status() int {
+	return w.status
+}
+
+// Write writes the data to the connection as part of an HTTP reply.
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// WriteHeader sends an HTTP response header with status code, and records it.
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status != 0 {
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+	w.status = status
+}
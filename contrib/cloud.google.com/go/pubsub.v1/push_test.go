@@ -0,0 +1,188 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package pubsub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/datastreams"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPushHandler(t *testing.T) {
+	ctx, cancel, mt, topic, sub := setup(t)
+
+	_, err := Publish(ctx, topic, &pubsub.Message{Data: []byte("hello"), OrderingKey: "xxx"}, WithDataStreams()).Get(ctx)
+	require.NoError(t, err)
+	// receive the message without tracing, to push it to the handler
+	var msg *pubsub.Message
+	err = sub.Receive(ctx, func(_ context.Context, m *pubsub.Message) {
+		msg = m
+		m.Ack()
+		cancel()
+	})
+	require.NoError(t, err)
+	require.NotNil(t, msg)
+
+	body, err := json.Marshal(map[string]interface{}{
+		"message": map[string]interface{}{
+			"attributes":  msg.Attributes,
+			"data":        msg.Data,
+			"messageId":   msg.ID,
+			"publishTime": msg.PublishTime,
+			"orderingKey": msg.OrderingKey,
+		},
+		"subscription":    sub.String(),
+		"deliveryAttempt": 2,
+	})
+	require.NoError(t, err)
+
+	var (
+		called bool
+		spanID uint64
+	)
+	h := WrapPushHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		span, ok := tracer.SpanFromContext(r.Context())
+		require.True(t, ok, "no span")
+		spanID = span.Context().SpanID()
+
+		p, ok := datastreams.PathwayFromContext(r.Context())
+		require.True(t, ok, "no pathway")
+		expectedCtx, _ := tracer.SetDataStreamsCheckpoint(context.Background(), "direction:out", "topic:topic", "type:google-pubsub")
+		expectedCtx, _ = tracer.SetDataStreamsCheckpoint(expectedCtx, "direction:in", "subscription:subscription", "type:google-pubsub")
+		expected, _ := datastreams.PathwayFromContext(expectedCtx)
+		assert.Equal(t, expected.GetHash(), p.GetHash())
+
+		got, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Equal(t, body, got, "the body should be restored")
+		_, ok = w.(http.Flusher)
+		assert.True(t, ok, "the optional interfaces of the response writer should be kept")
+		w.WriteHeader(http.StatusNoContent)
+	}), WithDataStreams())
+	req := httptest.NewRequest(http.MethodPost, "/push", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.True(t, called, "handler not called")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	spans := mt.FinishedSpans()
+	require.Len(t, spans, 2)
+	publish, push := spans[0], spans[1]
+	assert.Equal(t, "pubsub.receive", push.OperationName())
+	assert.Equal(t, spanID, push.SpanID())
+	assert.Equal(t, publish.SpanID(), push.ParentID())
+	assert.Equal(t, publish.TraceID(), push.TraceID())
+	assert.Equal(t, map[string]interface{}{
+		"subscription":      "projects/project/subscriptions/subscription",
+		"message_size":      5,
+		"num_attributes":    3, // 2 tracing attributes and the pathway
+		"ordering_key":      "xxx",
+		"message_id":        msg.ID,
+		"publish_time":      msg.PublishTime.UTC().String(),
+		"delivery_attempt":  2,
+		ext.ResourceName:    "projects/project/subscriptions/subscription",
+		ext.SpanType:        ext.SpanTypeMessageConsumer,
+		ext.HTTPCode:        "204",
+		ext.Component:       "cloud.google.com/go/pubsub.v1",
+		ext.SpanKind:        ext.SpanKindConsumer,
+		ext.MessagingSystem: "googlepubsub",
+	}, push.Tags())
+}
+
+func TestPushHandlerCloudTasks(t *testing.T) {
+	_, _, mt, _, _ := setup(t)
+
+	parent := tracer.StartSpan("create-task")
+	req := httptest.NewRequest(http.MethodPost, "/task", bytes.NewReader([]byte("payload")))
+	err := tracer.Inject(parent.Context(), tracer.HTTPHeadersCarrier(req.Header))
+	require.NoError(t, err)
+	parent.Finish()
+	req.Header.Set("X-CloudTasks-QueueName", "queue")
+	req.Header.Set("X-CloudTasks-TaskName", "task")
+	req.Header.Set("X-CloudTasks-TaskRetryCount", "1")
+	req.Header.Set("X-CloudTasks-TaskExecutionCount", "1")
+	req.Header.Set("X-CloudTasks-TaskETA", "1700000000.0")
+
+	h := WrapPushHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := datastreams.PathwayFromContext(r.Context())
+		require.True(t, ok, "no pathway")
+		expectedCtx, _ := tracer.SetDataStreamsCheckpoint(context.Background(), "direction:in", "topic:queue", "type:google-cloudtasks")
+		expected, _ := datastreams.PathwayFromContext(expectedCtx)
+		assert.Equal(t, expected.GetHash(), p.GetHash())
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}), WithDataStreams(), WithServiceName("tasks"))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	spans := mt.FinishedSpans()
+	require.Len(t, spans, 2)
+	s := spans[1]
+	assert.Equal(t, "cloudtasks.receive", s.OperationName())
+	assert.Equal(t, parent.Context().SpanID(), s.ParentID())
+	assert.Equal(t, "tasks", s.Tag(ext.ServiceName))
+	assert.Equal(t, "queue", s.Tag(ext.ResourceName))
+	assert.Equal(t, "queue", s.Tag("queue_name"))
+	assert.Equal(t, "task", s.Tag("task_name"))
+	assert.Equal(t, "1", s.Tag("retry_count"))
+	assert.Equal(t, "1", s.Tag("execution_count"))
+	assert.Equal(t, "1700000000.0", s.Tag("task_eta"))
+	assert.Equal(t, "503", s.Tag(ext.HTTPCode))
+	assert.NotNil(t, s.Tag(ext.Error))
+	assert.Equal(t, ext.SpanKindConsumer, s.Tag(ext.SpanKind))
+	assert.Equal(t, "googlecloudtasks", s.Tag(ext.MessagingSystem))
+}
+
+func TestPushHandlerUntraced(t *testing.T) {
+	_, _, mt, _, _ := setup(t)
+
+	var bodies []string
+	h := WrapPushHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, ok := tracer.SpanFromContext(r.Context())
+		assert.False(t, ok)
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		bodies = append(bodies, string(body))
+	}))
+	envelope := `{"message":{"messageId":"1","data":"aGVsbG8="},"subscription":"projects/p/subscriptions/s"}`
+	jsonRequest := func(body string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/push", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return req
+	}
+	large := `{"message":{"data":"` + strings.Repeat("A", maxPushEnvelopeSize) + `"},"subscription":"projects/p/subscriptions/s"}`
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/push", nil))
+	h.ServeHTTP(httptest.NewRecorder(), jsonRequest("not an envelope"))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/push", strings.NewReader(envelope))) // no content type
+	h.ServeHTTP(httptest.NewRecorder(), jsonRequest(large))
+	assert.Equal(t, []string{"", "not an envelope", envelope, large}, bodies)
+	assert.Empty(t, mt.FinishedSpans())
+}
+
+func TestDecodePushEnvelope(t *testing.T) {
+	var env pushEnvelope
+	err := json.Unmarshal([]byte(`{"message":{"messageId":"1","publishTime":"2021-02-26T19:13:55.749Z","data":"aGVsbG8="},"subscription":"projects/p/subscriptions/s"}`), &env)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2021, 2, 26, 19, 13, 55, 749000000, time.UTC), env.Message.PublishTime)
+	assert.Equal(t, []byte("hello"), env.Message.Data)
+	assert.Equal(t, "1", env.Message.ID)
+}
@@ -8,7 +8,9 @@ package kafka
 import (
 	"context"
 	"errors"
+	"fmt"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -160,6 +162,108 @@ func TestConsumerChannel(t *testing.T) {
 	}
 }
 
+func TestConsumerChannelBatch(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	cfg := &kafka.ConfigMap{
+		"go.events.channel.enable": true, // required for the events channel to be turned on
+		"group.id":                 testGroupID,
+		"socket.timeout.ms":        10,
+		"session.timeout.ms":       10,
+		"enable.auto.offset.store": false,
+	}
+	kc, err := kafka.NewConsumer(cfg)
+	require.NoError(t, err)
+
+	var upstream []string
+	newMessage := func(partition int32, offset kafka.Offset) *kafka.Message {
+		msg := &kafka.Message{
+			TopicPartition: kafka.TopicPartition{
+				Topic:     &testTopic,
+				Partition: partition,
+				Offset:    offset,
+			},
+			Value: []byte("value"),
+		}
+		span := tracer.StartSpan("produce")
+		err := tracer.Inject(span.Context(), NewMessageCarrier(msg))
+		require.NoError(t, err)
+		span.Finish()
+		upstream = append(upstream, fmt.Sprintf("%d:%d", span.Context().TraceID(), span.Context().SpanID()))
+		return msg
+	}
+	// the messages buffered before the consumer is wrapped are received
+	// together, and batched by partition
+	msgs := []*kafka.Message{newMessage(1, 1), newMessage(1, 2), newMessage(2, 1)}
+	for _, msg := range msgs {
+		kc.Events() <- msg
+	}
+	c := WrapConsumer(kc, WithConfig(cfg), WithBatchConsume())
+	for range msgs {
+		<-c.Events()
+	}
+	// the next message is received after the batch
+	kc.Events() <- newMessage(2, 2)
+	<-c.Events()
+
+	c.Close()
+	// wait for the events channel to be closed
+	<-c.Events()
+
+	spans := mt.FinishedSpans()[4:] // skip the producer spans
+	require.Len(t, spans, 3)
+	for i, tt := range []struct {
+		partition int32
+		upstream  []string
+	}{
+		{partition: 1, upstream: upstream[:2]},
+		{partition: 2, upstream: upstream[2:3]},
+		{partition: 2, upstream: upstream[3:]},
+	} {
+		s := spans[i]
+		assert.Equal(t, "kafka.consume", s.OperationName())
+		assert.Equal(t, "Consume Topic gotest", s.Tag(ext.ResourceName))
+		assert.Equal(t, testTopic, s.Tag(ext.MessagingKafkaTopic))
+		assert.Equal(t, tt.partition, s.Tag(ext.MessagingKafkaPartition))
+		assert.Equal(t, len(tt.upstream), s.Tag(ext.MessagingBatchMessageCount))
+		assert.Equal(t, strings.Join(tt.upstream, ","), s.Tag(ext.MessagingBatchUpstream))
+		assert.Equal(t, ext.SpanKindConsumer, s.Tag(ext.SpanKind))
+		assert.Equal(t, "kafka", s.Tag(ext.MessagingSystem))
+		assert.Equal(t, componentName, s.Tag(ext.Component))
+	}
+	for i, msg := range msgs {
+		spanctx, err := tracer.Extract(NewMessageCarrier(msg))
+		require.NoError(t, err)
+		assert.Equal(t, spans[i/2].SpanID(), spanctx.SpanID(), "the batch span context should be injected into the headers")
+	}
+}
+
+func TestBatchSpanUpstreamCap(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	c := &Consumer{cfg: newConfig()}
+	var b *batchSpan
+	for i := 0; i < maxBatchUpstream+2; i++ {
+		msg := &kafka.Message{TopicPartition: kafka.TopicPartition{Topic: &testTopic, Partition: 1, Offset: kafka.Offset(i)}}
+		span := tracer.StartSpan("produce")
+		err := tracer.Inject(span.Context(), NewMessageCarrier(msg))
+		require.NoError(t, err)
+		span.Finish()
+		if b == nil {
+			b = c.startBatchSpan(msg)
+		}
+		b.add(msg)
+	}
+	b.finish()
+
+	s := mt.FinishedSpans()[maxBatchUpstream+2]
+	assert.Equal(t, maxBatchUpstream+2, s.Tag(ext.MessagingBatchMessageCount))
+	assert.Len(t, strings.Split(s.Tag(ext.MessagingBatchUpstream).(string), ","), maxBatchUpstream)
+	assert.Equal(t, 2, s.Tag(ext.MessagingBatchUpstreamDropped))
+}
+
 /*
 to run the integration test locally:
 
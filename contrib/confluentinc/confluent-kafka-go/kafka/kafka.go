@@ -8,7 +8,9 @@ package kafka // import "gopkg.in/DataDog/dd-trace-go.v1/contrib/confluentinc/co
 
 import (
 	"context"
+	"fmt"
 	"math"
+	"strings"
 	"time"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/datastreams"
@@ -82,25 +84,45 @@ func (c *Consumer) traceEventsChannel(in chan kafka.Event) chan kafka.Event {
 	out := make(chan kafka.Event, 1)
 	go func() {
 		defer close(out)
+		var batch *batchSpan
 		for evt := range in {
-			var next ddtrace.Span
+			var (
+				next      ddtrace.Span
+				prevBatch *batchSpan
+			)
 
 			// only trace messages
 			if msg, ok := evt.(*kafka.Message); ok {
-				next = c.startSpan(msg)
+				if c.cfg.batchConsume {
+					if batch == nil || !batch.accepts(msg) {
+						prevBatch, batch = batch, c.startBatchSpan(msg)
+					}
+					batch.add(msg)
+					// the batch is made of the messages which were
+					// already buffered when its first one was received
+					batch.complete = len(in) == 0
+				} else {
+					next = c.startSpan(msg)
+				}
 				setConsumeCheckpoint(c.cfg.dataStreamsEnabled, c.cfg.groupID, msg)
 			} else if offset, ok := evt.(kafka.OffsetsCommitted); ok {
-				commitOffsets(c.cfg.dataStreamsEnabled, c.cfg.groupID, offset.Offsets, offset.Error)
+				c.commitOffsets(offset.Offsets, offset.Error)
 			}
 
 			out <- evt
 
+			if prevBatch != nil {
+				prevBatch.finish()
+			}
 			if c.prev != nil {
 				c.prev.Finish()
 			}
 			c.prev = next
 		}
 		// finish any remaining span
+		if batch != nil {
+			batch.finish()
+		}
 		if c.prev != nil {
 			c.prev.Finish()
 			c.prev = nil
@@ -143,6 +165,82 @@ func (c *Consumer) startSpan(msg *kafka.Message) ddtrace.Span {
 	return span
 }
 
+// maxBatchUpstream caps the number of span contexts recorded by a batch span,
+// to bound the size of its ext.MessagingBatchUpstream tag.
+const maxBatchUpstream = 100
+
+// A batchSpan traces the processing of a batch of messages consumed from a
+// topic partition.
+type batchSpan struct {
+	ddtrace.Span
+	topic     string
+	partition int32
+	count     int
+	upstream  []string
+	// dropped is the number of span contexts left out of upstream.
+	dropped int
+	// complete reports whether the batch can't receive more messages.
+	complete bool
+}
+
+func (c *Consumer) startBatchSpan(msg *kafka.Message) *batchSpan {
+	opts := []tracer.StartSpanOption{
+		tracer.ServiceName(c.cfg.consumerServiceName),
+		tracer.ResourceName("Consume Topic " + *msg.TopicPartition.Topic),
+		tracer.SpanType(ext.SpanTypeMessageConsumer),
+		tracer.Tag(ext.MessagingKafkaTopic, *msg.TopicPartition.Topic),
+		tracer.Tag(ext.MessagingKafkaPartition, msg.TopicPartition.Partition),
+		tracer.Tag(ext.Component, componentName),
+		tracer.Tag(ext.SpanKind, ext.SpanKindConsumer),
+		tracer.Tag(ext.MessagingSystem, ext.MessagingSystemKafka),
+		tracer.Measured(),
+	}
+	if c.cfg.bootstrapServers != "" {
+		opts = append(opts, tracer.Tag(ext.KafkaBootstrapServers, c.cfg.bootstrapServers))
+	}
+	if !math.IsNaN(c.cfg.analyticsRate) {
+		opts = append(opts, tracer.Tag(ext.EventSampleRate, c.cfg.analyticsRate))
+	}
+	span, _ := tracer.StartSpanFromContext(c.cfg.ctx, c.cfg.consumerSpanName, opts...)
+	return &batchSpan{
+		Span:      span,
+		topic:     *msg.TopicPartition.Topic,
+		partition: msg.TopicPartition.Partition,
+	}
+}
+
+// accepts reports whether msg belongs to the batch.
+func (b *batchSpan) accepts(msg *kafka.Message) bool {
+	return !b.complete && *msg.TopicPartition.Topic == b.topic && msg.TopicPartition.Partition == b.partition
+}
+
+// add adds msg to the batch. The span context found in its headers is
+// recorded, up to maxBatchUpstream, and replaced with the one of the batch so
+// consumers can pick it up.
+func (b *batchSpan) add(msg *kafka.Message) {
+	b.count++
+	carrier := NewMessageCarrier(msg)
+	if spanctx, err := tracer.Extract(carrier); err == nil {
+		if len(b.upstream) < maxBatchUpstream {
+			b.upstream = append(b.upstream, fmt.Sprintf("%d:%d", spanctx.TraceID(), spanctx.SpanID()))
+		} else {
+			b.dropped++
+		}
+	}
+	tracer.Inject(b.Context(), carrier)
+}
+
+func (b *batchSpan) finish() {
+	b.SetTag(ext.MessagingBatchMessageCount, b.count)
+	if len(b.upstream) > 0 {
+		b.SetTag(ext.MessagingBatchUpstream, strings.Join(b.upstream, ","))
+	}
+	if b.dropped > 0 {
+		b.SetTag(ext.MessagingBatchUpstreamDropped, b.dropped)
+	}
+	b.Finish()
+}
+
 // Close calls the underlying Consumer.Close and if polling is enabled, finishes
 // any remaining span.
 func (c *Consumer) Close() error {
@@ -164,7 +262,7 @@ func (c *Consumer) Events() chan kafka.Event {
 }
 
 // Poll polls the consumer for messages or events. Message will be
-// traced.
+// traced, one span per message even if WithBatchConsume is used.
 func (c *Consumer) Poll(timeoutMS int) (event kafka.Event) {
 	if c.prev != nil {
 		c.prev.Finish()
@@ -175,12 +273,13 @@ func (c *Consumer) Poll(timeoutMS int) (event kafka.Event) {
 		setConsumeCheckpoint(c.cfg.dataStreamsEnabled, c.cfg.groupID, msg)
 		c.prev = c.startSpan(msg)
 	} else if offset, ok := evt.(kafka.OffsetsCommitted); ok {
-		commitOffsets(c.cfg.dataStreamsEnabled, c.cfg.groupID, offset.Offsets, offset.Error)
+		c.commitOffsets(offset.Offsets, offset.Error)
 	}
 	return evt
 }
 
-// ReadMessage polls the consumer for a message. Message will be traced.
+// ReadMessage polls the consumer for a message. Message will be traced, one
+// span per message even if WithBatchConsume is used.
 func (c *Consumer) ReadMessage(timeout time.Duration) (*kafka.Message, error) {
 	if c.prev != nil {
 		c.prev.Finish()
@@ -198,30 +297,40 @@ func (c *Consumer) ReadMessage(timeout time.Duration) (*kafka.Message, error) {
 // Commit commits current offsets and tracks the commit offsets if data streams is enabled.
 func (c *Consumer) Commit() ([]kafka.TopicPartition, error) {
 	tps, err := c.Consumer.Commit()
-	commitOffsets(c.cfg.dataStreamsEnabled, c.cfg.groupID, tps, err)
+	c.commitOffsets(tps, err)
 	return tps, err
 }
 
 // CommitMessage commits a message and tracks the commit offsets if data streams is enabled.
 func (c *Consumer) CommitMessage(msg *kafka.Message) ([]kafka.TopicPartition, error) {
 	tps, err := c.Consumer.CommitMessage(msg)
-	commitOffsets(c.cfg.dataStreamsEnabled, c.cfg.groupID, tps, err)
+	c.commitOffsets(tps, err)
 	return tps, err
 }
 
 // CommitOffsets commits provided offsets and tracks the commit offsets if data streams is enabled.
 func (c *Consumer) CommitOffsets(offsets []kafka.TopicPartition) ([]kafka.TopicPartition, error) {
 	tps, err := c.Consumer.CommitOffsets(offsets)
-	commitOffsets(c.cfg.dataStreamsEnabled, c.cfg.groupID, tps, err)
+	c.commitOffsets(tps, err)
 	return tps, err
 }
 
-func commitOffsets(dataStreamsEnabled bool, groupID string, tps []kafka.TopicPartition, err error) {
-	if err != nil || groupID == "" || !dataStreamsEnabled {
+// commitOffsets tracks the committed offsets, which are the ones of the next
+// messages to consume, and the high watermarks of their partitions as last
+// fetched from the broker, to compute the Kafka lag of the consumer group.
+func (c *Consumer) commitOffsets(tps []kafka.TopicPartition, err error) {
+	if err != nil || c.cfg.groupID == "" || !c.cfg.dataStreamsEnabled {
 		return
 	}
 	for _, tp := range tps {
-		tracer.TrackKafkaCommitOffset(groupID, *tp.Topic, tp.Partition, int64(tp.Offset))
+		if tp.Topic == nil || tp.Offset < 0 {
+			// no offset was committed for this partition
+			continue
+		}
+		tracer.TrackKafkaCommitOffset(c.cfg.groupID, *tp.Topic, tp.Partition, int64(tp.Offset))
+		if _, high, err := c.Consumer.GetWatermarkOffsets(*tp.Topic, tp.Partition); err == nil && high >= 0 {
+			tracer.TrackKafkaHighWatermarkOffset(*tp.Topic, tp.Partition, high)
+		}
 	}
 }
 
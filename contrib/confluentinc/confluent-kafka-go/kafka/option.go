@@ -30,6 +30,7 @@ type config struct {
 	groupID             string
 	tagFns              map[string]func(msg *kafka.Message) interface{}
 	dataStreamsEnabled  bool
+	batchConsume        bool
 }
 
 // An Option customizes the config.
@@ -135,3 +136,19 @@ func WithDataStreams() Option {
 		cfg.dataStreamsEnabled = true
 	}
 }
+
+// WithBatchConsume traces the messages received from the Events channel of a
+// Consumer by batch rather than one by one: a single span is started for the
+// messages of a topic partition which were buffered together, and finished
+// once the next batch is received, when they have been processed. It is
+// tagged with the number of messages and records the span context found in
+// the headers of each, up to 100, which is replaced with its own.
+//
+// Batch tracing is not supported by Poll and ReadMessage, which return a
+// single message without telling which ones were buffered with it: their
+// messages are still traced one by one.
+func WithBatchConsume() Option {
+	return func(cfg *config) {
+		cfg.batchConsume = true
+	}
+}
@@ -0,0 +1,84 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package nats_test
+
+import (
+	"time"
+
+	natstrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/nats-io/nats.go"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/nats-io/nats.go"
+)
+
+func Example_publish() {
+	nc, err := nats.Connect(nats.DefaultURL)
+	if err != nil {
+		panic(err)
+	}
+	defer nc.Close()
+
+	js, err := natstrace.JetStream(nc, natstrace.WithDataStreams())
+	if err != nil {
+		panic(err)
+	}
+	_, err = js.Publish("orders.created", []byte("Hello World"))
+	if err != nil {
+		panic(err)
+	}
+}
+
+func Example_subscribe() {
+	nc, err := nats.Connect(nats.DefaultURL)
+	if err != nil {
+		panic(err)
+	}
+	defer nc.Close()
+
+	js, err := natstrace.JetStream(nc, natstrace.WithDataStreams())
+	if err != nil {
+		panic(err)
+	}
+	sub, err := js.Subscribe("orders.*", func(msg *nats.Msg) {
+		// if you want to use the message as a parent span:
+		if spanctx, err := natstrace.ExtractSpanContext(msg); err == nil {
+			span := tracer.StartSpan("process", tracer.ChildOf(spanctx))
+			span.Finish()
+		}
+		msg.Ack()
+	}, nats.Durable("orders"))
+	if err != nil {
+		panic(err)
+	}
+	defer sub.Unsubscribe()
+}
+
+func Example_pullSubscribe() {
+	nc, err := nats.Connect(nats.DefaultURL)
+	if err != nil {
+		panic(err)
+	}
+	defer nc.Close()
+
+	js, err := natstrace.JetStream(nc, natstrace.WithDataStreams())
+	if err != nil {
+		panic(err)
+	}
+	sub, err := js.PullSubscribe("orders.*", "orders")
+	if err != nil {
+		panic(err)
+	}
+	msgs, err := sub.Fetch(10, nats.MaxWait(time.Second))
+	if err != nil {
+		panic(err)
+	}
+	for _, msg := range msgs {
+		// messages of pull subscriptions must be traced explicitly
+		span := js.StartConsumeSpan(msg)
+		msg.Ack()
+		span.Finish()
+	}
+}
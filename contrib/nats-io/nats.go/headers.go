@@ -0,0 +1,44 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package nats
+
+import (
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/nats-io/nats.go"
+)
+
+// A headersCarrier implements TextMapReader/TextMapWriter for extracting/injecting traces on nats.Header.
+type headersCarrier nats.Header
+
+var _ interface {
+	tracer.TextMapReader
+	tracer.TextMapWriter
+} = (headersCarrier)(nil)
+
+// ForeachKey conforms to the TextMapReader interface.
+func (c headersCarrier) ForeachKey(handler func(key, val string) error) error {
+	for k, vals := range c {
+		if len(vals) == 0 {
+			continue
+		}
+		if err := handler(k, vals[0]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Set implements TextMapWriter
+func (c headersCarrier) Set(key, val string) {
+	nats.Header(c).Set(key, val)
+}
+
+// ExtractSpanContext retrieves the SpanContext from the headers of a nats.Msg.
+func ExtractSpanContext(msg *nats.Msg) (ddtrace.SpanContext, error) {
+	return tracer.Extract(headersCarrier(msg.Header))
+}
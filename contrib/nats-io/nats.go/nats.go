@@ -0,0 +1,277 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+// Package nats provides functions to trace the JetStream API of the nats-io/nats.go package (https://github.com/nats-io/nats.go).
+package nats // import "gopkg.in/DataDog/dd-trace-go.v1/contrib/nats-io/nats.go"
+
+import (
+	"context"
+	"math"
+	"net/url"
+	"strconv"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/datastreams"
+	"gopkg.in/DataDog/dd-trace-go.v1/datastreams/options"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/telemetry"
+
+	"github.com/nats-io/nats.go"
+)
+
+const componentName = "nats-io/nats.go"
+
+func init() {
+	telemetry.LoadIntegration(componentName)
+	tracer.MarkIntegrationImported("github.com/nats-io/nats.go")
+}
+
+// JetStream calls nc.JetStream with the options set by WithJetStreamOptions
+// and wraps the resulting JetStreamContext. The spans are tagged with the
+// address of the server nc is connected to.
+func JetStream(nc *nats.Conn, opts ...Option) (*JetStreamContext, error) {
+	cfg := newConfig(opts...)
+	js, err := nc.JetStream(cfg.jetStreamOpts...)
+	if err != nil {
+		return nil, err
+	}
+	wrapped := wrapJetStreamContext(js, cfg)
+	if u, err := url.Parse(nc.ConnectedUrl()); err == nil {
+		wrapped.host = u.Hostname()
+		wrapped.port, _ = strconv.Atoi(u.Port())
+	}
+	return wrapped, nil
+}
+
+// WrapJetStreamContext wraps a nats.JetStreamContext so that the messages
+// published and consumed through it are traced.
+func WrapJetStreamContext(js nats.JetStreamContext, opts ...Option) *JetStreamContext {
+	return wrapJetStreamContext(js, newConfig(opts...))
+}
+
+func wrapJetStreamContext(js nats.JetStreamContext, cfg *config) *JetStreamContext {
+	log.Debug("contrib/nats-io/nats.go: Wrapping JetStreamContext: %#v", cfg)
+	return &JetStreamContext{
+		JetStreamContext: js,
+		cfg:              cfg,
+	}
+}
+
+// A brokerConfig holds information about the server for span tags.
+type brokerConfig struct {
+	host string
+	port int
+}
+
+// A JetStreamContext wraps a nats.JetStreamContext. Messages published
+// synchronously or asynchronously, and messages delivered to the handlers of
+// Subscribe and QueueSubscribe, are traced. Messages received from other
+// subscriptions, e.g. with PullSubscribe, can be traced with StartConsumeSpan.
+type JetStreamContext struct {
+	nats.JetStreamContext
+	brokerConfig
+	cfg *config
+}
+
+func (js *JetStreamContext) peerTags() []tracer.StartSpanOption {
+	if js.host == "" {
+		return nil
+	}
+	opts := []tracer.StartSpanOption{tracer.Tag(ext.NetworkDestinationName, js.host)}
+	if js.port != 0 {
+		opts = append(opts, tracer.Tag(ext.NetworkDestinationPort, js.port))
+	}
+	return opts
+}
+
+// Publish publishes data to the subject and traces the request, see PublishMsg.
+func (js *JetStreamContext) Publish(subj string, data []byte, opts ...nats.PubOpt) (*nats.PubAck, error) {
+	msg := nats.NewMsg(subj)
+	msg.Data = data
+	return js.PublishMsg(msg, opts...)
+}
+
+// PublishMsg calls nats.JetStreamContext.PublishMsg and traces the request.
+// The span is a child of the span found in the context set with the
+// nats.Context option, if any. Its context is injected into the headers of a
+// copy of the message, which is published instead, so that msg is left
+// untouched.
+func (js *JetStreamContext) PublishMsg(msg *nats.Msg, opts ...nats.PubOpt) (*nats.PubAck, error) {
+	span, msg := js.startPublishSpan(msg, opts)
+	ack, err := js.JetStreamContext.PublishMsg(msg, opts...)
+	if err == nil {
+		span.SetTag(ext.MessagingNATSStream, ack.Stream)
+		span.SetTag(ext.MessagingNATSSequence, ack.Sequence)
+		if js.cfg.dataStreamsEnabled {
+			tracer.TrackDataStreamsProduceOffset("nats", ack.Stream, 0, int64(ack.Sequence))
+		}
+	}
+	span.Finish(tracer.WithError(err))
+	return ack, err
+}
+
+// PublishAsync publishes data to the subject asynchronously and traces the
+// request, see PublishMsgAsync.
+func (js *JetStreamContext) PublishAsync(subj string, data []byte, opts ...nats.PubOpt) (nats.PubAckFuture, error) {
+	msg := nats.NewMsg(subj)
+	msg.Data = data
+	return js.PublishMsgAsync(msg, opts...)
+}
+
+// PublishMsgAsync calls nats.JetStreamContext.PublishMsgAsync and traces the
+// request like PublishMsg. The span is finished once the message is sent,
+// without waiting for its acknowledgement.
+func (js *JetStreamContext) PublishMsgAsync(msg *nats.Msg, opts ...nats.PubOpt) (nats.PubAckFuture, error) {
+	span, msg := js.startPublishSpan(msg, opts)
+	future, err := js.JetStreamContext.PublishMsgAsync(msg, opts...)
+	span.Finish(tracer.WithError(err))
+	return future, err
+}
+
+// Subscribe calls nats.JetStreamContext.Subscribe, tracing each message
+// delivered to cb, see StartConsumeSpan.
+func (js *JetStreamContext) Subscribe(subj string, cb nats.MsgHandler, opts ...nats.SubOpt) (*nats.Subscription, error) {
+	return js.JetStreamContext.Subscribe(subj, js.traceHandler(cb), opts...)
+}
+
+// QueueSubscribe calls nats.JetStreamContext.QueueSubscribe, tracing each
+// message delivered to cb, see StartConsumeSpan.
+func (js *JetStreamContext) QueueSubscribe(subj, queue string, cb nats.MsgHandler, opts ...nats.SubOpt) (*nats.Subscription, error) {
+	return js.JetStreamContext.QueueSubscribe(subj, queue, js.traceHandler(cb), opts...)
+}
+
+func (js *JetStreamContext) traceHandler(cb nats.MsgHandler) nats.MsgHandler {
+	return func(msg *nats.Msg) {
+		span := js.StartConsumeSpan(msg)
+		defer span.Finish()
+		cb(msg)
+	}
+}
+
+// StartConsumeSpan starts the span of the processing of a message received
+// from JetStream, as a child of the span context found in its headers. Its
+// context is injected into the headers of the message, and can be retrieved
+// with ExtractSpanContext. The caller must finish the span once the message
+// is processed.
+func (js *JetStreamContext) StartConsumeSpan(msg *nats.Msg) ddtrace.Span {
+	opts := []tracer.StartSpanOption{
+		tracer.ServiceName(js.cfg.consumerServiceName),
+		tracer.ResourceName("Consume " + msg.Subject),
+		tracer.SpanType(ext.SpanTypeMessageConsumer),
+		tracer.Tag(ext.MessagingNATSSubject, msg.Subject),
+		tracer.Tag(ext.Component, componentName),
+		tracer.Tag(ext.SpanKind, ext.SpanKindConsumer),
+		tracer.Tag(ext.MessagingSystem, ext.MessagingSystemNATS),
+		tracer.Measured(),
+	}
+	md, err := msg.Metadata()
+	if err == nil {
+		opts = append(opts,
+			tracer.Tag(ext.MessagingNATSStream, md.Stream),
+			tracer.Tag(ext.MessagingNATSConsumer, md.Consumer),
+			tracer.Tag(ext.MessagingNATSSequence, md.Sequence.Stream),
+		)
+	}
+	opts = append(opts, js.peerTags()...)
+	if !math.IsNaN(js.cfg.analyticsRate) {
+		opts = append(opts, tracer.Tag(ext.EventSampleRate, js.cfg.analyticsRate))
+	}
+	if msg.Header == nil {
+		msg.Header = make(nats.Header)
+	}
+	carrier := headersCarrier(msg.Header)
+	if spanctx, err := tracer.Extract(carrier); err == nil {
+		opts = append(opts, tracer.ChildOf(spanctx))
+	}
+	span := tracer.StartSpan(js.cfg.consumerSpanName, opts...)
+	// reinject the span context so consumers can pick it up
+	if err := tracer.Inject(span.Context(), carrier); err != nil {
+		log.Debug("contrib/nats-io/nats.go: Failed to inject span context into message headers, %v", err)
+	}
+	setConsumeCheckpoint(js.cfg.dataStreamsEnabled, md, msg)
+	return span
+}
+
+// startPublishSpan starts the span of the publication of msg, and returns it
+// along with the copy of msg to publish, which carries its context.
+func (js *JetStreamContext) startPublishSpan(msg *nats.Msg, pubOpts []nats.PubOpt) (ddtrace.Span, *nats.Msg) {
+	opts := []tracer.StartSpanOption{
+		tracer.ServiceName(js.cfg.producerServiceName),
+		tracer.ResourceName("Publish " + msg.Subject),
+		tracer.SpanType(ext.SpanTypeMessageProducer),
+		tracer.Tag(ext.MessagingNATSSubject, msg.Subject),
+		tracer.Tag(ext.Component, componentName),
+		tracer.Tag(ext.SpanKind, ext.SpanKindProducer),
+		tracer.Tag(ext.MessagingSystem, ext.MessagingSystemNATS),
+	}
+	opts = append(opts, js.peerTags()...)
+	if !math.IsNaN(js.cfg.analyticsRate) {
+		opts = append(opts, tracer.Tag(ext.EventSampleRate, js.cfg.analyticsRate))
+	}
+	ctx := context.Background()
+	for _, o := range pubOpts {
+		if c, ok := o.(nats.ContextOpt); ok && c.Context != nil {
+			ctx = c.Context
+		}
+	}
+	span, _ := tracer.StartSpanFromContext(ctx, js.cfg.producerSpanName, opts...)
+	// copy the message and its headers so that the caller's aren't modified
+	copied := *msg
+	copied.Header = make(nats.Header, len(msg.Header)+4)
+	for k, v := range msg.Header {
+		copied.Header[k] = v
+	}
+	if err := tracer.Inject(span.Context(), headersCarrier(copied.Header)); err != nil {
+		log.Debug("contrib/nats-io/nats.go: Failed to inject span context into message headers, %v", err)
+	}
+	setProduceCheckpoint(js.cfg.dataStreamsEnabled, &copied)
+	return span, &copied
+}
+
+func setProduceCheckpoint(enabled bool, msg *nats.Msg) {
+	if !enabled {
+		return
+	}
+	edges := []string{"direction:out", "topic:" + msg.Subject, "type:nats"}
+	carrier := headersCarrier(msg.Header)
+	ctx, ok := tracer.SetDataStreamsCheckpointWithParams(datastreams.ExtractFromBase64Carrier(context.Background(), carrier), options.CheckpointParams{PayloadSize: getMsgSize(msg)}, edges...)
+	if !ok {
+		return
+	}
+	datastreams.InjectToBase64Carrier(ctx, carrier)
+}
+
+// setConsumeCheckpoint sets a consume checkpoint on the pathway of msg, whose
+// JetStream metadata is md, or nil if it has none.
+func setConsumeCheckpoint(enabled bool, md *nats.MsgMetadata, msg *nats.Msg) {
+	if !enabled {
+		return
+	}
+	edges := []string{"direction:in", "topic:" + msg.Subject, "type:nats"}
+	if md != nil {
+		edges = append(edges, "stream:"+md.Stream, "consumer:"+md.Consumer)
+	}
+	carrier := headersCarrier(msg.Header)
+	ctx, ok := tracer.SetDataStreamsCheckpointWithParams(datastreams.ExtractFromBase64Carrier(context.Background(), carrier), options.CheckpointParams{PayloadSize: getMsgSize(msg)}, edges...)
+	if !ok {
+		return
+	}
+	datastreams.InjectToBase64Carrier(ctx, carrier)
+	if md != nil {
+		// the consumed offset is the one of the next message to consume
+		tracer.TrackDataStreamsConsumeOffset("nats", md.Consumer, md.Stream, 0, int64(md.Sequence.Stream)+1)
+	}
+}
+
+func getMsgSize(msg *nats.Msg) (size int64) {
+	for k, vals := range msg.Header {
+		for _, v := range vals {
+			size += int64(len(k) + len(v))
+		}
+	}
+	return size + int64(len(msg.Data))
+}
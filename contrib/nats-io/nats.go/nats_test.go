@@ -0,0 +1,204 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package nats
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/datastreams"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testStream  = "gotest"
+	testSubject = "gotest.subject"
+)
+
+func skipIntegrationTest(t *testing.T) {
+	if _, ok := os.LookupEnv("INTEGRATION"); !ok {
+		t.Skip("🚧 Skipping integration test (INTEGRATION environment variable is not set)")
+	}
+}
+
+func TestHeadersCarrier(t *testing.T) {
+	headers := nats.Header{
+		"a":     {"b", "c"},
+		"empty": {},
+	}
+	got := make(map[string]string)
+	err := headersCarrier(headers).ForeachKey(func(key, val string) error {
+		got[key] = val
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "b"}, got)
+
+	headersCarrier(headers).Set("a", "d")
+	assert.Equal(t, []string{"d"}, headers["a"])
+}
+
+func TestDataStreamsCheckpoints(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	msg := nats.NewMsg(testSubject)
+	msg.Data = []byte("body")
+	setProduceCheckpoint(false, msg)
+	assert.Empty(t, msg.Header, "data streams disabled")
+
+	setProduceCheckpoint(true, msg)
+	produced, ok := datastreams.PathwayFromContext(datastreams.ExtractFromBase64Carrier(context.Background(), headersCarrier(msg.Header)))
+	require.True(t, ok)
+	expectedCtx, _ := tracer.SetDataStreamsCheckpoint(context.Background(), "direction:out", "topic:"+testSubject, "type:nats")
+	expected, _ := datastreams.PathwayFromContext(expectedCtx)
+	assert.Equal(t, expected.GetHash(), produced.GetHash())
+
+	md := &nats.MsgMetadata{Stream: testStream, Consumer: "consumer"}
+	setConsumeCheckpoint(true, md, msg)
+	consumed, ok := datastreams.PathwayFromContext(datastreams.ExtractFromBase64Carrier(context.Background(), headersCarrier(msg.Header)))
+	require.True(t, ok)
+	expectedCtx, _ = tracer.SetDataStreamsCheckpoint(expectedCtx, "direction:in", "topic:"+testSubject, "type:nats", "stream:"+testStream, "consumer:consumer")
+	expected, _ = datastreams.PathwayFromContext(expectedCtx)
+	assert.Equal(t, expected.GetHash(), consumed.GetHash())
+	assert.Len(t, msg.Header, 1, "the pathway header is replaced")
+}
+
+// fakeJetStream is a nats.JetStreamContext recording the messages published
+// through it.
+type fakeJetStream struct {
+	nats.JetStreamContext
+	published []*nats.Msg
+}
+
+func (js *fakeJetStream) PublishMsg(msg *nats.Msg, _ ...nats.PubOpt) (*nats.PubAck, error) {
+	js.published = append(js.published, msg)
+	return &nats.PubAck{Stream: testStream, Sequence: uint64(len(js.published))}, nil
+}
+
+func TestPublishMsg(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	fake := &fakeJetStream{}
+	js := WrapJetStreamContext(fake)
+	parent, ctx := tracer.StartSpanFromContext(context.Background(), "parent")
+	// a span context already in the headers, e.g. of a consumed message
+	// being republished, isn't the parent of the publish span
+	other := tracer.StartSpan("other")
+	msg := nats.NewMsg(testSubject)
+	require.NoError(t, tracer.Inject(other.Context(), headersCarrier(msg.Header)))
+	headers := nats.Header(http.Header(msg.Header).Clone())
+	_, err := js.PublishMsg(msg, nats.Context(ctx))
+	require.NoError(t, err)
+	parent.Finish()
+	other.Finish()
+
+	assert.Equal(t, headers, msg.Header, "the caller's message isn't modified")
+	require.Len(t, fake.published, 1)
+	assert.NotSame(t, msg, fake.published[0])
+	spans := mt.FinishedSpans()
+	require.Len(t, spans, 3)
+	publish := spans[0]
+	assert.Equal(t, "nats.publish", publish.OperationName())
+	assert.Equal(t, parent.Context().SpanID(), publish.ParentID())
+	spanctx, err := ExtractSpanContext(fake.published[0])
+	require.NoError(t, err)
+	assert.Equal(t, publish.SpanID(), spanctx.SpanID())
+
+	// without a context, the publish span is a root span
+	_, err = js.PublishMsg(msg)
+	require.NoError(t, err)
+	spans = mt.FinishedSpans()
+	require.Len(t, spans, 4)
+	assert.Zero(t, spans[3].ParentID())
+}
+
+func TestPublishConsume(t *testing.T) {
+	skipIntegrationTest(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	nc, err := nats.Connect("nats://localhost:4222")
+	require.NoError(t, err)
+	defer nc.Close()
+	js, err := JetStream(nc, WithDataStreams())
+	require.NoError(t, err)
+	js.DeleteStream(testStream)
+	_, err = js.AddStream(&nats.StreamConfig{Name: testStream, Subjects: []string{testSubject}})
+	require.NoError(t, err)
+	defer js.DeleteStream(testStream)
+
+	ack, err := js.Publish(testSubject, []byte("Hello World"))
+	require.NoError(t, err)
+	assert.Equal(t, testStream, ack.Stream)
+
+	received := make(chan *nats.Msg, 1)
+	sub, err := js.Subscribe(testSubject, func(msg *nats.Msg) {
+		received <- msg
+	}, nats.Durable("consumer"))
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	var msg *nats.Msg
+	select {
+	case msg = <-received:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the message")
+	}
+	assert.Equal(t, "Hello World", string(msg.Data))
+	require.NoError(t, sub.Unsubscribe())
+
+	var spans []mocktracer.Span
+	require.Eventually(t, func() bool {
+		spans = mt.FinishedSpans()
+		return len(spans) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	publish, consume := spans[0], spans[1]
+
+	assert.Equal(t, "nats.publish", publish.OperationName())
+	assert.Equal(t, "nats", publish.Tag(ext.ServiceName))
+	assert.Equal(t, "Publish "+testSubject, publish.Tag(ext.ResourceName))
+	assert.Equal(t, ext.SpanTypeMessageProducer, publish.Tag(ext.SpanType))
+	assert.Equal(t, testSubject, publish.Tag(ext.MessagingNATSSubject))
+	assert.Equal(t, testStream, publish.Tag(ext.MessagingNATSStream))
+	assert.Equal(t, ack.Sequence, publish.Tag(ext.MessagingNATSSequence))
+	assert.Equal(t, ext.SpanKindProducer, publish.Tag(ext.SpanKind))
+	assert.Equal(t, ext.MessagingSystemNATS, publish.Tag(ext.MessagingSystem))
+	assert.Equal(t, componentName, publish.Tag(ext.Component))
+	assert.Equal(t, "localhost", publish.Tag(ext.NetworkDestinationName))
+	assert.Equal(t, 4222, publish.Tag(ext.NetworkDestinationPort))
+
+	assert.Equal(t, "nats.consume", consume.OperationName())
+	assert.Equal(t, "Consume "+testSubject, consume.Tag(ext.ResourceName))
+	assert.Equal(t, ext.SpanTypeMessageConsumer, consume.Tag(ext.SpanType))
+	assert.Equal(t, testStream, consume.Tag(ext.MessagingNATSStream))
+	assert.Equal(t, "consumer", consume.Tag(ext.MessagingNATSConsumer))
+	assert.Equal(t, ack.Sequence, consume.Tag(ext.MessagingNATSSequence))
+	assert.Equal(t, ext.SpanKindConsumer, consume.Tag(ext.SpanKind))
+	assert.Equal(t, publish.SpanID(), consume.ParentID())
+	assert.Equal(t, publish.TraceID(), consume.TraceID())
+
+	spanctx, err := ExtractSpanContext(msg)
+	require.NoError(t, err)
+	assert.Equal(t, consume.SpanID(), spanctx.SpanID())
+
+	p, ok := datastreams.PathwayFromContext(datastreams.ExtractFromBase64Carrier(context.Background(), headersCarrier(msg.Header)))
+	require.True(t, ok)
+	expectedCtx, _ := tracer.SetDataStreamsCheckpoint(context.Background(), "direction:out", "topic:"+testSubject, "type:nats")
+	expectedCtx, _ = tracer.SetDataStreamsCheckpoint(expectedCtx, "direction:in", "topic:"+testSubject, "type:nats", "stream:"+testStream, "consumer:consumer")
+	expected, _ := datastreams.PathwayFromContext(expectedCtx)
+	assert.Equal(t, expected.GetHash(), p.GetHash())
+}
@@ -0,0 +1,52 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package exec_test
+
+import (
+	"context"
+	"os/exec"
+
+	exectrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/os/exec"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+func Example() {
+	tracer.Start()
+	defer tracer.Stop()
+
+	span, ctx := tracer.StartSpanFromContext(context.Background(), "parent.request")
+	defer span.Finish()
+
+	// The command span is a child of "parent.request", and its context is
+	// injected into the environment of the child process.
+	out, err := exectrace.CommandContext(ctx, "ls", "-l").Output()
+	if err != nil {
+		// handle the error
+	}
+	_ = out
+}
+
+// An example showing how to configure the command span using WrapCmd.
+func ExampleWrapCmd() {
+	cmd := exec.Command("git", "status")
+	err := exectrace.WrapCmd(context.Background(), cmd, exectrace.WithServiceName("git")).Run()
+	if err != nil {
+		// handle the error
+	}
+}
+
+// An example showing how a child Go program continues the trace of its parent.
+func Example_child() {
+	tracer.Start()
+	defer tracer.Stop()
+
+	var opts []tracer.StartSpanOption
+	if sctx, err := tracer.ExtractFromEnv(); err == nil {
+		opts = append(opts, tracer.ChildOf(sctx))
+	}
+	span := tracer.StartSpan("batch.job", opts...)
+	defer span.Finish()
+}
@@ -0,0 +1,198 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+// Package exec provides functions to trace the os/exec package (https://golang.org/pkg/os/exec).
+//
+// Commands created using Command or CommandContext start a span when they are started,
+// which is finished once they complete. The span context is injected into the
+// environment of the child process, from which child Go programs can continue the
+// trace by calling tracer.ExtractFromEnv.
+//
+// Command and CommandContext use the default configuration. To configure the span,
+// create the command using os/exec and wrap it with WrapCmd, which accepts options.
+package exec // import "gopkg.in/DataDog/dd-trace-go.v1/contrib/os/exec"
+
+import (
+	"context"
+	"encoding/json"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/telemetry"
+)
+
+const componentName = "os/exec"
+
+func init() {
+	telemetry.LoadIntegration(componentName)
+	tracer.MarkIntegrationImported(componentName)
+}
+
+const (
+	operationName = "command_execution"
+
+	// tagExec holds the JSON encoded command path, followed by its arguments
+	// when enabled using WithArgs.
+	tagExec = "cmd.exec"
+
+	// tagExitCode holds the exit code of the child process.
+	tagExitCode = "cmd.exit_code"
+)
+
+// Cmd wraps an exec.Cmd so that its execution is traced.
+type Cmd struct {
+	*exec.Cmd
+	ctx  context.Context
+	cfg  *config
+	span ddtrace.Span
+}
+
+// Command returns a traced Cmd to execute the named program with the given arguments.
+// See exec.Command for more details. Use WrapCmd to pass options.
+func Command(name string, arg ...string) *Cmd {
+	return wrap(context.Background(), exec.Command(name, arg...))
+}
+
+// CommandContext is like Command but includes a context. The context is used to kill
+// the process as per exec.CommandContext, and to find the parent span of the command span.
+func CommandContext(ctx context.Context, name string, arg ...string) *Cmd {
+	return wrap(ctx, exec.CommandContext(ctx, name, arg...))
+}
+
+// WrapCmd wraps an existing exec.Cmd, which must not be started yet, so that its
+// execution is traced. The given context is used to find the parent span.
+func WrapCmd(ctx context.Context, cmd *exec.Cmd, opts ...Option) *Cmd {
+	c := wrap(ctx, cmd)
+	for _, fn := range opts {
+		fn(c.cfg)
+	}
+	return c
+}
+
+func wrap(ctx context.Context, cmd *exec.Cmd) *Cmd {
+	cfg := new(config)
+	defaults(cfg)
+	return &Cmd{Cmd: cmd, ctx: ctx, cfg: cfg}
+}
+
+// Start starts the command and its span, as per exec.Cmd.Start. The span is finished
+// by Wait, or immediately if the command fails to start.
+func (c *Cmd) Start() error {
+	c.startSpan()
+	err := c.Cmd.Start()
+	if err != nil {
+		c.finishSpan(err)
+	}
+	return err
+}
+
+// Wait waits for the command to exit, as per exec.Cmd.Wait, and finishes its span.
+func (c *Cmd) Wait() error {
+	err := c.Cmd.Wait()
+	c.finishSpan(err)
+	return err
+}
+
+// Run starts the command and waits for it to complete, as per exec.Cmd.Run.
+func (c *Cmd) Run() error {
+	c.startSpan()
+	err := c.Cmd.Run()
+	c.finishSpan(err)
+	return err
+}
+
+// Output runs the command and returns its standard output, as per exec.Cmd.Output.
+func (c *Cmd) Output() ([]byte, error) {
+	c.startSpan()
+	out, err := c.Cmd.Output()
+	c.finishSpan(err)
+	return out, err
+}
+
+// CombinedOutput runs the command and returns its combined standard output and
+// standard error, as per exec.Cmd.CombinedOutput.
+func (c *Cmd) CombinedOutput() ([]byte, error) {
+	c.startSpan()
+	out, err := c.Cmd.CombinedOutput()
+	c.finishSpan(err)
+	return out, err
+}
+
+func (c *Cmd) startSpan() {
+	if c.span != nil || c.Process != nil {
+		// already started; exec.Cmd will return the appropriate error
+		return
+	}
+	args := []string{c.Path}
+	if c.cfg.withArgs && len(c.Args) > 1 {
+		args = append(args, c.Args[1:]...)
+	}
+	execTag, _ := json.Marshal(args)
+	opts := []ddtrace.StartSpanOption{
+		tracer.ResourceName(filepath.Base(c.Path)),
+		tracer.Tag(tagExec, string(execTag)),
+		tracer.Tag(ext.Component, componentName),
+		tracer.Tag(ext.SpanKind, ext.SpanKindClient),
+	}
+	if c.cfg.serviceName != "" {
+		opts = append(opts, tracer.ServiceName(c.cfg.serviceName))
+	}
+	c.span, _ = tracer.StartSpanFromContext(c.ctx, operationName, opts...)
+	if !c.cfg.propagation {
+		return
+	}
+	env := tracer.EnvCarrier(removePropagationEnv(c.Environ()))
+	if err := tracer.Inject(c.span.Context(), &env); err != nil {
+		log.Debug("contrib/os/exec: failed to inject span context: %v", err)
+	}
+	c.Env = env
+}
+
+func (c *Cmd) finishSpan(err error) {
+	if c.span == nil {
+		return
+	}
+	if c.ProcessState != nil {
+		c.span.SetTag(tagExitCode, c.ProcessState.ExitCode())
+	}
+	c.span.Finish(tracer.WithError(err))
+	c.span = nil
+}
+
+// propagationEnvPrefixes lists the prefixes of the environment variables which may
+// be written by any of the propagators.
+var propagationEnvPrefixes = []string{
+	"X_DATADOG_",
+	"OT_BAGGAGE_",
+	"X_B3_",
+	"B3=",
+	"TRACEPARENT=",
+	"TRACESTATE=",
+}
+
+// removePropagationEnv removes the environment variables holding trace context,
+// typically inherited from the parent of the current process, so that they do
+// not leak into the child process when not overwritten by the injection.
+func removePropagationEnv(env []string) []string {
+	out := env[:0]
+	for _, kv := range env {
+		var found bool
+		for _, p := range propagationEnvPrefixes {
+			if strings.HasPrefix(kv, p) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			out = append(out, kv)
+		}
+	}
+	return out
+}
@@ -0,0 +1,107 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package exec
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMain allows this test binary to be used as the child process: when
+// the EXEC_TEST_CHILD variable is set, it prints its environment and exits.
+func TestMain(m *testing.M) {
+	if code := os.Getenv("EXEC_TEST_CHILD"); code != "" {
+		for _, kv := range os.Environ() {
+			os.Stdout.WriteString(kv + "\n")
+		}
+		n, _ := strconv.Atoi(code)
+		os.Exit(n)
+	}
+	os.Exit(m.Run())
+}
+
+func childCommand(ctx context.Context, exitCode int, opts ...Option) *Cmd {
+	cmd := exec.CommandContext(ctx, os.Args[0], "-test.run=none")
+	cmd.Env = append(os.Environ(), "EXEC_TEST_CHILD="+strconv.Itoa(exitCode), "X_DATADOG_TAGS=_dd.p.stale=1")
+	return WrapCmd(ctx, cmd, opts...)
+}
+
+func TestOutput(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	root, ctx := tracer.StartSpanFromContext(context.Background(), "root")
+	out, err := childCommand(ctx, 0).Output()
+	root.Finish()
+	require.NoError(t, err)
+
+	spans := mt.FinishedSpans()
+	require.Len(t, spans, 2)
+	s := spans[0]
+	assert.Equal("command_execution", s.OperationName())
+	assert.Equal(root.Context().SpanID(), s.ParentID())
+	assert.Equal(0, s.Tag(tagExitCode))
+	assert.Equal("os/exec", s.Tag(ext.Component))
+	assert.NotContains(s.Tag(tagExec), "-test.run")
+
+	env := tracer.EnvCarrier(strings.Split(string(out), "\n"))
+	assert.NotContains(env, "X_DATADOG_TAGS=_dd.p.stale=1")
+	assert.Contains(env, "X_DATADOG_PARENT_ID="+strconv.FormatUint(s.SpanID(), 10))
+}
+
+func TestRunError(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	err := childCommand(context.Background(), 3, WithArgs(true), WithServiceName("svc")).Run()
+	assert.Error(err)
+
+	spans := mt.FinishedSpans()
+	require.Len(t, spans, 1)
+	s := spans[0]
+	assert.Equal(3, s.Tag(tagExitCode))
+	assert.Equal(err, s.Tag(ext.Error))
+	assert.Equal("svc", s.Tag(ext.ServiceName))
+	assert.Contains(s.Tag(tagExec), "-test.run=none")
+}
+
+func TestStartWait(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	cmd := childCommand(context.Background(), 0, WithPropagation(false))
+	require.NoError(t, cmd.Start())
+	assert.Len(mt.FinishedSpans(), 0)
+	require.NoError(t, cmd.Wait())
+	assert.Len(mt.FinishedSpans(), 1)
+	assert.Contains(cmd.Env, "X_DATADOG_TAGS=_dd.p.stale=1")
+}
+
+func TestStartError(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	err := Command("/does/not/exist").Start()
+	assert.Error(t, err)
+	spans := mt.FinishedSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "exist", spans[0].Tag(ext.ResourceName))
+	assert.Nil(t, spans[0].Tag(tagExitCode))
+}
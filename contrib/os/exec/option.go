@@ -0,0 +1,43 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package exec
+
+type config struct {
+	serviceName string
+	withArgs    bool
+	propagation bool
+}
+
+// Option represents an option that can be passed to Command or CommandContext.
+type Option func(*config)
+
+func defaults(cfg *config) {
+	cfg.propagation = true
+}
+
+// WithServiceName sets the given service name for the command spans. It defaults
+// to the global service name.
+func WithServiceName(name string) Option {
+	return func(cfg *config) {
+		cfg.serviceName = name
+	}
+}
+
+// WithArgs specifies whether the command arguments should be included in the
+// "cmd.exec" tag. Arguments may contain sensitive data, so they are omitted by default.
+func WithArgs(enabled bool) Option {
+	return func(cfg *config) {
+		cfg.withArgs = enabled
+	}
+}
+
+// WithPropagation specifies whether the trace context should be injected into the
+// environment of the child process. It is enabled by default.
+func WithPropagation(enabled bool) Option {
+	return func(cfg *config) {
+		cfg.propagation = enabled
+	}
+}
@@ -0,0 +1,312 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+// Package amqp091 provides functions to trace the rabbitmq/amqp091-go package (https://github.com/rabbitmq/amqp091-go).
+package amqp091 // import "gopkg.in/DataDog/dd-trace-go.v1/contrib/rabbitmq/amqp091-go"
+
+import (
+	"context"
+	"math"
+	"net"
+	"strconv"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/datastreams"
+	"gopkg.in/DataDog/dd-trace-go.v1/datastreams/options"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/telemetry"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const componentName = "rabbitmq/amqp091-go"
+
+func init() {
+	telemetry.LoadIntegration(componentName)
+	tracer.MarkIntegrationImported("github.com/rabbitmq/amqp091-go")
+}
+
+// Dial calls amqp.Dial and wraps the resulting Connection.
+func Dial(url string, opts ...Option) (*Connection, error) {
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return nil, err
+	}
+	return wrapDialed(url, conn, opts...), nil
+}
+
+// DialConfig calls amqp.DialConfig and wraps the resulting Connection.
+func DialConfig(url string, config amqp.Config, opts ...Option) (*Connection, error) {
+	conn, err := amqp.DialConfig(url, config)
+	if err != nil {
+		return nil, err
+	}
+	return wrapDialed(url, conn, opts...), nil
+}
+
+// wrapDialed wraps conn, dialed to url, tagging spans with the broker address
+// of url rather than the resolved remote address.
+func wrapDialed(url string, conn *amqp.Connection, opts ...Option) *Connection {
+	wrapped := WrapConnection(conn, opts...)
+	if uri, err := amqp.ParseURI(url); err == nil {
+		wrapped.host, wrapped.port = uri.Host, uri.Port
+	}
+	return wrapped
+}
+
+// WrapConnection wraps an amqp.Connection so that the channels it opens are
+// traced.
+func WrapConnection(conn *amqp.Connection, opts ...Option) *Connection {
+	wrapped := &Connection{
+		Connection: conn,
+		cfg:        newConfig(opts...),
+	}
+	if addr := conn.RemoteAddr(); addr != nil {
+		if host, port, err := net.SplitHostPort(addr.String()); err == nil {
+			wrapped.host = host
+			wrapped.port, _ = strconv.Atoi(port)
+		}
+	}
+	log.Debug("contrib/rabbitmq/amqp091-go: Wrapping Connection: %#v", wrapped.cfg)
+	return wrapped
+}
+
+// A brokerConfig holds information about the broker for span tags.
+type brokerConfig struct {
+	host string
+	port int
+}
+
+// A Connection wraps an amqp.Connection.
+type Connection struct {
+	*amqp.Connection
+	brokerConfig
+	cfg *config
+}
+
+// Channel opens a unique, concurrent server channel, see amqp.Connection.Channel.
+// The messages published and consumed on the channel are traced.
+func (c *Connection) Channel() (*Channel, error) {
+	ch, err := c.Connection.Channel()
+	if err != nil {
+		return nil, err
+	}
+	return &Channel{
+		Channel:      ch,
+		brokerConfig: c.brokerConfig,
+		cfg:          c.cfg,
+	}, nil
+}
+
+// WrapChannel wraps an amqp.Channel so that the messages published and
+// consumed on it are traced. Channels opened by a Connection returned by Dial
+// or WrapConnection are already wrapped, and their spans are tagged with the
+// address of the broker.
+func WrapChannel(ch *amqp.Channel, opts ...Option) *Channel {
+	cfg := newConfig(opts...)
+	log.Debug("contrib/rabbitmq/amqp091-go: Wrapping Channel: %#v", cfg)
+	return &Channel{
+		Channel: ch,
+		cfg:     cfg,
+	}
+}
+
+// A Channel wraps an amqp.Channel.
+type Channel struct {
+	*amqp.Channel
+	brokerConfig
+	cfg *config
+}
+
+func (ch *Channel) peerTags() []tracer.StartSpanOption {
+	if ch.host == "" {
+		return nil
+	}
+	opts := []tracer.StartSpanOption{tracer.Tag(ext.NetworkDestinationName, ch.host)}
+	if ch.port != 0 {
+		opts = append(opts, tracer.Tag(ext.NetworkDestinationPort, ch.port))
+	}
+	return opts
+}
+
+// Publish publishes a message with a background context and traces the
+// request, see PublishWithContext.
+func (ch *Channel) Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	_, err := ch.PublishWithDeferredConfirmWithContext(context.Background(), exchange, key, mandatory, immediate, msg)
+	return err
+}
+
+// PublishWithContext calls amqp.Channel.PublishWithContext and traces the
+// request. The span context is injected into the headers of the message.
+func (ch *Channel) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	_, err := ch.PublishWithDeferredConfirmWithContext(ctx, exchange, key, mandatory, immediate, msg)
+	return err
+}
+
+// PublishWithDeferredConfirm calls amqp.Channel.PublishWithDeferredConfirmWithContext
+// with a background context, see PublishWithDeferredConfirmWithContext.
+func (ch *Channel) PublishWithDeferredConfirm(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) (*amqp.DeferredConfirmation, error) {
+	return ch.PublishWithDeferredConfirmWithContext(context.Background(), exchange, key, mandatory, immediate, msg)
+}
+
+// PublishWithDeferredConfirmWithContext calls
+// amqp.Channel.PublishWithDeferredConfirmWithContext and traces the request.
+// The span context is injected into the headers of the message.
+func (ch *Channel) PublishWithDeferredConfirmWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) (*amqp.DeferredConfirmation, error) {
+	opts := []tracer.StartSpanOption{
+		tracer.ServiceName(ch.cfg.producerServiceName),
+		tracer.ResourceName("Publish " + exchangeName(exchange)),
+		tracer.SpanType(ext.SpanTypeMessageProducer),
+		tracer.Tag(ext.MessagingRabbitMQExchange, exchange),
+		tracer.Tag(ext.MessagingRabbitMQRoutingKey, key),
+		tracer.Tag(ext.Component, componentName),
+		tracer.Tag(ext.SpanKind, ext.SpanKindProducer),
+		tracer.Tag(ext.MessagingSystem, ext.MessagingSystemRabbitMQ),
+	}
+	opts = append(opts, ch.peerTags()...)
+	if !math.IsNaN(ch.cfg.analyticsRate) {
+		opts = append(opts, tracer.Tag(ext.EventSampleRate, ch.cfg.analyticsRate))
+	}
+	span, ctx := tracer.StartSpanFromContext(ctx, ch.cfg.producerSpanName, opts...)
+	// copy the headers so that the table of the caller isn't modified
+	headers := make(amqp.Table, len(msg.Headers)+4)
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	msg.Headers = headers
+	carrier := headersCarrier(msg.Headers)
+	if err := tracer.Inject(span.Context(), carrier); err != nil {
+		log.Debug("contrib/rabbitmq/amqp091-go: Failed to inject span context into message headers, %v", err)
+	}
+	setProduceCheckpoint(ctx, ch.cfg.dataStreamsEnabled, exchange, key, &msg)
+	confirm, err := ch.Channel.PublishWithDeferredConfirmWithContext(ctx, exchange, key, mandatory, immediate, msg)
+	span.Finish(tracer.WithError(err))
+	return confirm, err
+}
+
+// Consume calls amqp.Channel.Consume and wraps the resulting delivery
+// channel, see ConsumeWithContext.
+func (ch *Channel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	return ch.ConsumeWithContext(context.Background(), queue, consumer, autoAck, exclusive, noLocal, noWait, args)
+}
+
+// ConsumeWithContext calls amqp.Channel.ConsumeWithContext and wraps the
+// resulting delivery channel so that each delivery is traced. The span of a
+// delivery is finished when the next delivery is received, or when the
+// channel is closed. Its context is injected into the headers of the
+// delivery, and can be retrieved with ExtractSpanContext.
+func (ch *Channel) ConsumeWithContext(ctx context.Context, queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	deliveries, err := ch.Channel.ConsumeWithContext(ctx, queue, consumer, autoAck, exclusive, noLocal, noWait, args)
+	if err != nil {
+		return deliveries, err
+	}
+	wrapped := make(chan amqp.Delivery)
+	go func() {
+		var prev ddtrace.Span
+		for d := range deliveries {
+			next := ch.startConsumeSpan(queue, &d)
+			wrapped <- d
+			// if the next delivery was received, finish the previous span
+			if prev != nil {
+				prev.Finish()
+			}
+			prev = next
+		}
+		// finish any remaining span
+		if prev != nil {
+			prev.Finish()
+		}
+		close(wrapped)
+	}()
+	return wrapped, nil
+}
+
+func (ch *Channel) startConsumeSpan(queue string, d *amqp.Delivery) ddtrace.Span {
+	opts := []tracer.StartSpanOption{
+		tracer.ServiceName(ch.cfg.consumerServiceName),
+		tracer.ResourceName("Consume " + queue),
+		tracer.SpanType(ext.SpanTypeMessageConsumer),
+		tracer.Tag(ext.MessagingRabbitMQQueue, queue),
+		tracer.Tag(ext.MessagingRabbitMQExchange, d.Exchange),
+		tracer.Tag(ext.MessagingRabbitMQRoutingKey, d.RoutingKey),
+		tracer.Tag("delivery_tag", d.DeliveryTag),
+		tracer.Tag("redelivered", d.Redelivered),
+		tracer.Tag(ext.Component, componentName),
+		tracer.Tag(ext.SpanKind, ext.SpanKindConsumer),
+		tracer.Tag(ext.MessagingSystem, ext.MessagingSystemRabbitMQ),
+		tracer.Measured(),
+	}
+	opts = append(opts, ch.peerTags()...)
+	if !math.IsNaN(ch.cfg.analyticsRate) {
+		opts = append(opts, tracer.Tag(ext.EventSampleRate, ch.cfg.analyticsRate))
+	}
+	if d.Headers == nil {
+		d.Headers = make(amqp.Table)
+	}
+	carrier := headersCarrier(d.Headers)
+	if spanctx, err := tracer.Extract(carrier); err == nil {
+		opts = append(opts, tracer.ChildOf(spanctx))
+	}
+	span := tracer.StartSpan(ch.cfg.consumerSpanName, opts...)
+	// reinject the span context so consumers can pick it up
+	if err := tracer.Inject(span.Context(), carrier); err != nil {
+		log.Debug("contrib/rabbitmq/amqp091-go: Failed to inject span context into delivery headers, %v", err)
+	}
+	setConsumeCheckpoint(ch.cfg.dataStreamsEnabled, queue, d)
+	return span
+}
+
+// exchangeName returns the name of the exchange for resource names, where the
+// default exchange has an empty name.
+func exchangeName(exchange string) string {
+	if exchange == "" {
+		return "(default)"
+	}
+	return exchange
+}
+
+func setProduceCheckpoint(ctx context.Context, enabled bool, exchange, key string, msg *amqp.Publishing) {
+	if !enabled {
+		return
+	}
+	edges := []string{"direction:out", "exchange:" + exchange, "routing_key:" + key, "type:rabbitmq"}
+	carrier := headersCarrier(msg.Headers)
+	ctx, ok := tracer.SetDataStreamsCheckpointWithParams(datastreams.ExtractFromBase64Carrier(ctx, carrier), options.CheckpointParams{PayloadSize: getPublishingSize(msg)}, edges...)
+	if !ok {
+		return
+	}
+	datastreams.InjectToBase64Carrier(ctx, carrier)
+}
+
+func setConsumeCheckpoint(enabled bool, queue string, d *amqp.Delivery) {
+	if !enabled {
+		return
+	}
+	edges := []string{"direction:in", "topic:" + queue, "type:rabbitmq"}
+	carrier := headersCarrier(d.Headers)
+	ctx, ok := tracer.SetDataStreamsCheckpointWithParams(datastreams.ExtractFromBase64Carrier(context.Background(), carrier), options.CheckpointParams{PayloadSize: getDeliverySize(d)}, edges...)
+	if !ok {
+		return
+	}
+	datastreams.InjectToBase64Carrier(ctx, carrier)
+}
+
+func getPublishingSize(msg *amqp.Publishing) int64 {
+	return int64(len(msg.Body)) + getHeadersSize(msg.Headers)
+}
+
+func getDeliverySize(d *amqp.Delivery) int64 {
+	return int64(len(d.Body)) + getHeadersSize(d.Headers)
+}
+
+func getHeadersSize(headers amqp.Table) (size int64) {
+	headersCarrier(headers).ForeachKey(func(key, val string) error {
+		size += int64(len(key) + len(val))
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,50 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package amqp091
+
+import (
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// A headersCarrier implements TextMapReader/TextMapWriter for extracting/injecting traces on amqp.Table headers.
+type headersCarrier amqp.Table
+
+var _ interface {
+	tracer.TextMapReader
+	tracer.TextMapWriter
+} = (headersCarrier)(nil)
+
+// ForeachKey conforms to the TextMapReader interface.
+func (c headersCarrier) ForeachKey(handler func(key, val string) error) error {
+	for k, v := range c {
+		var s string
+		switch v := v.(type) {
+		case string:
+			s = v
+		case []byte:
+			s = string(v)
+		default:
+			continue
+		}
+		if err := handler(k, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Set implements TextMapWriter
+func (c headersCarrier) Set(key, val string) {
+	c[key] = val
+}
+
+// ExtractSpanContext retrieves the SpanContext from the headers of an amqp.Delivery.
+func ExtractSpanContext(d amqp.Delivery) (ddtrace.SpanContext, error) {
+	return tracer.Extract(headersCarrier(d.Headers))
+}
@@ -10,6 +10,8 @@ import (
 	"math"
 	"strings"
 
+	"gopkg.in/DataDog/dd-trace-go.v1/datastreams"
+	"gopkg.in/DataDog/dd-trace-go.v1/datastreams/options"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
@@ -46,6 +48,7 @@ func WrapReader(c *kafka.Reader, opts ...Option) *Reader {
 	if c.Config().Brokers != nil {
 		wrapped.bootstrapServers = strings.Join(c.Config().Brokers, ",")
 	}
+	wrapped.groupID = c.Config().GroupID
 	log.Debug("contrib/segmentio/kafka-go.v0/kafka: Wrapping Reader: %#v", wrapped.cfg)
 	return wrapped
 }
@@ -53,6 +56,7 @@ func WrapReader(c *kafka.Reader, opts ...Option) *Reader {
 // A kafkaConfig struct holds information from the kafka config for span tags
 type kafkaConfig struct {
 	bootstrapServers string
+	groupID          string
 }
 
 // A Reader wraps a kafka.Reader.
@@ -115,6 +119,10 @@ func (r *Reader) ReadMessage(ctx context.Context) (kafka.Message, error) {
 		return kafka.Message{}, err
 	}
 	r.prev = r.startSpan(ctx, &msg)
+	setConsumeCheckpoint(r.cfg.dataStreamsEnabled, r.groupID, &msg)
+	// when a consumer group is set, ReadMessage commits the offset of the
+	// message automatically.
+	commitOffsets(r.cfg.dataStreamsEnabled, r.groupID, msg)
 	return msg, nil
 }
 
@@ -129,10 +137,53 @@ func (r *Reader) FetchMessage(ctx context.Context) (kafka.Message, error) {
 		return msg, err
 	}
 	r.prev = r.startSpan(ctx, &msg)
+	setConsumeCheckpoint(r.cfg.dataStreamsEnabled, r.groupID, &msg)
 	return msg, nil
 }
 
-// WrapWriter wraps a kafka.Writer so requests are traced.
+// CommitMessages commits the list of messages passed as argument and tracks
+// the commit offsets if data streams is enabled.
+func (r *Reader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	err := r.Reader.CommitMessages(ctx, msgs...)
+	if err != nil {
+		return err
+	}
+	commitOffsets(r.cfg.dataStreamsEnabled, r.groupID, msgs...)
+	return nil
+}
+
+func commitOffsets(dataStreamsEnabled bool, groupID string, msgs ...kafka.Message) {
+	if !dataStreamsEnabled || groupID == "" {
+		return
+	}
+	for _, msg := range msgs {
+		// the committed offset is the one of the next message to consume
+		tracer.TrackKafkaCommitOffset(groupID, msg.Topic, int32(msg.Partition), msg.Offset+1)
+		if msg.HighWaterMark > 0 {
+			tracer.TrackKafkaHighWatermarkOffset(msg.Topic, int32(msg.Partition), msg.HighWaterMark)
+		}
+	}
+}
+
+func setConsumeCheckpoint(dataStreamsEnabled bool, groupID string, msg *kafka.Message) {
+	if !dataStreamsEnabled || msg == nil {
+		return
+	}
+	edges := []string{"direction:in", "topic:" + msg.Topic, "type:kafka"}
+	if groupID != "" {
+		edges = append(edges, "group:"+groupID)
+	}
+	carrier := messageCarrier{msg}
+	ctx, ok := tracer.SetDataStreamsCheckpointWithParams(datastreams.ExtractFromBase64Carrier(context.Background(), carrier), options.CheckpointParams{PayloadSize: getMsgSize(msg)}, edges...)
+	if !ok {
+		return
+	}
+	datastreams.InjectToBase64Carrier(ctx, carrier)
+}
+
+// WrapWriter wraps a kafka.Writer so requests are traced. If data streams is
+// enabled, the Completion function of w is wrapped to track the offsets of
+// the messages written, which are only known once they are.
 func WrapWriter(w *kafka.Writer, opts ...Option) *Writer {
 	writer := &Writer{
 		Writer: w,
@@ -142,6 +193,9 @@ func WrapWriter(w *kafka.Writer, opts ...Option) *Writer {
 	if w.Addr.String() != "" {
 		writer.bootstrapServers = w.Addr.String()
 	}
+	if writer.cfg.dataStreamsEnabled {
+		w.Completion = trackProduceOffsets(w.Completion)
+	}
 	log.Debug("contrib/segmentio/kafka.go.v0: Wrapping Writer: %#v", writer.cfg)
 	return writer
 }
@@ -162,11 +216,7 @@ func (w *Writer) startSpan(ctx context.Context, msg *kafka.Message) ddtrace.Span
 		tracer.Tag(ext.MessagingSystem, ext.MessagingSystemKafka),
 		tracer.Tag(ext.KafkaBootstrapServers, w.bootstrapServers),
 	}
-	if w.Writer.Topic != "" {
-		opts = append(opts, tracer.ResourceName("Produce Topic "+w.Writer.Topic))
-	} else {
-		opts = append(opts, tracer.ResourceName("Produce Topic "+msg.Topic))
-	}
+	opts = append(opts, tracer.ResourceName("Produce Topic "+w.topic(msg)))
 	if !math.IsNaN(w.cfg.analyticsRate) {
 		opts = append(opts, tracer.Tag(ext.EventSampleRate, w.cfg.analyticsRate))
 	}
@@ -191,6 +241,7 @@ func (w *Writer) WriteMessages(ctx context.Context, msgs ...kafka.Message) error
 	spans := make([]ddtrace.Span, len(msgs))
 	for i := range msgs {
 		spans[i] = w.startSpan(ctx, &msgs[i])
+		setProduceCheckpoint(w.cfg.dataStreamsEnabled, w.topic(&msgs[i]), &msgs[i])
 	}
 	err := w.Writer.WriteMessages(ctx, msgs...)
 	for i, span := range spans {
@@ -198,3 +249,48 @@ func (w *Writer) WriteMessages(ctx context.Context, msgs ...kafka.Message) error
 	}
 	return err
 }
+
+// trackProduceOffsets returns a kafka.Writer Completion function tracking the
+// offsets of the messages written, and then calling completion if any. The
+// messages it is called with have their partition and offset set, and were
+// all written to the same partition, so only the last offset is tracked.
+func trackProduceOffsets(completion func([]kafka.Message, error)) func([]kafka.Message, error) {
+	return func(msgs []kafka.Message, err error) {
+		if err == nil && len(msgs) > 0 {
+			last := msgs[len(msgs)-1]
+			tracer.TrackKafkaProduceOffset(last.Topic, int32(last.Partition), last.Offset)
+		}
+		if completion != nil {
+			completion(msgs, err)
+		}
+	}
+}
+
+// topic returns the topic msg is written to, which is either set on the
+// writer or on each message.
+func (w *Writer) topic(msg *kafka.Message) string {
+	if w.Writer.Topic != "" {
+		return w.Writer.Topic
+	}
+	return msg.Topic
+}
+
+func setProduceCheckpoint(dataStreamsEnabled bool, topic string, msg *kafka.Message) {
+	if !dataStreamsEnabled || msg == nil {
+		return
+	}
+	edges := []string{"direction:out", "topic:" + topic, "type:kafka"}
+	carrier := messageCarrier{msg}
+	ctx, ok := tracer.SetDataStreamsCheckpointWithParams(datastreams.ExtractFromBase64Carrier(context.Background(), carrier), options.CheckpointParams{PayloadSize: getMsgSize(msg)}, edges...)
+	if !ok {
+		return
+	}
+	datastreams.InjectToBase64Carrier(ctx, carrier)
+}
+
+func getMsgSize(msg *kafka.Message) (size int64) {
+	for _, header := range msg.Headers {
+		size += int64(len(header.Key) + len(header.Value))
+	}
+	return size + int64(len(msg.Value)+len(msg.Key))
+}
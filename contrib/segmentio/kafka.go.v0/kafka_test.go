@@ -7,13 +7,18 @@ package kafka
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/contrib/internal/namingschematest"
+	"gopkg.in/DataDog/dd-trace-go.v1/datastreams"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 
 	kafka "github.com/segmentio/kafka-go"
 	"github.com/stretchr/testify/assert"
@@ -82,25 +87,49 @@ func genIntegrationTestSpans(t *testing.T, writerOp func(t *testing.T, w *Writer
 }
 
 func TestReadMessageFunctional(t *testing.T) {
+	var (
+		writtenMsgs []kafka.Message
+		readMsg     kafka.Message
+	)
 	spans := genIntegrationTestSpans(
 		t,
 		func(t *testing.T, w *Writer) {
-			err := w.WriteMessages(context.Background(), testMessages...)
+			writtenMsgs = append([]kafka.Message(nil), testMessages...)
+			err := w.WriteMessages(context.Background(), writtenMsgs...)
 			require.NoError(t, err, "Expected to write message to topic")
 		},
 		func(t *testing.T, r *Reader) {
 			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 			defer cancel()
-			readMsg, err := r.ReadMessage(ctx)
+			var err error
+			readMsg, err = r.ReadMessage(ctx)
 			require.NoError(t, err, "Expected to consume message")
 			assert.Equal(t, testMessages[0].Value, readMsg.Value, "Values should be equal")
 
 			err = r.CommitMessages(context.Background(), readMsg)
 			assert.NoError(t, err, "Expected CommitMessages to not return an error")
 		},
-		[]Option{WithAnalyticsRate(0.1)},
-		[]Option{},
+		[]Option{WithAnalyticsRate(0.1), WithDataStreams()},
+		[]Option{WithDataStreams()},
+	)
+
+	assert.Len(t, writtenMsgs, len(testMessages))
+	p, ok := datastreams.PathwayFromContext(datastreams.ExtractFromBase64Carrier(context.Background(), messageCarrier{&writtenMsgs[0]}))
+	assert.True(t, ok)
+	expectedCtx, _ := tracer.SetDataStreamsCheckpoint(context.Background(), "direction:out", "topic:"+testTopic, "type:kafka")
+	expected, _ := datastreams.PathwayFromContext(expectedCtx)
+	assert.NotEqual(t, expected.GetHash(), 0)
+	assert.Equal(t, expected.GetHash(), p.GetHash())
+
+	p, ok = datastreams.PathwayFromContext(datastreams.ExtractFromBase64Carrier(context.Background(), messageCarrier{&readMsg}))
+	assert.True(t, ok)
+	expectedCtx, _ = tracer.SetDataStreamsCheckpoint(
+		datastreams.ExtractFromBase64Carrier(context.Background(), messageCarrier{&writtenMsgs[0]}),
+		"direction:in", "topic:"+testTopic, "type:kafka", "group:"+testGroupID,
 	)
+	expected, _ = datastreams.PathwayFromContext(expectedCtx)
+	assert.NotEqual(t, expected.GetHash(), 0)
+	assert.Equal(t, expected.GetHash(), p.GetHash())
 
 	// producer span
 	s0 := spans[0]
@@ -206,6 +235,64 @@ func TestNamingSchema(t *testing.T) {
 	namingschematest.NewKafkaTest(genSpans)(t)
 }
 
+func TestDataStreamsCheckpoints(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	msg := kafka.Message{Key: []byte("key1"), Value: []byte("value1")}
+	setProduceCheckpoint(false, testTopic, &msg)
+	assert.Empty(t, msg.Headers, "data streams disabled")
+
+	setProduceCheckpoint(true, testTopic, &msg)
+	produced, ok := datastreams.PathwayFromContext(datastreams.ExtractFromBase64Carrier(context.Background(), messageCarrier{&msg}))
+	require.True(t, ok)
+	expectedCtx, _ := tracer.SetDataStreamsCheckpoint(context.Background(), "direction:out", "topic:"+testTopic, "type:kafka")
+	expected, _ := datastreams.PathwayFromContext(expectedCtx)
+	assert.Equal(t, expected.GetHash(), produced.GetHash())
+
+	msg.Topic = testTopic
+	setConsumeCheckpoint(true, testGroupID, &msg)
+	consumed, ok := datastreams.PathwayFromContext(datastreams.ExtractFromBase64Carrier(context.Background(), messageCarrier{&msg}))
+	require.True(t, ok)
+	expectedCtx, _ = tracer.SetDataStreamsCheckpoint(expectedCtx, "direction:in", "topic:"+testTopic, "type:kafka", "group:"+testGroupID)
+	expected, _ = datastreams.PathwayFromContext(expectedCtx)
+	assert.Equal(t, expected.GetHash(), consumed.GetHash())
+	assert.Len(t, msg.Headers, 1, "the pathway header is replaced")
+}
+
+func TestDataStreamsProduceOffsets(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	var completed []kafka.Message
+	kw := &kafka.Writer{
+		Addr:  kafka.TCP("localhost:9092"),
+		Topic: testTopic,
+		Completion: func(msgs []kafka.Message, _ error) {
+			completed = append(completed, msgs...)
+		},
+	}
+	WrapWriter(kw, WithDataStreams())
+	// the writer calls Completion with the messages written to a partition,
+	// once their offsets are known
+	kw.Completion([]kafka.Message{
+		{Topic: testTopic, Partition: 1, Offset: 41},
+		{Topic: testTopic, Partition: 1, Offset: 42},
+	}, nil)
+	kw.Completion([]kafka.Message{{Topic: testTopic, Partition: 2, Offset: 7}}, errors.New("not written"))
+	assert.Len(t, completed, 3, "the wrapped Completion is called")
+
+	var backlogs []string
+	for _, p := range mocktracer.DataStreamsPayloads(mt) {
+		for _, bucket := range p.Stats {
+			for _, b := range bucket.Backlogs {
+				backlogs = append(backlogs, fmt.Sprintf("%s %d", strings.Join(b.Tags, ","), b.Value))
+			}
+		}
+	}
+	assert.Equal(t, []string{"partition:1,topic:" + testTopic + ",type:kafka_produce 42"}, backlogs)
+}
+
 func BenchmarkReaderStartSpan(b *testing.B) {
 	r := NewReader(kafka.ReaderConfig{
 		Brokers: []string{"localhost:9092", "localhost:9093", "localhost:9094"},
@@ -20,6 +20,7 @@ type config struct {
 	consumerSpanName    string
 	producerSpanName    string
 	analyticsRate       float64
+	dataStreamsEnabled  bool
 }
 
 // An Option customizes the config.
@@ -42,6 +43,8 @@ func newConfig(opts ...Option) *config {
 	cfg.consumerSpanName = namingschema.NewKafkaInboundOp().GetName()
 	cfg.producerSpanName = namingschema.NewKafkaOutboundOp().GetName()
 
+	cfg.dataStreamsEnabled = internal.BoolEnv("DD_DATA_STREAMS_ENABLED", false)
+
 	for _, opt := range opts {
 		opt(cfg)
 	}
@@ -78,3 +81,10 @@ func WithAnalyticsRate(rate float64) Option {
 		}
 	}
 }
+
+// WithDataStreams enables the Data Streams monitoring product features: https://www.datadoghq.com/product/data-streams-monitoring/
+func WithDataStreams() Option {
+	return func(cfg *config) {
+		cfg.dataStreamsEnabled = true
+	}
+}
@@ -0,0 +1,70 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-present Datadog, Inc.
+
+package datastreams
+
+import (
+	"context"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// SetProduceCheckpoint sets a produce checkpoint on the pathway of ctx, for a
+// message sent to the target (e.g. a topic, queue or stream) of a transport
+// of the given type (e.g. "kafka", "redis"), and injects the resulting pathway
+// into the carrier of the message. It returns the context with the resulting
+// pathway, or ctx if data streams monitoring is not enabled.
+// To learn more about the data streams product, see: https://docs.datadoghq.com/data_streams/go/
+func SetProduceCheckpoint(ctx context.Context, queueType, target string, carrier TextMapWriter) context.Context {
+	ctx, ok := tracer.SetDataStreamsCheckpoint(ctx, "direction:out", "topic:"+target, "type:"+queueType)
+	if ok {
+		InjectToBase64Carrier(ctx, carrier)
+	}
+	return ctx
+}
+
+// SetConsumeCheckpoint extracts the pathway of a message received from the
+// target (e.g. a topic, queue or stream) of a transport of the given type
+// (e.g. "kafka", "redis") from its carrier, and sets a consume checkpoint on
+// it. It returns the context with the resulting pathway, which should be used
+// when producing messages while processing this one, or ctx if data streams
+// monitoring is not enabled.
+// To learn more about the data streams product, see: https://docs.datadoghq.com/data_streams/go/
+func SetConsumeCheckpoint(ctx context.Context, queueType, target string, carrier TextMapReader) context.Context {
+	outCtx, ok := tracer.SetDataStreamsCheckpoint(ExtractFromBase64Carrier(ctx, carrier), "direction:in", "topic:"+target, "type:"+queueType)
+	if !ok {
+		return ctx
+	}
+	return outCtx
+}
+
+// TrackProduceOffset should be used in the producer, to track the offset of a
+// message sent to a partition of a queue of the given type (e.g. "redis").
+// Queues without partitions should use partition 0. If used together with
+// TrackConsumeOffset, it generates a consumer lag metric.
+func TrackProduceOffset(queueType, queue string, partition int32, offset int64) {
+	tracer.TrackDataStreamsProduceOffset(queueType, queue, partition, offset)
+}
+
+// TrackConsumeOffset should be used in the consumer, to track the offset it
+// acknowledged on a partition of a queue of the given type (e.g. "redis"). As
+// with Kafka commits, it is the offset of the next message to consume, i.e.
+// the offset of the last acknowledged message plus one.
+// Queues without partitions should use partition 0. If used together with
+// TrackProduceOffset, it generates a consumer lag metric.
+func TrackConsumeOffset(queueType, queue string, partition int32, offset int64) {
+	tracer.TrackDataStreamsConsumeOffset(queueType, "", queue, partition, offset)
+}
+
+// TrackTransaction records that the transaction with the given user-defined
+// ID, e.g. an order ID, reached the named checkpoint, on the pathway of ctx if
+// any. Services tracking the same transaction ID at different checkpoints
+// allow the end-to-end latency of the transaction to be computed, even when it
+// goes through systems which can't be instrumented, like batch files or SFTP
+// transfers. The checkpoints are handed to the sinks set with
+// tracer.WithDataStreamsSink, they are not sent to the agent.
+func TrackTransaction(ctx context.Context, checkpointName, transactionID string) {
+	tracer.TrackDataStreamsTransaction(ctx, checkpointName, transactionID)
+}
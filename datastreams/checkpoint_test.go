@@ -0,0 +1,44 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-present Datadog, Inc.
+
+package datastreams
+
+import (
+	"context"
+	"testing"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/datastreams"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckpoints(t *testing.T) {
+	c := make(carrier)
+	ctx := SetProduceCheckpoint(context.Background(), "redis", "stream1", c)
+	assert.Empty(t, c, "data streams disabled")
+	_, ok := datastreams.PathwayFromContext(ctx)
+	assert.False(t, ok)
+
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	ctx = SetProduceCheckpoint(context.Background(), "redis", "stream1", c)
+	produced, ok := datastreams.PathwayFromContext(ctx)
+	require.True(t, ok)
+	expectedCtx, _ := tracer.SetDataStreamsCheckpoint(context.Background(), "direction:out", "topic:stream1", "type:redis")
+	expected, _ := datastreams.PathwayFromContext(expectedCtx)
+	assert.Equal(t, expected.GetHash(), produced.GetHash())
+	injected, _ := datastreams.PathwayFromContext(ExtractFromBase64Carrier(context.Background(), c))
+	assert.Equal(t, produced.GetHash(), injected.GetHash())
+
+	consumed, ok := datastreams.PathwayFromContext(SetConsumeCheckpoint(context.Background(), "redis", "stream1", c))
+	require.True(t, ok)
+	expectedCtx, _ = tracer.SetDataStreamsCheckpoint(expectedCtx, "direction:in", "topic:stream1", "type:redis")
+	expected, _ = datastreams.PathwayFromContext(expectedCtx)
+	assert.Equal(t, expected.GetHash(), consumed.GetHash())
+}
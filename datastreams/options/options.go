@@ -7,4 +7,19 @@ package options
 
 type CheckpointParams struct {
 	PayloadSize int64
+	// Schema is the schema of the payload, if known. The checkpoint is tagged
+	// with the ID of the schema, and its definition is periodically reported,
+	// so that schema changes can be detected. See datastreams.NewAvroSchema,
+	// datastreams.NewProtobufSchema and datastreams.NewJSONSchema.
+	Schema *Schema
+}
+
+// Schema describes the schema of the payload of a checkpoint.
+type Schema struct {
+	// Type is the type of the schema, e.g. "avro", "protobuf" or "json".
+	Type string
+	// ID is a stable fingerprint of the definition of the schema.
+	ID string
+	// Definition is the normalized definition of the schema.
+	Definition string
 }
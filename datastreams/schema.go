@@ -0,0 +1,145 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-present Datadog, Inc.
+
+package datastreams
+
+import (
+	"bytes"
+	"encoding/json"
+	"hash/fnv"
+	"strconv"
+	"strings"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/datastreams/options"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	// SchemaTypeAvro is the type of Avro schemas.
+	SchemaTypeAvro = "avro"
+	// SchemaTypeProtobuf is the type of Protocol Buffers schemas.
+	SchemaTypeProtobuf = "protobuf"
+	// SchemaTypeJSON is the type of JSON schemas.
+	SchemaTypeJSON = "json"
+)
+
+// NewAvroSchema returns the schema of Avro payloads with the given schema
+// definition, to be set in options.CheckpointParams. Definitions only
+// differing by whitespace or by the order of their attributes have the same
+// ID.
+func NewAvroSchema(definition string) (options.Schema, error) {
+	return newJSONDefinedSchema(SchemaTypeAvro, definition)
+}
+
+// NewJSONSchema returns the schema of JSON payloads with the given JSON schema
+// definition, to be set in options.CheckpointParams. Definitions only
+// differing by whitespace or by the order of their attributes have the same
+// ID.
+func NewJSONSchema(definition string) (options.Schema, error) {
+	return newJSONDefinedSchema(SchemaTypeJSON, definition)
+}
+
+// NewProtobufSchema returns the schema of Protocol Buffers payloads of the
+// given message type, to be set in options.CheckpointParams. The definition
+// describes the fields of the message and of the messages and enums it
+// depends on, by full name, and its ID only changes when one of them does.
+// For example:
+//
+//	schema := datastreams.NewProtobufSchema((&pb.Order{}).ProtoReflect().Descriptor())
+func NewProtobufSchema(md protoreflect.MessageDescriptor) options.Schema {
+	defs := make(map[string]interface{})
+	addProtobufMessage(defs, md)
+	definition, _ := json.Marshal(protobufDefinition{
+		Message:     string(md.FullName()),
+		Definitions: defs, // the keys of maps are sorted
+	})
+	return newSchema(SchemaTypeProtobuf, string(definition))
+}
+
+// newJSONDefinedSchema returns the schema of the given type defined in JSON,
+// normalized so that its ID doesn't depend on its formatting.
+func newJSONDefinedSchema(typ, definition string) (options.Schema, error) {
+	dec := json.NewDecoder(strings.NewReader(definition))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return options.Schema{}, err
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil { // the keys of objects are sorted
+		return options.Schema{}, err
+	}
+	return newSchema(typ, strings.TrimSuffix(buf.String(), "\n")), nil
+}
+
+func newSchema(typ, definition string) options.Schema {
+	h := fnv.New64a()
+	h.Write([]byte(typ))
+	h.Write([]byte(definition))
+	return options.Schema{
+		Type:       typ,
+		ID:         strconv.FormatUint(h.Sum64(), 10),
+		Definition: definition,
+	}
+}
+
+type protobufDefinition struct {
+	Message     string                 `json:"message"`
+	Definitions map[string]interface{} `json:"definitions"`
+}
+
+type protobufField struct {
+	Name        string `json:"name"`
+	Number      int32  `json:"number"`
+	Kind        string `json:"kind"`
+	Cardinality string `json:"cardinality"`
+	Type        string `json:"type,omitempty"`
+}
+
+// addProtobufMessage adds the definitions of md, and of the messages and enums
+// its fields depend on, to defs, by full name.
+func addProtobufMessage(defs map[string]interface{}, md protoreflect.MessageDescriptor) {
+	name := string(md.FullName())
+	if _, ok := defs[name]; ok {
+		return
+	}
+	fields := make([]protobufField, 0, md.Fields().Len())
+	defs[name] = fields // set before recursing, messages can be recursive
+	for i := 0; i < md.Fields().Len(); i++ {
+		fd := md.Fields().Get(i)
+		f := protobufField{
+			Name:        string(fd.Name()),
+			Number:      int32(fd.Number()),
+			Kind:        fd.Kind().String(),
+			Cardinality: fd.Cardinality().String(),
+		}
+		if fd.IsMap() {
+			f.Kind = "map"
+		}
+		switch {
+		case fd.Message() != nil:
+			f.Type = string(fd.Message().FullName())
+			addProtobufMessage(defs, fd.Message())
+		case fd.Enum() != nil:
+			f.Type = string(fd.Enum().FullName())
+			addProtobufEnum(defs, fd.Enum())
+		}
+		fields = append(fields, f)
+	}
+	defs[name] = fields
+}
+
+// addProtobufEnum adds the definition of ed, its values by name, to defs.
+func addProtobufEnum(defs map[string]interface{}, ed protoreflect.EnumDescriptor) {
+	values := make(map[string]int32, ed.Values().Len())
+	for i := 0; i < ed.Values().Len(); i++ {
+		v := ed.Values().Get(i)
+		values[string(v.Name())] = int32(v.Number())
+	}
+	defs[string(ed.FullName())] = values
+}
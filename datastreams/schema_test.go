@@ -0,0 +1,72 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-present Datadog, Inc.
+
+package datastreams
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestSchema(t *testing.T) {
+	t.Run("avro", func(t *testing.T) {
+		s1, err := NewAvroSchema(`{"type": "record", "name": "Order", "fields": [{"name": "id", "type": "long"}]}`)
+		require.NoError(t, err)
+		assert.Equal(t, SchemaTypeAvro, s1.Type)
+		assert.Equal(t, `{"fields":[{"name":"id","type":"long"}],"name":"Order","type":"record"}`, s1.Definition)
+
+		s2, err := NewAvroSchema(`{
+			"name": "Order",
+			"type": "record",
+			"fields": [{"type": "long", "name": "id"}]
+		}`)
+		require.NoError(t, err)
+		assert.Equal(t, s1, s2, "formatting doesn't change the schema")
+
+		s3, err := NewAvroSchema(`{"type": "record", "name": "Order", "fields": [{"name": "id", "type": "string"}]}`)
+		require.NoError(t, err)
+		assert.NotEqual(t, s1.ID, s3.ID)
+
+		_, err = NewAvroSchema(`{"type":`)
+		assert.Error(t, err)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		s, err := NewJSONSchema(`{"type": "object", "properties": {"id": {"type": "integer", "maximum": 9007199254740993}}}`)
+		require.NoError(t, err)
+		assert.Equal(t, SchemaTypeJSON, s.Type)
+		assert.Equal(t, `{"properties":{"id":{"maximum":9007199254740993,"type":"integer"}},"type":"object"}`, s.Definition)
+
+		avro, err := NewAvroSchema(`{"type": "object", "properties": {"id": {"type": "integer", "maximum": 9007199254740993}}}`)
+		require.NoError(t, err)
+		assert.NotEqual(t, s.ID, avro.ID, "the type is part of the fingerprint")
+	})
+
+	t.Run("protobuf", func(t *testing.T) {
+		s := NewProtobufSchema((&timestamppb.Timestamp{}).ProtoReflect().Descriptor())
+		assert.Equal(t, SchemaTypeProtobuf, s.Type)
+		assert.Equal(t, `{"message":"google.protobuf.Timestamp","definitions":{"google.protobuf.Timestamp":[{"name":"seconds","number":1,"kind":"int64","cardinality":"optional"},{"name":"nanos","number":2,"kind":"int32","cardinality":"optional"}]}}`, s.Definition)
+		assert.Equal(t, s, NewProtobufSchema((&timestamppb.Timestamp{}).ProtoReflect().Descriptor()))
+
+		// Value, Struct and ListValue are mutually recursive
+		s = NewProtobufSchema((&structpb.Value{}).ProtoReflect().Descriptor())
+		var def struct {
+			Definitions map[string]json.RawMessage
+		}
+		require.NoError(t, json.Unmarshal([]byte(s.Definition), &def))
+		defs := def.Definitions
+		assert.Contains(t, defs, "google.protobuf.Value")
+		assert.Contains(t, defs, "google.protobuf.Struct")
+		assert.Contains(t, defs, "google.protobuf.Struct.FieldsEntry")
+		assert.Contains(t, defs, "google.protobuf.ListValue")
+		assert.JSONEq(t, `{"NULL_VALUE":0}`, string(defs["google.protobuf.NullValue"]))
+		assert.NotEqual(t, s.ID, NewProtobufSchema((&structpb.Struct{}).ProtoReflect().Descriptor()).ID)
+	})
+}
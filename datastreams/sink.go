@@ -0,0 +1,41 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-present Datadog, Inc.
+
+package datastreams
+
+import (
+	"io"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/datastreams"
+)
+
+type (
+	// StatsPayload holds the stats computed from the checkpoints during a
+	// flush interval, as sent to a Sink.
+	StatsPayload = datastreams.StatsPayload
+	// StatsBucket holds the stats computed from the checkpoints during a
+	// period of time.
+	StatsBucket = datastreams.StatsBucket
+	// StatsPoint holds the stats of the checkpoints of a pathway, with the
+	// same edge tags, during a period of time.
+	StatsPoint = datastreams.StatsPoint
+
+	// A Sink receives the stats payloads flushed by the tracer, see
+	// tracer.WithDataStreamsSink.
+	Sink = datastreams.Sink
+	// MemorySink is a Sink keeping the payloads in memory.
+	MemorySink = datastreams.MemorySink
+)
+
+// NewMemorySink returns a Sink keeping the payloads in memory, e.g. for tests.
+func NewMemorySink() *MemorySink {
+	return datastreams.NewMemorySink()
+}
+
+// NewJSONLinesSink returns a Sink writing each payload to w as a line of
+// JSON, e.g. to a file for offline analysis.
+func NewJSONLinesSink(w io.Writer) Sink {
+	return datastreams.NewJSONLinesSink(w)
+}
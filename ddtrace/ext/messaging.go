@@ -12,14 +12,53 @@ const (
 
 // Available values for messaging.system.
 const (
-	MessagingSystemGCPPubsub = "googlepubsub"
-	MessagingSystemKafka     = "kafka"
+	MessagingSystemGCPCloudTasks = "googlecloudtasks"
+	MessagingSystemGCPPubsub     = "googlepubsub"
+	MessagingSystemKafka         = "kafka"
+	MessagingSystemNATS          = "nats"
+	MessagingSystemRabbitMQ      = "rabbitmq"
+)
+
+// Batch tags.
+const (
+	// MessagingBatchMessageCount defines the number of messages processed by a batch span.
+	MessagingBatchMessageCount = "messaging.batch.message_count"
+	// MessagingBatchUpstream holds the span contexts of the messages processed by a batch span,
+	// as a comma separated list of <trace ID>:<span ID>. The list is capped by the integrations.
+	MessagingBatchUpstream = "messaging.batch.upstream"
+	// MessagingBatchUpstreamDropped defines the number of span contexts left out of
+	// MessagingBatchUpstream once its cap was reached.
+	MessagingBatchUpstreamDropped = "messaging.batch.upstream_dropped"
 )
 
 // Kafka tags.
 const (
 	// MessagingKafkaPartition defines the Kafka partition the trace is associated with.
 	MessagingKafkaPartition = "messaging.kafka.partition"
+	// MessagingKafkaTopic defines the Kafka topic the trace is associated with.
+	MessagingKafkaTopic = "messaging.kafka.topic"
 	// KafkaBootstrapServers holds a comma separated list of bootstrap servers as defined in producer or consumer config.
 	KafkaBootstrapServers = "messaging.kafka.bootstrap.servers"
 )
+
+// RabbitMQ tags.
+const (
+	// MessagingRabbitMQExchange defines the exchange a RabbitMQ message is published to.
+	MessagingRabbitMQExchange = "messaging.rabbitmq.exchange"
+	// MessagingRabbitMQRoutingKey defines the routing key of a RabbitMQ message.
+	MessagingRabbitMQRoutingKey = "messaging.rabbitmq.routing_key"
+	// MessagingRabbitMQQueue defines the queue a RabbitMQ message is consumed from.
+	MessagingRabbitMQQueue = "messaging.rabbitmq.queue"
+)
+
+// NATS tags.
+const (
+	// MessagingNATSSubject defines the subject of a NATS message.
+	MessagingNATSSubject = "messaging.nats.subject"
+	// MessagingNATSStream defines the JetStream stream a NATS message is stored in.
+	MessagingNATSStream = "messaging.nats.stream"
+	// MessagingNATSConsumer defines the JetStream consumer a NATS message is delivered to.
+	MessagingNATSConsumer = "messaging.nats.consumer"
+	// MessagingNATSSequence defines the sequence number of a NATS message in its JetStream stream.
+	MessagingNATSSequence = "messaging.nats.sequence"
+)
@@ -0,0 +1,43 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package internal
+
+import "gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+
+// PropagatedContext holds the parts of a span context which are carried across
+// process boundaries by propagators. It allows ddtrace.Tracer implementations
+// other than the one of the tracer package, such as the mock tracer, to use
+// the propagators of the tracer package.
+type PropagatedContext struct {
+	// TraceID is the 128-bit trace ID, in big endian order.
+	TraceID [16]byte
+	SpanID  uint64
+
+	SamplingPriority    int
+	HasSamplingPriority bool
+
+	// Origin is the origin of the trace, e.g. "synthetics".
+	Origin string
+
+	// Tags holds the propagating trace tags, i.e. the "_dd.p.*" ones and the
+	// W3C "tracestate".
+	Tags map[string]string
+
+	Baggage map[string]string
+}
+
+var (
+	// NewPropagatedSpanContext returns a span context of the tracer package
+	// holding pc, which can be injected by its propagators. It is set by the
+	// tracer package.
+	NewPropagatedSpanContext func(pc PropagatedContext) ddtrace.SpanContext
+
+	// PropagatedContextOf returns the propagated parts of a span context of
+	// the tracer package, e.g. one extracted by its propagators. It returns
+	// false if ctx was created by another ddtrace.Tracer implementation. It
+	// is set by the tracer package.
+	PropagatedContextOf func(ctx ddtrace.SpanContext) (PropagatedContext, bool)
+)
@@ -72,6 +72,9 @@ func newSpan(t *mocktracer, operationName string, cfg *ddtrace.StartSpanConfig)
 		id = nextID()
 	}
 	s.context = &spanContext{spanID: id, traceID: id, span: s}
+	if t.traceID128Bit {
+		s.context.traceIDUpper = uint64(s.startTime.Unix()) << 32
+	}
 	if ctx, ok := cfg.Parent.(*spanContext); ok {
 		if ctx.span != nil && s.tags[ext.ServiceName] == nil {
 			// if we have a local parent and no service, inherit the parent's
@@ -84,6 +87,9 @@ func newSpan(t *mocktracer, operationName string, cfg *ddtrace.StartSpanConfig)
 		s.context.priority = ctx.samplingPriority()
 		s.context.hasPriority = ctx.hasSamplingPriority()
 		s.context.traceID = ctx.traceID
+		s.context.traceIDUpper = ctx.traceIDUpper
+		s.context.origin = ctx.origin
+		s.context.propagatingTags = ctx.propagatingTags
 		s.context.baggage = make(map[string]string, len(ctx.baggage))
 		ctx.ForeachBaggageItem(func(k, v string) bool {
 			s.context.baggage[k] = v
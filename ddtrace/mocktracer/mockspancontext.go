@@ -6,13 +6,17 @@
 package mocktracer
 
 import (
+	"encoding/binary"
+	"encoding/hex"
 	"sync"
 	"sync/atomic"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/internal"
 )
 
 var _ ddtrace.SpanContext = (*spanContext)(nil)
+var _ ddtrace.SpanContextW3C = (*spanContext)(nil)
 
 type spanContext struct {
 	sync.RWMutex // guards below fields
@@ -20,13 +24,32 @@ type spanContext struct {
 	priority     int
 	hasPriority  bool
 
-	spanID  uint64
-	traceID uint64
-	span    *mockspan // context owner
+	spanID       uint64
+	traceID      uint64
+	traceIDUpper uint64    // upper 64 bits of 128-bit trace IDs, zero otherwise
+	span         *mockspan // context owner
+
+	// origin and propagatingTags are extracted by the tracer.Propagator
+	// configured with WithPropagator, and injected again by it. They are
+	// never modified after creation.
+	origin          string
+	propagatingTags map[string]string
 }
 
 func (sc *spanContext) TraceID() uint64 { return sc.traceID }
 
+func (sc *spanContext) TraceID128() string {
+	id := sc.TraceID128Bytes()
+	return hex.EncodeToString(id[:])
+}
+
+func (sc *spanContext) TraceID128Bytes() [16]byte {
+	var id [16]byte
+	binary.BigEndian.PutUint64(id[:8], sc.traceIDUpper)
+	binary.BigEndian.PutUint64(id[8:], sc.traceID)
+	return id
+}
+
 func (sc *spanContext) SpanID() uint64 { return sc.spanID }
 
 func (sc *spanContext) ForeachBaggageItem(handler func(k, v string) bool) {
@@ -73,6 +96,67 @@ func (sc *spanContext) samplingPriority() int {
 	return sc.priority
 }
 
+// SamplingPriority returns the sampling priority of the context, and whether it is set.
+func (sc *spanContext) SamplingPriority() (p int, ok bool) {
+	sc.RLock()
+	defer sc.RUnlock()
+	return sc.priority, sc.hasPriority
+}
+
+// fromSpanContext converts a span context extracted by a tracer.Propagator into
+// a span context of the mock tracer.
+func fromSpanContext(ctx ddtrace.SpanContext) *spanContext {
+	pc, ok := internal.PropagatedContextOf(ctx)
+	if !ok {
+		// extracted by a custom propagator, keep what can be read
+		pc.SpanID = ctx.SpanID()
+		binary.BigEndian.PutUint64(pc.TraceID[8:], ctx.TraceID())
+		if w3c, ok := ctx.(ddtrace.SpanContextW3C); ok {
+			pc.TraceID = w3c.TraceID128Bytes()
+		}
+		if p, ok := ctx.(interface{ SamplingPriority() (int, bool) }); ok {
+			pc.SamplingPriority, pc.HasSamplingPriority = p.SamplingPriority()
+		}
+		ctx.ForeachBaggageItem(func(k, v string) bool {
+			if pc.Baggage == nil {
+				pc.Baggage = make(map[string]string)
+			}
+			pc.Baggage[k] = v
+			return true
+		})
+	}
+	return &spanContext{
+		traceIDUpper:    binary.BigEndian.Uint64(pc.TraceID[:8]),
+		traceID:         binary.BigEndian.Uint64(pc.TraceID[8:]),
+		spanID:          pc.SpanID,
+		priority:        pc.SamplingPriority,
+		hasPriority:     pc.HasSamplingPriority,
+		origin:          pc.Origin,
+		propagatingTags: pc.Tags,
+		baggage:         pc.Baggage,
+	}
+}
+
+// propagatedContext returns the parts of sc which are injected by a
+// tracer.Propagator.
+func (sc *spanContext) propagatedContext() internal.PropagatedContext {
+	pc := internal.PropagatedContext{
+		TraceID: sc.TraceID128Bytes(),
+		SpanID:  sc.spanID,
+		Origin:  sc.origin,
+		Tags:    sc.propagatingTags,
+	}
+	pc.SamplingPriority, pc.HasSamplingPriority = sc.SamplingPriority()
+	sc.ForeachBaggageItem(func(k, v string) bool {
+		if pc.Baggage == nil {
+			pc.Baggage = make(map[string]string)
+		}
+		pc.Baggage[k] = v
+		return true
+	})
+	return pc
+}
+
 var mockIDSource uint64 = 123
 
 func nextID() uint64 { return atomic.AddUint64(&mockIDSource, 1) }
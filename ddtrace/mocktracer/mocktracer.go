@@ -13,14 +13,18 @@
 package mocktracer
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
 	"sync"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/internal"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/datastreams"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
 )
 
 var _ ddtrace.Tracer = (*mocktracer)(nil)
@@ -44,12 +48,29 @@ type Tracer interface {
 	Stop()
 }
 
+// DataStreamsPayloads flushes the stats computed from the Data Streams
+// Monitoring checkpoints recorded by the given mock tracer, and returns all
+// the payloads flushed since it was started or reset. It allows asserting on
+// the checkpoints, their edge tags and latencies, without an agent. It returns
+// nil if t wasn't returned by Start.
+func DataStreamsPayloads(t Tracer) []datastreams.StatsPayload {
+	mt, ok := t.(*mocktracer)
+	if !ok {
+		return nil
+	}
+	mt.flushDataStreams()
+	return mt.dataStreamsSink.Payloads()
+}
+
 // Start sets the internal tracer to a mock and returns an interface
 // which allows querying it. Call Start at the beginning of your tests
 // to activate the mock tracer. When your test runs, use the returned
 // interface to query the tracer's state.
-func Start() Tracer {
+func Start(opts ...StartOption) Tracer {
 	t := newMockTracer()
+	for _, fn := range opts {
+		fn(t)
+	}
 	internal.SetGlobalTracer(t)
 	internal.Testing = true
 	return t
@@ -59,18 +80,35 @@ type mocktracer struct {
 	sync.RWMutex  // guards below spans
 	finishedSpans []Span
 	openSpans     map[uint64]Span
+
+	// the below fields are set by the StartOptions and never modified afterwards
+	propagator    tracer.Propagator
+	sampler       tracer.Sampler
+	traceID128Bit bool
+
+	dataStreamsMu      sync.Mutex // guards below data streams fields
+	dataStreams        *datastreams.Processor
+	dataStreamsStopped bool
+	dataStreamsSink    *datastreams.MemorySink
 }
 
 func newMockTracer() *mocktracer {
 	var t mocktracer
 	t.openSpans = make(map[uint64]Span)
+	t.dataStreamsSink = datastreams.NewMemorySink()
 	return &t
 }
 
 // Stop deactivates the mock tracer and sets the active tracer to a no-op.
-func (*mocktracer) Stop() {
+func (t *mocktracer) Stop() {
 	internal.SetGlobalTracer(&internal.NoopTracer{})
 	internal.Testing = false
+	t.dataStreamsMu.Lock()
+	defer t.dataStreamsMu.Unlock()
+	t.dataStreamsStopped = true
+	if t.dataStreams != nil {
+		t.dataStreams.Stop()
+	}
 }
 
 func (t *mocktracer) StartSpan(operationName string, opts ...ddtrace.StartSpanOption) ddtrace.Span {
@@ -79,6 +117,13 @@ func (t *mocktracer) StartSpan(operationName string, opts ...ddtrace.StartSpanOp
 		fn(&cfg)
 	}
 	span := newSpan(t, operationName, &cfg)
+	if t.sampler != nil && !span.context.hasSamplingPriority() {
+		if t.sampler.Sample(span) {
+			span.SetTag(ext.SamplingPriority, ext.PriorityAutoKeep)
+		} else {
+			span.SetTag(ext.SamplingPriority, ext.PriorityAutoReject)
+		}
+	}
 
 	t.Lock()
 	t.openSpans[span.SpanID()] = span
@@ -87,8 +132,31 @@ func (t *mocktracer) StartSpan(operationName string, opts ...ddtrace.StartSpanOp
 	return span
 }
 
+// GetDataStreamsProcessor returns the processor computing the stats of the
+// Data Streams Monitoring checkpoints, which is started on first use. The
+// stats are kept in memory, see DataStreamsPayloads. Once the tracer is
+// stopped, the processor is stopped too but still returned, so that
+// checkpoints keep propagating their pathways.
 func (t *mocktracer) GetDataStreamsProcessor() *datastreams.Processor {
-	return &datastreams.Processor{}
+	t.dataStreamsMu.Lock()
+	defer t.dataStreamsMu.Unlock()
+	if t.dataStreams == nil {
+		t.dataStreams = datastreams.NewProcessor(&statsd.NoOpClient{}, "", "", "", nil, nil, t.dataStreamsSink, func() bool { return true })
+		if !t.dataStreamsStopped {
+			t.dataStreams.Start()
+		}
+	}
+	return t.dataStreams
+}
+
+// flushDataStreams flushes the stats computed by the data streams processor,
+// if it was started.
+func (t *mocktracer) flushDataStreams() {
+	t.dataStreamsMu.Lock()
+	defer t.dataStreamsMu.Unlock()
+	if t.dataStreams != nil {
+		t.dataStreams.Flush()
+	}
 }
 
 func (t *mocktracer) OpenSpans() []Span {
@@ -114,6 +182,8 @@ func (t *mocktracer) Reset() {
 		delete(t.openSpans, k)
 	}
 	t.finishedSpans = nil
+	t.flushDataStreams()
+	t.dataStreamsSink.Reset()
 }
 
 func (t *mocktracer) addFinishedSpan(s Span) {
@@ -131,9 +201,20 @@ const (
 	spanHeader     = tracer.DefaultParentIDHeader
 	priorityHeader = tracer.DefaultPriorityHeader
 	baggagePrefix  = tracer.DefaultBaggageHeaderPrefix
+	tagsHeader     = "x-datadog-tags"
 )
 
+// keyTraceID128 is the propagated tag holding the hex encoded upper 64 bits of the trace ID.
+const keyTraceID128 = "_dd.p.tid"
+
 func (t *mocktracer) Extract(carrier interface{}) (ddtrace.SpanContext, error) {
+	if t.propagator != nil {
+		ctx, err := t.propagator.Extract(carrier)
+		if err != nil {
+			return nil, err
+		}
+		return fromSpanContext(ctx), nil
+	}
 	reader, ok := carrier.(tracer.TextMapReader)
 	if !ok {
 		return nil, tracer.ErrInvalidCarrier
@@ -163,6 +244,17 @@ func (t *mocktracer) Extract(carrier interface{}) (ddtrace.SpanContext, error) {
 			sc.priority = p
 			sc.hasPriority = true
 		}
+		if k == tagsHeader {
+			for _, tag := range strings.Split(v, ",") {
+				if strings.HasPrefix(tag, keyTraceID128+"=") {
+					id, err := strconv.ParseUint(strings.TrimPrefix(tag, keyTraceID128+"="), 16, 64)
+					if err != nil {
+						return tracer.ErrSpanContextCorrupted
+					}
+					sc.traceIDUpper = id
+				}
+			}
+		}
 		if strings.HasPrefix(k, baggagePrefix) {
 			sc.setBaggageItem(strings.TrimPrefix(k, baggagePrefix), v)
 		}
@@ -178,6 +270,13 @@ func (t *mocktracer) Extract(carrier interface{}) (ddtrace.SpanContext, error) {
 }
 
 func (t *mocktracer) Inject(context ddtrace.SpanContext, carrier interface{}) error {
+	if t.propagator != nil {
+		if ctx, ok := context.(*spanContext); ok {
+			// the propagators of the tracer package only know their own span contexts
+			context = internal.NewPropagatedSpanContext(ctx.propagatedContext())
+		}
+		return t.propagator.Inject(context, carrier)
+	}
 	writer, ok := carrier.(tracer.TextMapWriter)
 	if !ok {
 		return tracer.ErrInvalidCarrier
@@ -191,6 +290,9 @@ func (t *mocktracer) Inject(context ddtrace.SpanContext, carrier interface{}) er
 	if ctx.hasSamplingPriority() {
 		writer.Set(priorityHeader, strconv.Itoa(ctx.priority))
 	}
+	if ctx.traceIDUpper != 0 {
+		writer.Set(tagsHeader, keyTraceID128+"="+fmt.Sprintf("%016x", ctx.traceIDUpper))
+	}
 	ctx.ForeachBaggageItem(func(k, v string) bool {
 		writer.Set(baggagePrefix+k, v)
 		return true
@@ -6,6 +6,7 @@
 package mocktracer
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -13,8 +14,10 @@ import (
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/internal"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/datastreams"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestStart(t *testing.T) {
@@ -267,3 +270,138 @@ func TestTracerExtract(t *testing.T) {
 		assert.Equal("B", got.baggageItem("a"))
 	})
 }
+
+func TestTracerPropagator(t *testing.T) {
+	t.Setenv("DD_TRACE_PROPAGATION_STYLE", "tracecontext")
+	mt := Start(WithPropagator(tracer.NewPropagator(nil)), WithTraceID128Bit(true))
+	defer mt.Stop()
+	assert := assert.New(t)
+
+	root := tracer.StartSpan("http.request", tracer.Tag(ext.SamplingPriority, ext.PriorityUserKeep))
+	root.SetBaggageItem("item", "x")
+	carrier := tracer.TextMapCarrier{}
+	assert.NoError(tracer.Inject(root.Context(), carrier))
+	assert.Contains(carrier, "traceparent")
+	assert.NotContains(carrier, traceHeader)
+
+	sctx, err := tracer.Extract(carrier)
+	assert.NoError(err)
+	got := sctx.(*spanContext)
+	want := root.Context().(*spanContext)
+	assert.NotZero(want.traceIDUpper)
+	assert.Equal(want.TraceID128(), got.TraceID128())
+	assert.Equal(want.spanID, got.spanID)
+	p, ok := got.SamplingPriority()
+	assert.True(ok)
+	assert.Equal(ext.PriorityUserKeep, p)
+
+	child := tracer.StartSpan("db.query", tracer.ChildOf(sctx)).(*mockspan)
+	assert.Equal(want.TraceID128(), child.context.TraceID128())
+	assert.Equal(root.Context().SpanID(), child.ParentID())
+}
+
+func TestTracerPropagatorTraceState(t *testing.T) {
+	t.Setenv("DD_TRACE_PROPAGATION_STYLE", "tracecontext")
+	mt := Start(WithPropagator(tracer.NewPropagator(nil)))
+	defer mt.Stop()
+	assert := assert.New(t)
+
+	sctx, err := tracer.Extract(tracer.TextMapCarrier{
+		"traceparent": "00-00000000000000000000000000000001-0000000000000002-01",
+		"tracestate":  "dd=s:2;o:synthetics;t.usr.id:abc,other=x",
+	})
+	assert.NoError(err)
+	got := sctx.(*spanContext)
+	assert.Equal("synthetics", got.origin)
+	assert.Equal("abc", got.propagatingTags["_dd.p.usr.id"])
+
+	child := tracer.StartSpan("db.query", tracer.ChildOf(sctx))
+	carrier := tracer.TextMapCarrier{}
+	assert.NoError(tracer.Inject(child.Context(), carrier))
+	assert.Contains(carrier["tracestate"], "o:synthetics")
+	assert.Contains(carrier["tracestate"], "t.usr.id:abc")
+	assert.Contains(carrier["tracestate"], "other=x")
+}
+
+func TestTracerTraceID128Bit(t *testing.T) {
+	mt := Start(WithTraceID128Bit(true))
+	defer mt.Stop()
+	assert := assert.New(t)
+
+	root := tracer.StartSpan("http.request")
+	carrier := tracer.TextMapCarrier{}
+	assert.NoError(tracer.Inject(root.Context(), carrier))
+	assert.Regexp("^_dd.p.tid=[0-9a-f]{8}00000000$", carrier[tagsHeader])
+
+	sctx, err := tracer.Extract(carrier)
+	assert.NoError(err)
+	assert.Equal(root.Context().(*spanContext).TraceID128(), sctx.(*spanContext).TraceID128())
+}
+
+type traceIDSampler struct{ keep uint64 }
+
+func (s traceIDSampler) Sample(span tracer.Span) bool {
+	return span.Context().TraceID() == s.keep
+}
+
+func TestTracerSampler(t *testing.T) {
+	mt := newMockTracer()
+	mt.sampler = traceIDSampler{}
+	assert := assert.New(t)
+
+	root := mt.StartSpan("http.request").(*mockspan)
+	assert.Equal(ext.PriorityAutoReject, root.Tag(ext.SamplingPriority))
+	child := mt.StartSpan("db.query", tracer.ChildOf(root.Context())).(*mockspan)
+	assert.Equal(ext.PriorityAutoReject, child.Tag(ext.SamplingPriority))
+
+	mt.sampler = traceIDSampler{keep: nextID() + 1}
+	root = mt.StartSpan("http.request").(*mockspan)
+	assert.Equal(ext.PriorityAutoKeep, root.Tag(ext.SamplingPriority))
+
+	mt.sampler = tracer.NewRateSampler(0)
+	root = mt.StartSpan("http.request", tracer.Tag(ext.SamplingPriority, ext.PriorityUserKeep)).(*mockspan)
+	assert.Equal(ext.PriorityUserKeep, root.Tag(ext.SamplingPriority))
+}
+
+func TestTracerDataStreamsPayloads(t *testing.T) {
+	assert := assert.New(t)
+	mt := Start()
+	defer mt.Stop()
+	assert.Empty(DataStreamsPayloads(mt))
+
+	ctx, ok := tracer.SetDataStreamsCheckpoint(context.Background(), "direction:out", "topic:topic1", "type:kafka")
+	assert.True(ok)
+	tracer.SetDataStreamsCheckpoint(ctx, "direction:in", "topic:topic1", "type:kafka")
+
+	var edges [][]string
+	for _, p := range DataStreamsPayloads(mt) {
+		for _, b := range p.Stats {
+			for _, s := range b.Stats {
+				if s.TimestampType == datastreams.TimestampTypeCurrent {
+					edges = append(edges, s.EdgeTags)
+				}
+			}
+		}
+	}
+	assert.ElementsMatch([][]string{
+		{"direction:out", "topic:topic1", "type:kafka"},
+		{"direction:in", "topic:topic1", "type:kafka"},
+	}, edges)
+
+	mt.Reset()
+	assert.Empty(DataStreamsPayloads(mt))
+	assert.Nil(DataStreamsPayloads(nil))
+
+	mt.Stop()
+	p := mt.(*mocktracer).GetDataStreamsProcessor()
+	require.NotNil(t, p, "the processor is still returned once stopped")
+	_, ok = datastreams.PathwayFromContext(p.SetCheckpoint(context.Background(), "direction:out", "topic:topic1", "type:kafka"))
+	assert.True(ok)
+}
+
+func TestTracerDataStreamsProcessorStopped(t *testing.T) {
+	mt := Start()
+	mt.Stop()
+	// the processor is created after the tracer was stopped
+	assert.NotNil(t, mt.(*mocktracer).GetDataStreamsProcessor())
+}
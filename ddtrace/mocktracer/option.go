@@ -0,0 +1,43 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package mocktracer
+
+import (
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// StartOption represents a function that can be provided as a parameter to Start.
+type StartOption func(*mocktracer)
+
+// WithPropagator sets the propagator used by the mock tracer to inject and extract
+// span contexts. It can be used with tracer.NewPropagator to test interoperability
+// with the propagation styles of the real tracer (e.g. W3C trace context or B3).
+// By default, the mock tracer only understands its own Datadog-style headers.
+func WithPropagator(p tracer.Propagator) StartOption {
+	return func(t *mocktracer) {
+		t.propagator = p
+	}
+}
+
+// WithSampler sets the sampler used to take a sampling decision on root spans, whose
+// result is reported as an automatic sampling priority. Spans with a parent holding a
+// sampling priority inherit it instead. By default, no sampling decision is made.
+// Note that the rate samplers of the tracer package, except those keeping every
+// span, only keep the spans of the tracer package, and thus reject mock spans.
+func WithSampler(s tracer.Sampler) StartOption {
+	return func(t *mocktracer) {
+		t.sampler = s
+	}
+}
+
+// WithTraceID128Bit enables the generation of 128-bit trace IDs for root spans,
+// following the format of the real tracer: the upper 64 bits hold the start time
+// of the span in seconds, followed by 32 zero bits.
+func WithTraceID128Bit(enabled bool) StartOption {
+	return func(t *mocktracer) {
+		t.traceID128Bit = enabled
+	}
+}
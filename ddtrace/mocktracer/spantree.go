@@ -0,0 +1,145 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package mocktracer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SpanTree is a node of a tree of spans, holding a span and its children.
+type SpanTree struct {
+	// Span is the span held by this node.
+	Span Span
+
+	// Parent is the node of the parent span, or nil for root nodes.
+	Parent *SpanTree
+
+	// Children holds the nodes of the child spans, ordered by start time.
+	Children []*SpanTree
+}
+
+// NewSpanTrees arranges the given spans, typically obtained using FinishedSpans, into
+// trees following their parent/child relationships. Spans whose parent is not part of
+// the given spans are considered roots. Roots and children are ordered by start time.
+func NewSpanTrees(spans []Span) []*SpanTree {
+	nodes := make(map[uint64]*SpanTree, len(spans))
+	for _, s := range spans {
+		nodes[s.SpanID()] = &SpanTree{Span: s}
+	}
+	var roots []*SpanTree
+	for _, s := range spans {
+		n := nodes[s.SpanID()]
+		if p, ok := nodes[s.ParentID()]; ok && s.ParentID() != s.SpanID() {
+			n.Parent = p
+			p.Children = append(p.Children, n)
+		} else {
+			roots = append(roots, n)
+		}
+	}
+	for _, n := range nodes {
+		sortByStartTime(n.Children)
+	}
+	sortByStartTime(roots)
+	return roots
+}
+
+func sortByStartTime(nodes []*SpanTree) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].Span.StartTime().Before(nodes[j].Span.StartTime())
+	})
+}
+
+// Walk calls fn for the node and all of its descendants, depth-first in pre-order.
+// The depth is 0 for the node Walk is called on. Descendants of a node are skipped
+// when fn returns false for it.
+func (t *SpanTree) Walk(fn func(n *SpanTree, depth int) bool) {
+	t.walk(fn, 0)
+}
+
+func (t *SpanTree) walk(fn func(n *SpanTree, depth int) bool, depth int) {
+	if !fn(t, depth) {
+		return
+	}
+	for _, c := range t.Children {
+		c.walk(fn, depth+1)
+	}
+}
+
+// Find returns the first node, in depth-first pre-order, holding a span with the
+// given operation name, or nil if there is none.
+func (t *SpanTree) Find(operationName string) *SpanTree {
+	return t.FindFunc(func(s Span) bool {
+		return s.OperationName() == operationName
+	})
+}
+
+// FindFunc returns the first node, in depth-first pre-order, holding a span for
+// which match returns true, or nil if there is none. It allows finding spans by
+// their tags, e.g.:
+//
+//	tree.FindFunc(func(s Span) bool { return s.Tag(ext.DBType) == "postgres" })
+func (t *SpanTree) FindFunc(match func(s Span) bool) *SpanTree {
+	var found *SpanTree
+	t.Walk(func(n *SpanTree, _ int) bool {
+		if found == nil && match(n.Span) {
+			found = n
+		}
+		return found == nil
+	})
+	return found
+}
+
+// Len returns the number of spans in the tree.
+func (t *SpanTree) Len() int {
+	var n int
+	t.Walk(func(*SpanTree, int) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+// String returns the operation names of the spans in the tree, one per line,
+// indented by two spaces per level of depth. It allows asserting the shape of
+// the tree at a glance, e.g.:
+//
+//	http.request
+//	  db.query
+//	  cache.get
+func (t *SpanTree) String() string {
+	return t.StringWithTags()
+}
+
+// StringWithTags is like String, but each operation name is followed by the
+// values of the given tags which are set on the span, in the given order. It
+// allows asserting the tags of the spans along with the shape of the tree, e.g.
+// StringWithTags(ext.ResourceName, ext.Error) may return:
+//
+//	http.request [resource.name=GET /]
+//	  db.query [resource.name=SELECT 1 error=true]
+func (t *SpanTree) StringWithTags(keys ...string) string {
+	var sb strings.Builder
+	t.Walk(func(n *SpanTree, depth int) bool {
+		sb.WriteString(strings.Repeat("  ", depth))
+		sb.WriteString(n.Span.OperationName())
+		var tags []string
+		for _, k := range keys {
+			if v := n.Span.Tag(k); v != nil {
+				tags = append(tags, fmt.Sprintf("%s=%v", k, v))
+			}
+		}
+		if len(tags) > 0 {
+			sb.WriteString(" [")
+			sb.WriteString(strings.Join(tags, " "))
+			sb.WriteByte(']')
+		}
+		sb.WriteByte('\n')
+		return true
+	})
+	return sb.String()
+}
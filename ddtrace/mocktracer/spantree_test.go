@@ -0,0 +1,57 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package mocktracer
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpanTrees(t *testing.T) {
+	assert := assert.New(t)
+	mt := newMockTracer()
+	now := time.Now()
+	root := mt.StartSpan("http.request", tracer.StartTime(now))
+	second := mt.StartSpan("cache.get", tracer.ChildOf(root.Context()), tracer.StartTime(now.Add(2)))
+	first := mt.StartSpan("db.query", tracer.ChildOf(root.Context()), tracer.StartTime(now.Add(1)), tracer.Tag("db.type", "postgres"))
+	nested := mt.StartSpan("db.fetch", tracer.ChildOf(first.Context()), tracer.StartTime(now.Add(3)))
+	other := mt.StartSpan("worker", tracer.StartTime(now.Add(4)))
+	nested.Finish()
+	second.Finish()
+	first.Finish()
+	other.Finish()
+	root.Finish()
+
+	trees := NewSpanTrees(mt.FinishedSpans())
+	require.Len(t, trees, 2)
+	assert.Equal("http.request\n  db.query\n    db.fetch\n  cache.get\n", trees[0].String())
+	assert.Equal("worker\n", trees[1].String())
+	assert.Equal(4, trees[0].Len())
+
+	n := trees[0].Find("db.fetch")
+	require.NotNil(t, n)
+	assert.Equal(nested.Context().SpanID(), n.Span.SpanID())
+	assert.Equal("db.query", n.Parent.Span.OperationName())
+	assert.Nil(trees[0].Find("missing"))
+
+	assert.Equal("http.request [resource.name=http.request]\n  db.query [db.type=postgres resource.name=db.query]\n    db.fetch [resource.name=db.fetch]\n  cache.get [resource.name=cache.get]\n",
+		trees[0].StringWithTags("db.type", "resource.name", "missing"))
+	n = trees[0].FindFunc(func(s Span) bool { return s.Tag("db.type") == "postgres" })
+	require.NotNil(t, n)
+	assert.Equal("db.query", n.Span.OperationName())
+
+	var visited []string
+	trees[0].Walk(func(n *SpanTree, depth int) bool {
+		visited = append(visited, n.Span.OperationName())
+		return depth == 0
+	})
+	assert.Equal([]string{"http.request", "db.query", "cache.get"}, visited)
+}
@@ -6,7 +6,11 @@
 package opentracer
 
 import (
+	"encoding/json"
 	"fmt"
+	"math"
+	"sync"
+	"time"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
@@ -18,29 +22,120 @@ import (
 
 var _ opentracing.Span = (*span)(nil)
 
+const (
+	// keyEvents is the tag holding the JSON encoded list of events logged on the span.
+	keyEvents = "events"
+
+	// keyEventsDropped is the metric holding the number of events which were not
+	// recorded because the span already held maxSpanEvents.
+	keyEventsDropped = "_dd.span_events.dropped"
+)
+
+// maxSpanEvents is the maximum number of events recorded on a span, which bounds
+// the memory held by long-lived spans and the size of the keyEvents tag. Events
+// logged beyond that are counted in keyEventsDropped.
+const maxSpanEvents = 128
+
 // span implements opentracing.Span on top of ddtrace.Span.
 type span struct {
 	ddtrace.Span
 	*opentracer
+
+	mu      sync.Mutex // guards below fields
+	events  []spanEvent
+	dropped int // number of events not recorded because of maxSpanEvents
+}
+
+// spanEvent is a log record of a span, as encoded in the keyEvents tag.
+type spanEvent struct {
+	Name         string                 `json:"name"`
+	TimeUnixNano int64                  `json:"time_unix_nano"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"`
+}
+
+func (s *span) Context() opentracing.SpanContext { return s.Span.Context() }
+func (s *span) Tracer() opentracing.Tracer       { return s.opentracer }
+
+func (s *span) Finish() {
+	s.flushEvents()
+	s.Span.Finish()
 }
 
-func (s *span) Context() opentracing.SpanContext            { return s.Span.Context() }
-func (s *span) Finish()                                     { s.Span.Finish() }
-func (s *span) Tracer() opentracing.Tracer                  { return s.opentracer }
-func (s *span) LogEvent(_ string)                           { /* deprecated */ }
-func (s *span) LogEventWithPayload(_ string, _ interface{}) { /* deprecated */ }
-func (s *span) Log(_ opentracing.LogData)                   { /* deprecated */ }
+func (s *span) LogEvent(event string) {
+	s.Log(opentracing.LogData{Event: event})
+}
+
+func (s *span) LogEventWithPayload(event string, payload interface{}) {
+	s.Log(opentracing.LogData{Event: event, Payload: payload})
+}
+
+func (s *span) Log(ld opentracing.LogData) {
+	lr := ld.ToLogRecord()
+	s.logRecord(lr.Timestamp, lr.Fields)
+}
 
 func (s *span) FinishWithOptions(opts opentracing.FinishOptions) {
 	for _, lr := range opts.LogRecords {
 		if len(lr.Fields) > 0 {
-			s.LogFields(lr.Fields...)
+			ts := lr.Timestamp
+			if ts.IsZero() {
+				ts = time.Now()
+			}
+			s.logRecord(ts, lr.Fields)
 		}
 	}
+	s.flushEvents()
 	s.Span.Finish(tracer.FinishTime(opts.FinishTime))
 }
 
 func (s *span) LogFields(fields ...log.Field) {
+	s.logRecord(time.Now(), fields)
+}
+
+// logRecord records the given fields as a span event and applies the standard ones to the span.
+func (s *span) logRecord(ts time.Time, fields []log.Field) {
+	s.setErrorTags(fields)
+	attrs := make(fieldEncoder, len(fields))
+	for _, f := range fields {
+		f.Marshal(attrs)
+	}
+	name := "log"
+	if v, ok := attrs["event"].(string); ok && v != "" {
+		name = v
+		delete(attrs, "event")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.events) >= maxSpanEvents {
+		s.dropped++
+		return
+	}
+	s.events = append(s.events, spanEvent{
+		Name:         name,
+		TimeUnixNano: ts.UnixNano(),
+		Attributes:   attrs,
+	})
+}
+
+// flushEvents sets the events logged so far as a tag on the span.
+func (s *span) flushEvents() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dropped > 0 {
+		s.Span.SetTag(keyEventsDropped, s.dropped)
+	}
+	if len(s.events) == 0 {
+		return
+	}
+	b, err := json.Marshal(s.events)
+	if err != nil {
+		return
+	}
+	s.Span.SetTag(keyEvents, string(b))
+}
+
+// setErrorTags sets the error tags on the span from the standard error fields.
+func (s *span) setErrorTags(fields []log.Field) {
 	// catch standard opentracing keys and adjust to internal ones as per spec:
 	// https://github.com/opentracing/specification/blob/master/semantic_conventions.md#log-fields-table
 	for _, f := range fields {
@@ -85,3 +180,28 @@ func (s *span) SetTag(key string, value interface{}) opentracing.Span {
 	s.Span.SetTag(key, value)
 	return s
 }
+
+// fieldEncoder implements log.Encoder, collecting fields into a map of JSON encodable values.
+type fieldEncoder map[string]interface{}
+
+var _ log.Encoder = (fieldEncoder)(nil)
+
+func (e fieldEncoder) EmitString(key, value string)             { e[key] = value }
+func (e fieldEncoder) EmitBool(key string, value bool)          { e[key] = value }
+func (e fieldEncoder) EmitInt(key string, value int)            { e[key] = value }
+func (e fieldEncoder) EmitInt32(key string, value int32)        { e[key] = value }
+func (e fieldEncoder) EmitInt64(key string, value int64)        { e[key] = value }
+func (e fieldEncoder) EmitUint32(key string, value uint32)      { e[key] = value }
+func (e fieldEncoder) EmitUint64(key string, value uint64)      { e[key] = value }
+func (e fieldEncoder) EmitFloat32(key string, value float32)    { e.EmitFloat64(key, float64(value)) }
+func (e fieldEncoder) EmitObject(key string, value interface{}) { e[key] = fmt.Sprint(value) }
+func (e fieldEncoder) EmitLazyLogger(value log.LazyLogger)      { value(e) }
+
+func (e fieldEncoder) EmitFloat64(key string, value float64) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		// not representable in JSON
+		e[key] = fmt.Sprint(value)
+		return
+	}
+	e[key] = value
+}
@@ -0,0 +1,115 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package opentracer
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func finishedEvents(t *testing.T, mt mocktracer.Tracer) []spanEvent {
+	spans := mt.FinishedSpans()
+	require.Len(t, spans, 1)
+	var events []spanEvent
+	require.NoError(t, json.Unmarshal([]byte(spans[0].Tag(keyEvents).(string)), &events))
+	return events
+}
+
+func TestSpanLog(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+	ot := &opentracer{mt.(ddtrace.Tracer)}
+
+	t.Run("fields", func(t *testing.T) {
+		defer mt.Reset()
+		assert := assert.New(t)
+		sp := ot.StartSpan("test.operation")
+		sp.LogFields(log.String("event", "cache.miss"), log.Int("size", 3), log.Float64("ratio", math.NaN()))
+		sp.LogKV("key", "value")
+		sp.Finish()
+
+		events := finishedEvents(t, mt)
+		require.Len(t, events, 2)
+		assert.Equal("cache.miss", events[0].Name)
+		assert.Equal(map[string]interface{}{"size": float64(3), "ratio": "NaN"}, events[0].Attributes)
+		assert.NotZero(events[0].TimeUnixNano)
+		assert.Equal("log", events[1].Name)
+		assert.Equal(map[string]interface{}{"key": "value"}, events[1].Attributes)
+	})
+
+	t.Run("deprecated", func(t *testing.T) {
+		defer mt.Reset()
+		assert := assert.New(t)
+		ts := time.Unix(1, 0)
+		sp := ot.StartSpan("test.operation")
+		sp.LogEvent("started")
+		sp.LogEventWithPayload("payload", 42)
+		sp.Log(opentracing.LogData{Timestamp: ts, Event: "data"})
+		sp.Finish()
+
+		events := finishedEvents(t, mt)
+		require.Len(t, events, 3)
+		assert.Equal("started", events[0].Name)
+		assert.Equal("payload", events[1].Name)
+		assert.Equal(map[string]interface{}{"payload": "42"}, events[1].Attributes)
+		assert.Equal("data", events[2].Name)
+		assert.Equal(ts.UnixNano(), events[2].TimeUnixNano)
+	})
+
+	t.Run("finish-options", func(t *testing.T) {
+		defer mt.Reset()
+		assert := assert.New(t)
+		ts := time.Unix(2, 0)
+		err := errors.New("boom")
+		sp := ot.StartSpan("test.operation")
+		sp.FinishWithOptions(opentracing.FinishOptions{
+			LogRecords: []opentracing.LogRecord{{
+				Timestamp: ts,
+				Fields:    []log.Field{log.String("event", "error"), log.Error(err)},
+			}},
+		})
+
+		events := finishedEvents(t, mt)
+		require.Len(t, events, 1)
+		assert.Equal("error", events[0].Name)
+		assert.Equal(ts.UnixNano(), events[0].TimeUnixNano)
+		assert.Equal(map[string]interface{}{"error.object": "boom"}, events[0].Attributes)
+		assert.Equal(err, mt.FinishedSpans()[0].Tag(ext.Error))
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		defer mt.Reset()
+		sp := ot.StartSpan("test.operation")
+		for i := 0; i < maxSpanEvents+3; i++ {
+			sp.LogKV("i", i)
+		}
+		sp.Finish()
+
+		events := finishedEvents(t, mt)
+		require.Len(t, events, maxSpanEvents)
+		assert.Equal(t, map[string]interface{}{"i": float64(maxSpanEvents - 1)}, events[maxSpanEvents-1].Attributes)
+		assert.Equal(t, 3, mt.FinishedSpans()[0].Tag(keyEventsDropped))
+	})
+
+	t.Run("none", func(t *testing.T) {
+		defer mt.Reset()
+		ot.StartSpan("test.operation").Finish()
+		require.Len(t, mt.FinishedSpans(), 1)
+		assert.Nil(t, mt.FinishedSpans()[0].Tag(keyEvents))
+	})
+}
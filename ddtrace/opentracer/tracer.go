@@ -26,6 +26,8 @@ package opentracer
 
 import (
 	"context"
+	"encoding/binary"
+	"io"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/internal"
@@ -83,22 +85,82 @@ func (t *opentracer) Inject(ctx opentracing.SpanContext, format interface{}, car
 	switch format {
 	case opentracing.TextMap, opentracing.HTTPHeaders:
 		return translateError(t.Tracer.Inject(sctx, carrier))
+	case opentracing.Binary:
+		return translateError(t.injectBinary(sctx, carrier))
 	default:
 		return opentracing.ErrUnsupportedFormat
 	}
 }
 
+// maxBinaryLen is the maximum accepted length of a binary encoded span context.
+const maxBinaryLen = 64 * 1024
+
+// injectBinary injects sctx into carrier using the binary encoding. Carriers implementing
+// tracer.BinaryWriter are used as is, while for io.Writer carriers the encoding is written
+// prefixed by its length as a big endian uint32.
+func (t *opentracer) injectBinary(sctx ddtrace.SpanContext, carrier interface{}) error {
+	switch c := carrier.(type) {
+	case tracer.BinaryWriter:
+		return t.Tracer.Inject(sctx, c)
+	case io.Writer:
+		var b tracer.BinaryCarrier
+		if err := t.Tracer.Inject(sctx, &b); err != nil {
+			return err
+		}
+		var size [4]byte
+		binary.BigEndian.PutUint32(size[:], uint32(len(b)))
+		if _, err := c.Write(size[:]); err != nil {
+			return err
+		}
+		_, err := c.Write(b)
+		return err
+	default:
+		return tracer.ErrInvalidCarrier
+	}
+}
+
 // Extract implements opentracing.Tracer.
 func (t *opentracer) Extract(format interface{}, carrier interface{}) (opentracing.SpanContext, error) {
 	switch format {
 	case opentracing.TextMap, opentracing.HTTPHeaders:
 		sctx, err := t.Tracer.Extract(carrier)
 		return sctx, translateError(err)
+	case opentracing.Binary:
+		sctx, err := t.extractBinary(carrier)
+		return sctx, translateError(err)
 	default:
 		return nil, opentracing.ErrUnsupportedFormat
 	}
 }
 
+// extractBinary extracts a span context from carrier using the binary encoding,
+// as injected by injectBinary.
+func (t *opentracer) extractBinary(carrier interface{}) (ddtrace.SpanContext, error) {
+	switch c := carrier.(type) {
+	case tracer.BinaryReader:
+		return t.Tracer.Extract(c)
+	case io.Reader:
+		var size [4]byte
+		if _, err := io.ReadFull(c, size[:]); err != nil {
+			if err == io.EOF {
+				return nil, tracer.ErrSpanContextNotFound
+			}
+			return nil, tracer.ErrSpanContextCorrupted
+		}
+		n := binary.BigEndian.Uint32(size[:])
+		if n > maxBinaryLen {
+			return nil, tracer.ErrSpanContextCorrupted
+		}
+		b := make(tracer.BinaryCarrier, n)
+		if _, err := io.ReadFull(c, b); err != nil {
+			return nil, tracer.ErrSpanContextCorrupted
+		}
+		return t.Tracer.Extract(b)
+	default:
+		return nil, tracer.ErrInvalidCarrier
+	}
+}
+
 var _ opentracing.TracerContextWithSpanExtension = (*opentracer)(nil)
 
 // ContextWithSpan implements opentracing.TracerContextWithSpanExtension.
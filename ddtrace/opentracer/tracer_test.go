@@ -6,6 +6,7 @@
 package opentracer
 
 import (
+	"bytes"
 	"context"
 	"testing"
 
@@ -122,3 +123,46 @@ func TestSpanTelemetry(t *testing.T) {
 	telemetryClient.AssertCalled(t, "Count", telemetry.NamespaceTracers, "spans_created", 1.0, telemetryTags, true)
 	telemetryClient.AssertNumberOfCalls(t, "Count", 1)
 }
+
+func TestBinaryPropagation(t *testing.T) {
+	assert := assert.New(t)
+	ot := New()
+	defer tracer.Stop()
+	sp := ot.StartSpan("test.operation")
+	sp.SetBaggageItem("item", "x")
+	sctx := sp.Context().(ddtrace.SpanContext)
+
+	t.Run("io", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(ot.Inject(sctx, opentracing.Binary, &buf))
+		buf.WriteString("trailing data")
+		got, err := ot.Extract(opentracing.Binary, &buf)
+		assert.NoError(err)
+		assert.Equal(sctx.TraceID(), got.(ddtrace.SpanContext).TraceID())
+		assert.Equal(sctx.SpanID(), got.(ddtrace.SpanContext).SpanID())
+		got.ForeachBaggageItem(func(k, v string) bool {
+			assert.Equal("item", k)
+			assert.Equal("x", v)
+			return true
+		})
+		assert.Equal("trailing data", buf.String())
+	})
+
+	t.Run("carrier", func(t *testing.T) {
+		var c tracer.BinaryCarrier
+		assert.NoError(ot.Inject(sctx, opentracing.Binary, &c))
+		got, err := ot.Extract(opentracing.Binary, c)
+		assert.NoError(err)
+		assert.Equal(sctx.SpanID(), got.(ddtrace.SpanContext).SpanID())
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := ot.Extract(opentracing.Binary, bytes.NewReader(nil))
+		assert.Equal(opentracing.ErrSpanContextNotFound, err)
+		_, err = ot.Extract(opentracing.Binary, bytes.NewReader([]byte{0, 0, 0, 8, 1}))
+		assert.Equal(opentracing.ErrSpanContextCorrupted, err)
+		_, err = ot.Extract(opentracing.Binary, "invalid-carrier")
+		assert.Equal(opentracing.ErrInvalidCarrier, err)
+		assert.Equal(opentracing.ErrInvalidCarrier, ot.Inject(sctx, opentracing.Binary, "invalid-carrier"))
+	})
+}
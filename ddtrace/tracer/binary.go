@@ -0,0 +1,261 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package tracer
+
+import (
+	"encoding/binary"
+	"strings"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/samplernames"
+)
+
+// BinaryWriter is implemented by carriers which can hold a span context in Datadog's
+// compact binary encoding. Carriers implementing BinaryWriter are compatible to be
+// used with Inject.
+type BinaryWriter interface {
+	// WriteBinary stores the given binary encoded span context. Implementations with
+	// limited space may return an error when b does not fit, which will be returned
+	// by Inject.
+	WriteBinary(b []byte) error
+}
+
+// BinaryReader is implemented by carriers which hold a span context in Datadog's
+// compact binary encoding. Carriers implementing BinaryReader are compatible to be
+// used with Extract.
+type BinaryReader interface {
+	// ReadBinary returns the binary encoded span context.
+	ReadBinary() ([]byte, error)
+}
+
+// BinaryCarrier allows the use of a regular byte slice as both BinaryWriter and
+// BinaryReader. The encoding carries the 128-bit trace ID, the span ID, the sampling
+// priority, the origin and the propagating "_dd.p.*" trace tags, and takes 26 bytes
+// when only the IDs are present. Baggage items are only carried when enabled using
+// PropagatorConfig.BinaryBaggage.
+type BinaryCarrier []byte
+
+var _ BinaryWriter = (*BinaryCarrier)(nil)
+var _ BinaryReader = (*BinaryCarrier)(nil)
+
+// WriteBinary implements BinaryWriter.
+func (c *BinaryCarrier) WriteBinary(b []byte) error {
+	*c = append((*c)[:0], b...)
+	return nil
+}
+
+// ReadBinary implements BinaryReader.
+func (c BinaryCarrier) ReadBinary() ([]byte, error) {
+	return c, nil
+}
+
+const (
+	// binaryVersion is the version of the binary encoding, stored as its first byte.
+	binaryVersion byte = 1
+
+	// binaryHeaderLen is the length of the version, flags, trace ID and span ID.
+	binaryHeaderLen = 1 + 1 + 16 + 8
+)
+
+// flags indicating which optional fields follow the header in the binary encoding.
+const (
+	binaryFlagPriority byte = 1 << iota
+	binaryFlagOrigin
+	binaryFlagTags
+	binaryFlagBaggage
+)
+
+// isBinaryCarrier reports whether carrier should be handled by propagatorBinary,
+// that is, when it supports the binary encoding but not the text map ones.
+func isBinaryCarrier(carrier interface{}) bool {
+	switch carrier.(type) {
+	case TextMapWriter, TextMapReader:
+		return false
+	case BinaryWriter, BinaryReader:
+		return true
+	default:
+		return false
+	}
+}
+
+// propagatorBinary implements Propagator and injects/extracts span contexts
+// using Datadog's binary encoding. Only BinaryWriter and BinaryReader carriers
+// are supported.
+type propagatorBinary struct {
+	baggage bool // whether baggage items are injected and extracted
+}
+
+func (p *propagatorBinary) Inject(spanCtx ddtrace.SpanContext, carrier interface{}) error {
+	switch c := carrier.(type) {
+	case BinaryWriter:
+		return p.injectBinary(spanCtx, c)
+	default:
+		return ErrInvalidCarrier
+	}
+}
+
+func (p *propagatorBinary) injectBinary(spanCtx ddtrace.SpanContext, writer BinaryWriter) error {
+	ctx, ok := spanCtx.(*spanContext)
+	if !ok || ctx.traceID.Empty() || ctx.spanID == 0 {
+		return ErrInvalidSpanContext
+	}
+	var tags [][2]string
+	if ctx.trace != nil {
+		ctx.trace.iteratePropagatingTags(func(k, v string) bool {
+			if strings.HasPrefix(k, "_dd.p.") && k != keyTraceID128 {
+				tags = append(tags, [2]string{k, v})
+			}
+			return true
+		})
+	}
+	var baggage [][2]string
+	if p.baggage {
+		ctx.ForeachBaggageItem(func(k, v string) bool {
+			baggage = append(baggage, [2]string{k, v})
+			return true
+		})
+	}
+	priority, hasPriority := ctx.SamplingPriority()
+
+	b := make([]byte, binaryHeaderLen, binaryHeaderLen+64)
+	b[0] = binaryVersion
+	copy(b[2:18], ctx.traceID[:])
+	binary.BigEndian.PutUint64(b[18:26], ctx.spanID)
+	if hasPriority {
+		b[1] |= binaryFlagPriority
+		b = append(b, byte(int8(priority)))
+	}
+	if ctx.origin != "" {
+		b[1] |= binaryFlagOrigin
+		b = appendBinaryString(b, ctx.origin)
+	}
+	if len(tags) > 0 {
+		b[1] |= binaryFlagTags
+		b = appendBinaryPairs(b, tags)
+	}
+	if len(baggage) > 0 {
+		b[1] |= binaryFlagBaggage
+		b = appendBinaryPairs(b, baggage)
+	}
+	return writer.WriteBinary(b)
+}
+
+func appendBinaryString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func appendBinaryPairs(b []byte, pairs [][2]string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(pairs)))
+	for _, kv := range pairs {
+		b = appendBinaryString(b, kv[0])
+		b = appendBinaryString(b, kv[1])
+	}
+	return b
+}
+
+func (p *propagatorBinary) Extract(carrier interface{}) (ddtrace.SpanContext, error) {
+	switch c := carrier.(type) {
+	case BinaryReader:
+		return p.extractBinary(c)
+	default:
+		return nil, ErrInvalidCarrier
+	}
+}
+
+func (p *propagatorBinary) extractBinary(reader BinaryReader) (ddtrace.SpanContext, error) {
+	b, err := reader.ReadBinary()
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, ErrSpanContextNotFound
+	}
+	if len(b) < binaryHeaderLen || b[0] != binaryVersion {
+		return nil, ErrSpanContextCorrupted
+	}
+	var ctx spanContext
+	flags := b[1]
+	copy(ctx.traceID[:], b[2:18])
+	ctx.spanID = binary.BigEndian.Uint64(b[18:26])
+	d := binaryDecoder{b: b[binaryHeaderLen:]}
+	if flags&binaryFlagPriority != 0 {
+		if len(d.b) == 0 {
+			return nil, ErrSpanContextCorrupted
+		}
+		ctx.setSamplingPriority(int(int8(d.b[0])), samplernames.Unknown)
+		d.b = d.b[1:]
+	}
+	if flags&binaryFlagOrigin != 0 {
+		ctx.origin = d.string()
+	}
+	if flags&binaryFlagTags != 0 {
+		d.pairs(func(k, v string) {
+			// the trace ID's upper bits are set from the trace ID below
+			if strings.HasPrefix(k, "_dd.p.") && k != keyTraceID128 {
+				setPropagatingTag(&ctx, k, v)
+			}
+		})
+	}
+	if flags&binaryFlagBaggage != 0 {
+		d.pairs(func(k, v string) {
+			if p.baggage {
+				ctx.setBaggageItem(k, v)
+			}
+		})
+	}
+	if d.err {
+		return nil, ErrSpanContextCorrupted
+	}
+	if ctx.traceID.HasUpper() {
+		setPropagatingTag(&ctx, keyTraceID128, ctx.traceID.UpperHex())
+	}
+	if ctx.traceID.Empty() || (ctx.spanID == 0 && ctx.origin != "synthetics") {
+		return nil, ErrSpanContextNotFound
+	}
+	return &ctx, nil
+}
+
+// binaryDecoder reads length-prefixed values from b. Once a malformed value
+// is found, err is set and all subsequent reads return zero values.
+type binaryDecoder struct {
+	b   []byte
+	err bool
+}
+
+func (d *binaryDecoder) uvarint() uint64 {
+	if d.err {
+		return 0
+	}
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.err = true
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *binaryDecoder) string() string {
+	n := d.uvarint()
+	if d.err || n > uint64(len(d.b)) {
+		d.err = true
+		return ""
+	}
+	s := string(d.b[:n])
+	d.b = d.b[n:]
+	return s
+}
+
+func (d *binaryDecoder) pairs(f func(k, v string)) {
+	n := d.uvarint()
+	for i := uint64(0); i < n && !d.err; i++ {
+		k, v := d.string(), d.string()
+		if !d.err {
+			f(k, v)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package tracer
+
+import (
+	"errors"
+	"testing"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type limitedBinaryCarrier struct{ max int }
+
+func (c limitedBinaryCarrier) WriteBinary(b []byte) error {
+	if len(b) > c.max {
+		return errors.New("too large")
+	}
+	return nil
+}
+
+func TestBinaryPropagation(t *testing.T) {
+	t.Run("round-trip", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer := newTracer()
+		defer tracer.Stop()
+		root := tracer.StartSpan("web.request").(*span)
+		root.SetTag(ext.SamplingPriority, -1)
+		root.SetBaggageItem("item", "x")
+		ctx := root.Context().(*spanContext)
+		ctx.traceID.SetUpper(0xcafe)
+		ctx.origin = "synthetics"
+		ctx.trace.setPropagatingTag("_dd.p.dm", "-4")
+		ctx.trace.setPropagatingTag("tracestate", "dd=s:-1")
+
+		var c BinaryCarrier
+		require.NoError(t, tracer.Inject(ctx, &c))
+		sctx, err := tracer.Extract(c)
+		require.NoError(t, err)
+		got := sctx.(*spanContext)
+		assert.Equal(ctx.traceID, got.traceID)
+		assert.Equal(ctx.spanID, got.spanID)
+		assert.Equal("synthetics", got.origin)
+		assert.Empty(got.baggageItem("item"), "baggage is opt-in")
+		p, ok := got.SamplingPriority()
+		assert.True(ok)
+		assert.Equal(-1, p)
+		assert.Equal(map[string]string{
+			"_dd.p.dm":  "-4",
+			"_dd.p.tid": "000000000000cafe",
+		}, got.trace.propagatingTags)
+	})
+
+	t.Run("baggage", func(t *testing.T) {
+		ctx := &spanContext{spanID: 2}
+		ctx.traceID.SetLower(1)
+		ctx.setBaggageItem("item", "x")
+		var c BinaryCarrier
+		p := NewPropagator(&PropagatorConfig{BinaryBaggage: true})
+		require.NoError(t, p.Inject(ctx, &c))
+		sctx, err := p.Extract(c)
+		require.NoError(t, err)
+		assert.Equal(t, "x", sctx.(*spanContext).baggageItem("item"))
+
+		// baggage written by a peer is skipped when not enabled
+		sctx, err = NewPropagator(nil).Extract(c)
+		require.NoError(t, err)
+		assert.Empty(t, sctx.(*spanContext).baggageItem("item"))
+	})
+
+	t.Run("invalid-tags", func(t *testing.T) {
+		b := make([]byte, binaryHeaderLen)
+		b[0], b[1] = binaryVersion, binaryFlagTags
+		b[17], b[25] = 1, 2
+		b = appendBinaryPairs(b, [][2]string{
+			{"_dd.p.dm", "-4"},
+			{"_dd.p.tid", "000000000000cafe"},
+			{"tracestate", "dd=s:1"},
+			{"_dd.origin", "synthetics"},
+		})
+		sctx, err := NewPropagator(nil).Extract(BinaryCarrier(b))
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"_dd.p.dm": "-4"}, sctx.(*spanContext).trace.propagatingTags)
+	})
+
+	t.Run("minimal", func(t *testing.T) {
+		assert := assert.New(t)
+		var c BinaryCarrier
+		ctx := &spanContext{spanID: 2}
+		ctx.traceID.SetLower(1)
+		assert.NoError((&propagatorBinary{}).Inject(ctx, &c))
+		assert.Len(c, binaryHeaderLen)
+		sctx, err := (&propagatorBinary{}).Extract(c)
+		assert.NoError(err)
+		assert.Equal(uint64(1), sctx.TraceID())
+		assert.Equal(uint64(2), sctx.SpanID())
+	})
+
+	t.Run("writer-error", func(t *testing.T) {
+		ctx := &spanContext{spanID: 2}
+		ctx.traceID.SetLower(1)
+		ctx.origin = "synthetics"
+		err := (&propagatorBinary{}).Inject(ctx, limitedBinaryCarrier{max: binaryHeaderLen})
+		assert.EqualError(t, err, "too large")
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		assert := assert.New(t)
+		p := NewPropagator(nil)
+		_, err := p.Extract(BinaryCarrier(nil))
+		assert.Equal(ErrSpanContextNotFound, err)
+		_, err = p.Extract(BinaryCarrier{2, 0, 1})
+		assert.Equal(ErrSpanContextCorrupted, err)
+
+		ctx := &spanContext{spanID: 2}
+		ctx.traceID.SetLower(1)
+		ctx.origin = "synthetics"
+		var c BinaryCarrier
+		assert.NoError(p.Inject(ctx, &c))
+		_, err = p.Extract(c[:len(c)-1])
+		assert.Equal(ErrSpanContextCorrupted, err)
+		assert.Equal(ErrInvalidSpanContext, p.Inject(&spanContext{}, &c))
+	})
+}
@@ -0,0 +1,269 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package tracer
+
+import (
+	"encoding/base64"
+	"os"
+	"strings"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+)
+
+// MultiTextMapCarrier allows the use of a map[string][]string as both TextMapWriter
+// and TextMapReader. Unlike HTTPHeadersCarrier, keys are stored as given, without
+// any canonicalization.
+type MultiTextMapCarrier map[string][]string
+
+var _ TextMapWriter = (*MultiTextMapCarrier)(nil)
+var _ TextMapReader = (*MultiTextMapCarrier)(nil)
+
+// Set implements TextMapWriter. Any existing values at key are replaced.
+func (c MultiTextMapCarrier) Set(key, val string) {
+	c[key] = []string{val}
+}
+
+// ForeachKey implements TextMapReader.
+func (c MultiTextMapCarrier) ForeachKey(handler func(key, val string) error) error {
+	for k, vals := range c {
+		for _, v := range vals {
+			if err := handler(k, v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// GRPCMetadataCarrier allows the use of gRPC metadata (metadata.MD) as both
+// TextMapWriter and TextMapReader. Keys are lowercased when set, as required
+// by the gRPC metadata implementation.
+type GRPCMetadataCarrier map[string][]string
+
+var _ TextMapWriter = (*GRPCMetadataCarrier)(nil)
+var _ TextMapReader = (*GRPCMetadataCarrier)(nil)
+
+// Set implements TextMapWriter. Any existing values at the lowercased key are replaced.
+func (c GRPCMetadataCarrier) Set(key, val string) {
+	c[strings.ToLower(key)] = []string{val}
+}
+
+// ForeachKey implements TextMapReader.
+func (c GRPCMetadataCarrier) ForeachKey(handler func(key, val string) error) error {
+	return MultiTextMapCarrier(c).ForeachKey(handler)
+}
+
+// HeaderEncoding specifies how string values are stored into byte-valued headers.
+type HeaderEncoding int
+
+const (
+	// HeaderEncodingRaw stores values as their raw bytes. It is the default.
+	HeaderEncodingRaw HeaderEncoding = iota
+
+	// HeaderEncodingBase64 stores values using standard base64 encoding, for
+	// transports which require header values to be encoded. Both the producer
+	// and the consumer must use it: when reading, headers whose values are not
+	// valid base64 are skipped.
+	HeaderEncodingBase64
+)
+
+func (e HeaderEncoding) encode(val string) []byte {
+	if e == HeaderEncodingBase64 {
+		buf := make([]byte, base64.StdEncoding.EncodedLen(len(val)))
+		base64.StdEncoding.Encode(buf, []byte(val))
+		return buf
+	}
+	return []byte(val)
+}
+
+// decode returns the string value stored in val. It returns false if val is
+// not valid for the encoding.
+func (e HeaderEncoding) decode(val []byte) (string, bool) {
+	if e == HeaderEncodingBase64 {
+		buf := make([]byte, base64.StdEncoding.DecodedLen(len(val)))
+		n, err := base64.StdEncoding.Decode(buf, val)
+		if err != nil {
+			return "", false
+		}
+		return string(buf[:n]), true
+	}
+	return string(val), true
+}
+
+// CarrierOption is a configuration option for carriers created by NewHeaderListCarrier
+// and NewBytesHeadersCarrier.
+type CarrierOption func(cfg *carrierConfig)
+
+type carrierConfig struct {
+	encoding HeaderEncoding
+}
+
+// WithHeaderEncoding sets the encoding used to store values into byte-valued headers.
+// It defaults to HeaderEncodingRaw.
+func WithHeaderEncoding(enc HeaderEncoding) CarrierOption {
+	return func(cfg *carrierConfig) {
+		cfg.encoding = enc
+	}
+}
+
+// HeaderListCarrier implements TextMapWriter and TextMapReader on top of a list of
+// byte-valued headers of any type H, such as the header lists found in most message
+// queue clients (e.g. []sarama.RecordHeader or []kafka.Header). Keys are unique
+// within the list: setting a key removes any previous header with the same key.
+type HeaderListCarrier[H any] struct {
+	headers *[]H
+	read    func(h H) (key string, val []byte)
+	build   func(key string, val []byte) H
+	cfg     carrierConfig
+}
+
+var _ TextMapWriter = (*HeaderListCarrier[BytesHeader])(nil)
+var _ TextMapReader = (*HeaderListCarrier[BytesHeader])(nil)
+
+// NewHeaderListCarrier returns a carrier operating on the list of headers pointed to by
+// headers. The read function returns the key and value of a header; headers for which it
+// returns an empty key (e.g. nil entries) are skipped. The build function creates a new
+// header from the given key and value.
+func NewHeaderListCarrier[H any](headers *[]H, read func(h H) (key string, val []byte), build func(key string, val []byte) H, opts ...CarrierOption) HeaderListCarrier[H] {
+	c := HeaderListCarrier[H]{
+		headers: headers,
+		read:    read,
+		build:   build,
+	}
+	for _, fn := range opts {
+		fn(&c.cfg)
+	}
+	return c
+}
+
+// Set implements TextMapWriter.
+func (c HeaderListCarrier[H]) Set(key, val string) {
+	hs := (*c.headers)[:0]
+	for _, h := range *c.headers {
+		if k, _ := c.read(h); k != key {
+			hs = append(hs, h)
+		}
+	}
+	*c.headers = append(hs, c.build(key, c.cfg.encoding.encode(val)))
+}
+
+// ForeachKey implements TextMapReader.
+func (c HeaderListCarrier[H]) ForeachKey(handler func(key, val string) error) error {
+	for _, h := range *c.headers {
+		k, v := c.read(h)
+		if k == "" {
+			continue
+		}
+		val, ok := c.cfg.encoding.decode(v)
+		if !ok {
+			continue
+		}
+		if err := handler(k, val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BytesHeader is a generic header having a string key and an opaque byte-slice value.
+type BytesHeader struct {
+	Key   string
+	Value []byte
+}
+
+// NewBytesHeadersCarrier returns a carrier operating on the given list of BytesHeader.
+func NewBytesHeadersCarrier(headers *[]BytesHeader, opts ...CarrierOption) HeaderListCarrier[BytesHeader] {
+	return NewHeaderListCarrier(headers,
+		func(h BytesHeader) (string, []byte) { return h.Key, h.Value },
+		func(key string, val []byte) BytesHeader { return BytesHeader{Key: key, Value: val} },
+		opts...)
+}
+
+// EnvCarrier allows the use of a list of environment variables in the "key=value"
+// form, such as the one returned by os.Environ or used by exec.Cmd.Env, as both
+// TextMapWriter and TextMapReader. Keys are converted to environment variable
+// names by upper-casing them and replacing dashes with underscores, so that
+// for example "traceparent" is stored as TRACEPARENT and "x-datadog-trace-id"
+// as X_DATADOG_TRACE_ID.
+//
+// When reading, the conversion is only reversed for the names of the headers
+// used by the default propagators, and for baggage items, whose names keep
+// their underscores but are lower-cased. As the conversion is lossy, baggage
+// keys containing dashes or upper-case letters don't survive a round trip:
+// "user-id" is read back as "user_id" and "userID" as "userid". Other
+// variables are passed to the handler unchanged.
+type EnvCarrier []string
+
+var _ TextMapWriter = (*EnvCarrier)(nil)
+var _ TextMapReader = (*EnvCarrier)(nil)
+
+// Set implements TextMapWriter. Any existing variable with the same name is replaced.
+func (c *EnvCarrier) Set(key, val string) {
+	name := envName(key)
+	env := (*c)[:0]
+	for _, kv := range *c {
+		if k, _, _ := strings.Cut(kv, "="); k != name {
+			env = append(env, kv)
+		}
+	}
+	*c = append(env, name+"="+val)
+}
+
+func envName(key string) string {
+	return strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+}
+
+// envHeaders maps the environment variable names of the headers used by the
+// default propagators back to the header names.
+var envHeaders = func() map[string]string {
+	m := make(map[string]string)
+	for _, h := range []string{
+		DefaultTraceIDHeader,
+		DefaultParentIDHeader,
+		DefaultPriorityHeader,
+		originHeader,
+		traceTagsHeader,
+		b3TraceIDHeader,
+		b3SpanIDHeader,
+		b3SampledHeader,
+		b3SingleHeader,
+		traceparentHeader,
+		tracestateHeader,
+	} {
+		m[envName(h)] = h
+	}
+	return m
+}()
+
+// envBaggagePrefix is the environment variable name prefix of baggage items.
+var envBaggagePrefix = envName(DefaultBaggageHeaderPrefix)
+
+// ForeachKey implements TextMapReader.
+func (c EnvCarrier) ForeachKey(handler func(key, val string) error) error {
+	for _, kv := range c {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			continue
+		}
+		if h, ok := envHeaders[k]; ok {
+			k = h
+		} else if strings.HasPrefix(k, envBaggagePrefix) {
+			k = DefaultBaggageHeaderPrefix + strings.ToLower(strings.TrimPrefix(k, envBaggagePrefix))
+		}
+		if err := handler(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExtractFromEnv extracts a SpanContext from the environment of the current process,
+// as injected by a parent process using an EnvCarrier. It is meant to be called by
+// child processes at startup, once the tracer is started, to continue the trace
+// of their parent.
+func ExtractFromEnv() (ddtrace.SpanContext, error) {
+	return Extract(EnvCarrier(os.Environ()))
+}
@@ -0,0 +1,193 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package tracer
+
+import (
+	"errors"
+	"testing"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultiTextMapCarrier(t *testing.T) {
+	assert := assert.New(t)
+	c := MultiTextMapCarrier{"X-Key": []string{"a", "b"}}
+	c.Set("X-Key", "c")
+	c.Set("other", "d")
+	assert.Equal([]string{"c"}, c["X-Key"])
+	assert.Equal([]string{"d"}, c["other"])
+
+	got := map[string]string{}
+	err := c.ForeachKey(func(k, v string) error {
+		got[k] = v
+		return nil
+	})
+	assert.NoError(err)
+	assert.Equal(map[string]string{"X-Key": "c", "other": "d"}, got)
+}
+
+func TestGRPCMetadataCarrier(t *testing.T) {
+	c := GRPCMetadataCarrier{}
+	c.Set("X-Datadog-Trace-Id", "1")
+	assert.Equal(t, GRPCMetadataCarrier{"x-datadog-trace-id": []string{"1"}}, c)
+}
+
+func TestHeaderListCarrier(t *testing.T) {
+	type header struct {
+		Key   []byte
+		Value []byte
+	}
+	read := func(h *header) (string, []byte) {
+		if h == nil {
+			return "", nil
+		}
+		return string(h.Key), h.Value
+	}
+	build := func(k string, v []byte) *header {
+		return &header{Key: []byte(k), Value: v}
+	}
+
+	t.Run("set", func(t *testing.T) {
+		assert := assert.New(t)
+		headers := []*header{nil, {Key: []byte("a"), Value: []byte("1")}, {Key: []byte("b"), Value: []byte("2")}}
+		c := NewHeaderListCarrier(&headers, read, build)
+		c.Set("a", "3")
+		assert.Len(headers, 3)
+		assert.Equal("b", string(headers[1].Key))
+		assert.Equal("3", string(headers[2].Value))
+	})
+
+	t.Run("foreach", func(t *testing.T) {
+		headers := []*header{nil, {Key: []byte("a"), Value: []byte("1")}}
+		got := map[string]string{}
+		err := NewHeaderListCarrier(&headers, read, build).ForeachKey(func(k, v string) error {
+			got[k] = v
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"a": "1"}, got)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		want := errors.New("random error")
+		headers := []*header{{Key: []byte("a"), Value: []byte("1")}}
+		got := NewHeaderListCarrier(&headers, read, build).ForeachKey(func(k, v string) error {
+			return want
+		})
+		assert.Equal(t, want, got)
+	})
+}
+
+func TestBytesHeadersCarrier(t *testing.T) {
+	tracer := newTracer()
+	defer tracer.Stop()
+	root := tracer.StartSpan("web.request").(*span)
+	root.SetTag(ext.SamplingPriority, -1)
+	root.SetBaggageItem("item", "x")
+	ctx := root.Context()
+
+	for name, enc := range map[string]HeaderEncoding{
+		"raw":    HeaderEncodingRaw,
+		"base64": HeaderEncodingBase64,
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			var headers []BytesHeader
+			c := NewBytesHeadersCarrier(&headers, WithHeaderEncoding(enc))
+			assert.NoError(tracer.Inject(ctx, c))
+			assert.NotEmpty(headers)
+
+			sctx, err := tracer.Extract(c)
+			assert.NoError(err)
+			assert.Equal(ctx.TraceID(), sctx.TraceID())
+			assert.Equal(ctx.SpanID(), sctx.SpanID())
+			p, _ := sctx.(*spanContext).SamplingPriority()
+			assert.Equal(-1, p)
+		})
+	}
+
+	t.Run("base64", func(t *testing.T) {
+		headers := []BytesHeader{{Key: "k", Value: []byte("not base64!")}}
+		c := NewBytesHeadersCarrier(&headers, WithHeaderEncoding(HeaderEncodingBase64))
+		c.Set("x", "y")
+		assert.Equal(t, "eQ==", string(headers[1].Value))
+		got := map[string]string{}
+		c.ForeachKey(func(k, v string) error {
+			got[k] = v
+			return nil
+		})
+		assert.Equal(t, map[string]string{"x": "y"}, got, "invalid base64 is skipped")
+	})
+
+	t.Run("mismatched-encoding", func(t *testing.T) {
+		// A raw value which happens to be valid base64 is decoded when the reader
+		// expects base64, which is why both ends must use the same encoding.
+		headers := []BytesHeader{{Key: "x-datadog-parent-id", Value: []byte("1234")}}
+		var got string
+		NewBytesHeadersCarrier(&headers, WithHeaderEncoding(HeaderEncodingBase64)).ForeachKey(func(_, v string) error {
+			got = v
+			return nil
+		})
+		assert.NotEqual(t, "1234", got)
+		_, err := tracer.Extract(NewBytesHeadersCarrier(&headers, WithHeaderEncoding(HeaderEncodingBase64)))
+		assert.Error(t, err)
+	})
+}
+
+func TestEnvCarrier(t *testing.T) {
+	t.Run("set", func(t *testing.T) {
+		c := EnvCarrier{"PATH=/bin", "X_DATADOG_TRACE_ID=1"}
+		c.Set("x-datadog-trace-id", "2")
+		c.Set("traceparent", "00-x")
+		assert.Equal(t, EnvCarrier{"PATH=/bin", "X_DATADOG_TRACE_ID=2", "TRACEPARENT=00-x"}, c)
+	})
+
+	t.Run("foreach", func(t *testing.T) {
+		got := map[string]string{}
+		err := EnvCarrier{"X_DATADOG_PARENT_ID=1=2", "invalid", "=x", "PATH=/bin"}.ForeachKey(func(k, v string) error {
+			got[k] = v
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"x-datadog-parent-id": "1=2", "PATH": "/bin"}, got)
+	})
+
+	t.Run("baggage", func(t *testing.T) {
+		var c EnvCarrier
+		c.Set("ot-baggage-user_id", "1")
+		c.Set("ot-baggage-request-id", "2")
+		c.Set("ot-baggage-userName", "3")
+		assert.Equal(t, EnvCarrier{"OT_BAGGAGE_USER_ID=1", "OT_BAGGAGE_REQUEST_ID=2", "OT_BAGGAGE_USERNAME=3"}, c)
+		got := map[string]string{}
+		c.ForeachKey(func(k, v string) error {
+			got[k] = v
+			return nil
+		})
+		// dashes and upper-case letters in baggage keys are lost, see EnvCarrier
+		assert.Equal(t, map[string]string{
+			"ot-baggage-user_id":    "1",
+			"ot-baggage-request_id": "2",
+			"ot-baggage-username":   "3",
+		}, got)
+	})
+
+	t.Run("propagation", func(t *testing.T) {
+		tracer := newTracer()
+		defer tracer.Stop()
+		root := tracer.StartSpan("web.request")
+		root.SetBaggageItem("item", "x")
+		var c EnvCarrier
+		assert.NoError(t, tracer.Inject(root.Context(), &c))
+		assert.Contains(t, c, "OT_BAGGAGE_ITEM=x")
+
+		sctx, err := tracer.Extract(c)
+		assert.NoError(t, err)
+		assert.Equal(t, root.Context().TraceID(), sctx.TraceID())
+		assert.Equal(t, root.Context().SpanID(), sctx.SpanID())
+	})
+}
@@ -44,6 +44,7 @@ func SetDataStreamsCheckpointWithParams(ctx context.Context, params options.Chec
 }
 
 // TrackKafkaCommitOffset should be used in the consumer, to track when it acks offset.
+// As with Kafka commits, offset is the offset of the next message to consume.
 // if used together with TrackKafkaProduceOffset it can generate a Kafka lag in seconds metric.
 func TrackKafkaCommitOffset(group, topic string, partition int32, offset int64) {
 	if t, ok := internal.GetGlobalTracer().(dataStreamsContainer); ok {
@@ -53,6 +54,17 @@ func TrackKafkaCommitOffset(group, topic string, partition int32, offset int64)
 	}
 }
 
+// TrackKafkaHighWatermarkOffset should be used in the consumer, to track the
+// high watermark of a partition as reported by the broker. It is used to
+// compute the Kafka lag when the partition isn't produced to by this process.
+func TrackKafkaHighWatermarkOffset(topic string, partition int32, offset int64) {
+	if t, ok := internal.GetGlobalTracer().(dataStreamsContainer); ok {
+		if p := t.GetDataStreamsProcessor(); p != nil {
+			p.TrackKafkaHighWatermarkOffset(topic, partition, offset)
+		}
+	}
+}
+
 // TrackKafkaProduceOffset should be used in the producer, to track when it produces a message.
 // if used together with TrackKafkaCommitOffset it can generate a Kafka lag in seconds metric.
 func TrackKafkaProduceOffset(topic string, partition int32, offset int64) {
@@ -62,3 +74,38 @@ func TrackKafkaProduceOffset(topic string, partition int32, offset int64) {
 		}
 	}
 }
+
+// TrackDataStreamsProduceOffset should be used in the producer, to track when
+// it produces a message to a partition of a queue of the given type. It is the
+// transport-agnostic version of TrackKafkaProduceOffset, see
+// datastreams.TrackProduceOffset.
+func TrackDataStreamsProduceOffset(queueType, queue string, partition int32, offset int64) {
+	if t, ok := internal.GetGlobalTracer().(dataStreamsContainer); ok {
+		if p := t.GetDataStreamsProcessor(); p != nil {
+			p.TrackProduceOffset(queueType, queue, partition, offset)
+		}
+	}
+}
+
+// TrackDataStreamsConsumeOffset should be used in the consumer, in the given
+// group if any, to track when it acks an offset of a partition of a queue of
+// the given type. offset is the offset of the next message to consume. It is
+// the transport-agnostic version of TrackKafkaCommitOffset, see
+// datastreams.TrackConsumeOffset.
+func TrackDataStreamsConsumeOffset(queueType, group, queue string, partition int32, offset int64) {
+	if t, ok := internal.GetGlobalTracer().(dataStreamsContainer); ok {
+		if p := t.GetDataStreamsProcessor(); p != nil {
+			p.TrackConsumeOffset(queueType, group, queue, partition, offset)
+		}
+	}
+}
+
+// TrackDataStreamsTransaction records that the transaction with the given
+// user-defined ID reached the named checkpoint, see datastreams.TrackTransaction.
+func TrackDataStreamsTransaction(ctx context.Context, checkpointName, transactionID string) {
+	if t, ok := internal.GetGlobalTracer().(dataStreamsContainer); ok {
+		if p := t.GetDataStreamsProcessor(); p != nil {
+			p.TrackTransaction(ctx, checkpointName, transactionID)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package tracer
+
+import (
+	"context"
+	"testing"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/datastreams"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataStreamsSink(t *testing.T) {
+	t.Setenv("DD_DATA_STREAMS_ENABLED", "true")
+	sink := datastreams.NewMemorySink()
+	trc, _, _, stop := startTestTracer(t, WithDataStreamsSink(sink), WithService("service-1"))
+	defer stop()
+	require.NotNil(t, trc.dataStreams)
+	trc.dataStreams.Start()
+
+	_, ok := SetDataStreamsCheckpoint(context.Background(), "direction:out", "topic:topic1", "type:kafka")
+	assert.True(t, ok)
+	Flush()
+
+	payloads := sink.Payloads()
+	require.Len(t, payloads, 1)
+	assert.Equal(t, "service-1", payloads[0].Service)
+	require.NotEmpty(t, payloads[0].Stats)
+	assert.Equal(t, []string{"direction:out", "topic:topic1", "type:kafka"}, payloads[0].Stats[0].Stats[0].EdgeTags)
+}
+
+func TestDataStreamsLagMetrics(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		c := newConfig()
+		assert.False(t, c.dataStreamsLagMetrics)
+	})
+	t.Run("env", func(t *testing.T) {
+		t.Setenv("DD_DATA_STREAMS_LAG_METRICS_ENABLED", "true")
+		c := newConfig()
+		assert.True(t, c.dataStreamsLagMetrics)
+	})
+	t.Run("option", func(t *testing.T) {
+		t.Setenv("DD_DATA_STREAMS_LAG_METRICS_ENABLED", "true")
+		c := newConfig(WithDataStreamsLagMetrics(false))
+		assert.False(t, c.dataStreamsLagMetrics)
+	})
+}
@@ -51,3 +51,31 @@ func doSomething(ctx context.Context) (err error) {
 	}
 	return ctx.Err()
 }
+
+// queueHeader is the header type of an in-house message queue client.
+type queueHeader struct {
+	Key   []byte
+	Value []byte
+}
+
+// An example showing how to propagate span contexts through any list of
+// byte-valued message headers.
+func ExampleNewHeaderListCarrier() {
+	var headers []queueHeader
+	carrier := tracer.NewHeaderListCarrier(&headers,
+		func(h queueHeader) (string, []byte) { return string(h.Key), h.Value },
+		func(key string, val []byte) queueHeader { return queueHeader{Key: []byte(key), Value: val} },
+	)
+
+	span := tracer.StartSpan("queue.produce")
+	defer span.Finish()
+	if err := tracer.Inject(span.Context(), carrier); err != nil {
+		// handle the error
+	}
+
+	// On the consumer side, extract the span context from the received headers.
+	if sctx, err := tracer.Extract(carrier); err == nil {
+		consume := tracer.StartSpan("queue.consume", tracer.ChildOf(sctx))
+		consume.Finish()
+	}
+}
@@ -25,6 +25,7 @@ import (
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/datastreams"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/globalconfig"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/namingschema"
@@ -80,9 +81,12 @@ var contribIntegrations = map[string]struct {
 	"github.com/labstack/echo":                      {"echo", false},
 	"github.com/labstack/echo/v4":                   {"echo v4", false},
 	"github.com/miekg/dns":                          {"miekg/dns", false},
+	"github.com/nats-io/nats.go":                    {"NATS", false},
 	"net/http":                                      {"HTTP", false},
+	"os/exec":                                       {"os/exec", false},
 	"gopkg.in/olivere/elastic.v5":                   {"Elasticsearch v5", false},
 	"gopkg.in/olivere/elastic.v3":                   {"Elasticsearch v3", false},
+	"github.com/rabbitmq/amqp091-go":                {"RabbitMQ", false},
 	"github.com/redis/go-redis/v9":                  {"Redis v9", false},
 	"github.com/segmentio/kafka-go":                 {"Kafka v0", false},
 	"github.com/IBM/sarama":                         {"IBM sarama", false},
@@ -250,6 +254,14 @@ type config struct {
 	// dataStreamsMonitoringEnabled specifies whether the tracer should enable monitoring of data streams
 	dataStreamsMonitoringEnabled bool
 
+	// dataStreamsSink receives the data streams stats instead of the agent, if set.
+	dataStreamsSink datastreams.Sink
+
+	// dataStreamsLagMetrics specifies whether the consumer lag should be
+	// computed from the offsets tracked by data streams monitoring, and
+	// reported with statsd.
+	dataStreamsLagMetrics bool
+
 	// orchestrionCfg holds Orchestrion (aka auto-instrumentation) configuration.
 	// Only used for telemetry currently.
 	orchestrionCfg orchestrionConfig
@@ -351,6 +363,7 @@ func newConfig(opts ...StartOption) *config {
 	}
 	c.statsComputationEnabled = internal.BoolEnv("DD_TRACE_STATS_COMPUTATION_ENABLED", false)
 	c.dataStreamsMonitoringEnabled = internal.BoolEnv("DD_DATA_STREAMS_ENABLED", false)
+	c.dataStreamsLagMetrics = internal.BoolEnv("DD_DATA_STREAMS_LAG_METRICS_ENABLED", false)
 	c.partialFlushEnabled = internal.BoolEnv("DD_TRACE_PARTIAL_FLUSH_ENABLED", false)
 	c.partialFlushMinSpans = internal.IntEnv("DD_TRACE_PARTIAL_FLUSH_MIN_SPANS", partialFlushMinSpansDefault)
 	if c.partialFlushMinSpans <= 0 {
@@ -1096,6 +1109,33 @@ func WithStatsComputation(enabled bool) StartOption {
 	}
 }
 
+// WithDataStreamsSink sends the stats computed by Data Streams Monitoring to
+// sink instead of the agent, e.g. to analyze them offline with
+// datastreams.NewJSONLinesSink. Data Streams Monitoring must be enabled, by
+// setting DD_DATA_STREAMS_ENABLED to true.
+func WithDataStreamsSink(sink datastreams.Sink) StartOption {
+	return func(c *config) {
+		c.dataStreamsSink = sink
+	}
+}
+
+// WithDataStreamsLagMetrics enables the computation of the lag of the
+// consumers of each topic partition, in offsets and in seconds, from the
+// produce and commit offsets tracked by Data Streams Monitoring, e.g. by the
+// Kafka integrations. The lag is reported with the statsd client of the
+// tracer, as the datadog.datastreams.consumer_lag.offsets and
+// datadog.datastreams.consumer_lag.seconds gauges, tagged with the type of the
+// queue, the topic, the partition and the consumer group. The lag in offsets
+// is computed from the high watermarks reported by the brokers to the Kafka
+// consumers, and the lag in seconds is only known for the partitions this
+// process also produces to. Data Streams Monitoring must be enabled. This can also be configured by setting
+// DD_DATA_STREAMS_LAG_METRICS_ENABLED to true.
+func WithDataStreamsLagMetrics(enabled bool) StartOption {
+	return func(c *config) {
+		c.dataStreamsLagMetrics = enabled
+	}
+}
+
 // WithOrchestrion configures Orchestrion's auto-instrumentation metadata.
 // This option is only intended to be used by Orchestrion https://github.com/DataDog/orchestrion
 func WithOrchestrion(metadata map[string]string) StartOption {
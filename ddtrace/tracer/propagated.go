@@ -0,0 +1,70 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package tracer
+
+import (
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/internal"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/samplernames"
+)
+
+func init() {
+	internal.NewPropagatedSpanContext = newPropagatedSpanContext
+	internal.PropagatedContextOf = propagatedContextOf
+}
+
+// newPropagatedSpanContext returns a span context holding pc, which can be
+// injected using the Propagators returned by NewPropagator.
+func newPropagatedSpanContext(pc internal.PropagatedContext) ddtrace.SpanContext {
+	ctx := &spanContext{
+		traceID: pc.TraceID,
+		spanID:  pc.SpanID,
+		origin:  pc.Origin,
+	}
+	for k, v := range pc.Tags {
+		setPropagatingTag(ctx, k, v)
+	}
+	if pc.HasSamplingPriority {
+		ctx.setSamplingPriority(pc.SamplingPriority, samplernames.Unknown)
+	}
+	for k, v := range pc.Baggage {
+		ctx.setBaggageItem(k, v)
+	}
+	return ctx
+}
+
+// propagatedContextOf returns the propagated parts of a span context created
+// by this package, e.g. one returned by Propagator.Extract. It returns false
+// if ctx was created by another ddtrace.Tracer implementation.
+func propagatedContextOf(ctx ddtrace.SpanContext) (internal.PropagatedContext, bool) {
+	sc, ok := ctx.(*spanContext)
+	if !ok {
+		return internal.PropagatedContext{}, false
+	}
+	pc := internal.PropagatedContext{
+		TraceID: sc.traceID,
+		SpanID:  sc.spanID,
+		Origin:  sc.origin,
+	}
+	pc.SamplingPriority, pc.HasSamplingPriority = sc.SamplingPriority()
+	if sc.trace != nil {
+		sc.trace.iteratePropagatingTags(func(k, v string) bool {
+			if pc.Tags == nil {
+				pc.Tags = make(map[string]string)
+			}
+			pc.Tags[k] = v
+			return true
+		})
+	}
+	sc.ForeachBaggageItem(func(k, v string) bool {
+		if pc.Baggage == nil {
+			pc.Baggage = make(map[string]string)
+		}
+		pc.Baggage[k] = v
+		return true
+	})
+	return pc, true
+}
@@ -0,0 +1,54 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package tracer
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/internal"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPropagatedContext(t *testing.T) {
+	t.Setenv(headerPropagationStyleInject, "datadog")
+	assert := assert.New(t)
+	pc := internal.PropagatedContext{
+		SpanID:              2,
+		SamplingPriority:    ext.PriorityUserKeep,
+		HasSamplingPriority: true,
+		Origin:              "synthetics",
+		Tags:                map[string]string{"_dd.p.dm": "-4", "_dd.p.tid": "0000000000000003"},
+		Baggage:             map[string]string{"item": "x"},
+	}
+	pc.TraceID[7] = 3
+	pc.TraceID[15] = 1
+
+	ctx := internal.NewPropagatedSpanContext(pc)
+	got, ok := internal.PropagatedContextOf(ctx)
+	assert.True(ok)
+	assert.Equal(pc, got)
+
+	carrier := TextMapCarrier{}
+	p := NewPropagator(&PropagatorConfig{MaxTagsHeaderLen: defaultMaxTagsHeaderLen})
+	assert.NoError(p.Inject(ctx, carrier))
+	tags := strings.Split(carrier[traceTagsHeader], ",")
+	assert.ElementsMatch([]string{"_dd.p.dm=-4", "_dd.p.tid=0000000000000003"}, tags)
+	delete(carrier, traceTagsHeader)
+	assert.Equal(TextMapCarrier{
+		DefaultTraceIDHeader:                "1",
+		DefaultParentIDHeader:               "2",
+		DefaultPriorityHeader:               "2",
+		originHeader:                        "synthetics",
+		DefaultBaggageHeaderPrefix + "item": "x",
+	}, carrier)
+
+	_, ok = internal.PropagatedContextOf(internal.NoopSpanContext{})
+	assert.False(ok)
+	assert.Equal(ErrInvalidSpanContext, p.Inject(internal.NoopSpanContext{}, carrier))
+}
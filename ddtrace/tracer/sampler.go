@@ -72,6 +72,9 @@ func (r *rateSampler) Sample(spn ddtrace.Span) bool {
 		// fast path
 		return true
 	}
+	if spn == nil {
+		return false
+	}
 	s, ok := spn.(*span)
 	if !ok {
 		return false
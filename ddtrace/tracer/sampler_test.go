@@ -175,6 +175,7 @@ func TestRateSampler(t *testing.T) {
 	assert.False(NewRateSampler(0).Sample(newBasicSpan("test")))
 	assert.False(NewRateSampler(0).Sample(newBasicSpan("test")))
 	assert.False(NewRateSampler(0.99).Sample(internal.NoopSpan{}))
+	assert.False(NewRateSampler(0.99).Sample(nil))
 }
 
 func TestRateSamplerSetting(t *testing.T) {
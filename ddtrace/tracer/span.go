@@ -530,6 +530,9 @@ func (s *span) finish(finishTime int64) {
 		// a single kept span keeps the whole trace.
 		s.context.trace.keep()
 	}
+	if traceprof.ObservesSpan(s.Name) {
+		s.notifyObservers()
+	}
 	if log.DebugEnabled() {
 		// avoid allocating the ...interface{} argument if debug logging is disabled
 		log.Debug("Finished Span: %v, Operation: %s, Resource: %s, Tags: %v, %v",
@@ -538,6 +541,25 @@ func (s *span) finish(finishTime int64) {
 	s.context.finish()
 }
 
+// notifyObservers informs the span observers registered by the profiler
+// that s has finished. It must be called with s locked.
+func (s *span) notifyObservers() {
+	f := traceprof.FinishedSpan{
+		Name:     s.Name,
+		Service:  s.Service,
+		Resource: s.Resource,
+		SpanID:   s.SpanID,
+		Start:    time.Unix(0, s.Start),
+		Duration: time.Duration(s.Duration),
+		Error:    s.Error != 0,
+		Meta:     s.Meta,
+	}
+	if root := s.root(); root != nil {
+		f.LocalRootSpanID = root.SpanID
+	}
+	traceprof.ObserveSpan(f)
+}
+
 // newAggregableSpan creates a new summary for the span s, within an application
 // version version.
 func newAggregableSpan(s *span, obfuscator *obfuscate.Obfuscator) *aggregableSpan {
@@ -91,6 +91,56 @@ func TestSpanFinish(t *testing.T) {
 	assert.True(span.finished)
 }
 
+func TestSpanFinishObservers(t *testing.T) {
+	assert := assert.New(t)
+	tracer := newTracer(withTransport(newDefaultTransport()))
+	defer tracer.Stop()
+	var got []traceprof.FinishedSpan
+	observe := func(f traceprof.FinishedSpan) {
+		assert.Equal("bar", f.Meta["foo"])
+		got = append(got, f)
+	}
+	defer traceprof.AddSpanObserver("db.query", observe)()
+	defer traceprof.AddSpanObserver("pylons.request", observe)()
+
+	root := tracer.newRootSpan("pylons.request", "pylons", "/")
+	root.SetTag("foo", "bar")
+	tracer.newChildSpan("unobserved", root).Finish()
+	child := tracer.newChildSpan("db.query", root)
+	child.SetTag("foo", "bar")
+	child.SetTag(ext.Error, errors.New("boom"))
+	child.Finish()
+	root.Finish()
+
+	require.Len(t, got, 2)
+	assert.Equal("db.query", got[0].Name)
+	assert.True(got[0].Error)
+	assert.Equal(root.SpanID, got[0].LocalRootSpanID)
+	assert.Equal("pylons.request", got[1].Name)
+	assert.Equal("/", got[1].Resource)
+	assert.Equal(time.Duration(root.Duration), got[1].Duration)
+}
+
+func TestSpanStartObserver(t *testing.T) {
+	assert := assert.New(t)
+	tracer := newTracer(withTransport(newDefaultTransport()))
+	defer tracer.Stop()
+	var got []traceprof.StartedSpan
+	defer traceprof.SetSpanStartObserver(func(s traceprof.StartedSpan) {
+		got = append(got, s)
+	})()
+
+	span := tracer.StartSpan("pylons.request", ServiceName("pylons"), ResourceName("/"), Tag("hint", true)).(*span)
+	span.Finish()
+
+	require.Len(t, got, 1)
+	assert.Equal("pylons.request", got[0].Name)
+	assert.Equal("pylons", got[0].Service)
+	assert.Equal("/", got[0].Resource)
+	assert.Equal(span.SpanID, got[0].SpanID)
+	assert.Equal("true", got[0].Meta["hint"])
+}
+
 func TestSpanFinishTwice(t *testing.T) {
 	assert := assert.New(t)
 	wait := time.Millisecond * 2
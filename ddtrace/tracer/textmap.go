@@ -128,6 +128,11 @@ type PropagatorConfig struct {
 	// B3 specifies if B3 headers should be added for trace propagation.
 	// See https://github.com/openzipkin/b3-propagation
 	B3 bool
+
+	// BinaryBaggage specifies if baggage items should be carried by the binary
+	// encoding used for BinaryWriter and BinaryReader carriers. It is disabled
+	// by default, as baggage is unbounded in size.
+	BinaryBaggage bool
 }
 
 // NewPropagator returns a new propagator which uses TextMap to inject
@@ -157,6 +162,7 @@ func NewPropagator(cfg *PropagatorConfig, propagators ...Propagator) Propagator
 		cfg.PriorityHeader = DefaultPriorityHeader
 	}
 	cp := new(chainedPropagator)
+	cp.binary.baggage = cfg.BinaryBaggage
 	cp.onlyExtractFirst = internal.BoolEnv("DD_TRACE_PROPAGATION_EXTRACT_FIRST", false)
 	if len(propagators) > 0 {
 		cp.injectors = propagators
@@ -189,6 +195,7 @@ type chainedPropagator struct {
 	injectorNames    string
 	extractorsNames  string
 	onlyExtractFirst bool // value of DD_TRACE_PROPAGATION_EXTRACT_FIRST
+	binary           propagatorBinary
 }
 
 // getPropagators returns a list of propagators based on ps, which is a comma seperated
@@ -253,7 +260,12 @@ func getPropagators(cfg *PropagatorConfig, ps string) ([]Propagator, string) {
 // Inject defines the Propagator to propagate SpanContext data
 // out of the current process. The implementation propagates the
 // TraceID and the current active SpanID, as well as the Span baggage.
+// Carriers implementing BinaryWriter but not TextMapWriter receive the
+// binary encoding of the span context, regardless of the configured styles.
 func (p *chainedPropagator) Inject(spanCtx ddtrace.SpanContext, carrier interface{}) error {
+	if isBinaryCarrier(carrier) {
+		return p.binary.Inject(spanCtx, carrier)
+	}
 	for _, v := range p.injectors {
 		err := v.Inject(spanCtx, carrier)
 		if err != nil {
@@ -268,8 +280,12 @@ func (p *chainedPropagator) Inject(spanCtx ddtrace.SpanContext, carrier interfac
 // trace context that could be extracted will be returned, and other extractors will
 // be ignored. However, the W3C tracestate header value will always be extracted and
 // stored in the local trace context even if a previous propagator has already succeeded
-// so long as the trace-ids match.
+// so long as the trace-ids match. Carriers implementing BinaryReader but not
+// TextMapReader are decoded using the binary encoding.
 func (p *chainedPropagator) Extract(carrier interface{}) (ddtrace.SpanContext, error) {
+	if isBinaryCarrier(carrier) {
+		return p.binary.Extract(carrier)
+	}
 	var ctx ddtrace.SpanContext
 	for _, v := range p.extractors {
 		if ctx != nil {
@@ -186,14 +186,14 @@ func StartSpan(operationName string, opts ...StartSpanOption) Span {
 }
 
 // Extract extracts a SpanContext from the carrier. The carrier is expected
-// to implement TextMapReader, otherwise an error is returned.
+// to implement TextMapReader or BinaryReader, otherwise an error is returned.
 // If the tracer is not started, calling this function is a no-op.
 func Extract(carrier interface{}) (ddtrace.SpanContext, error) {
 	return internal.GetGlobalTracer().Extract(carrier)
 }
 
 // Inject injects the given SpanContext into the carrier. The carrier is
-// expected to implement TextMapWriter, otherwise an error is returned.
+// expected to implement TextMapWriter or BinaryWriter, otherwise an error is returned.
 // If the tracer is not started, calling this function is a no-op.
 func Inject(ctx ddtrace.SpanContext, carrier interface{}) error {
 	return internal.GetGlobalTracer().Inject(ctx, carrier)
@@ -248,10 +248,16 @@ func newUnstartedTracer(opts ...StartOption) *tracer {
 	c.traceSampleRate = newDynamicConfig("trace_sample_rate", globalRate, rulesSampler.traces.setGlobalSampleRate, equal[float64])
 	var dataStreamsProcessor *datastreams.Processor
 	if c.dataStreamsMonitoringEnabled {
-		dataStreamsProcessor = datastreams.NewProcessor(statsd, c.env, c.serviceName, c.version, c.agentURL, c.httpClient, func() bool {
+		dataStreamsProcessor = datastreams.NewProcessor(statsd, c.env, c.serviceName, c.version, c.agentURL, c.httpClient, c.dataStreamsSink, func() bool {
+			if c.dataStreamsSink != nil {
+				return true
+			}
 			f := loadAgentFeatures(c.logToStdout, c.agentURL, c.httpClient)
 			return f.DataStreams
 		})
+		if c.dataStreamsLagMetrics {
+			dataStreamsProcessor.EnableLagMetrics()
+		}
 	}
 	t := &tracer{
 		config:           c,
@@ -568,6 +574,16 @@ func (t *tracer) StartSpan(operationName string, options ...ddtrace.StartSpanOpt
 			span.Service = newSvc
 		}
 	}
+	if traceprof.ObservesSpanStart() {
+		traceprof.ObserveSpanStart(traceprof.StartedSpan{
+			Name:     span.Name,
+			Service:  span.Service,
+			Resource: span.Resource,
+			SpanID:   span.SpanID,
+			Meta:     span.Meta,
+			Metrics:  span.Metrics,
+		})
+	}
 	if log.DebugEnabled() {
 		// avoid allocating the ...interface{} argument if debug logging is disabled
 		log.Debug("Started Span: %v, Operation: %s, Resource: %s, Tags: %v, %v",
@@ -0,0 +1,115 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-present Datadog, Inc.
+
+package datastreams
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal"
+)
+
+// maxOffsetSamples bounds the number of produce offsets kept per partition
+// to estimate the time lag of the consumers.
+const maxOffsetSamples = 1000
+
+// offsetSample is an offset produced to a partition, and the time it was
+// tracked at, in unix nanoseconds.
+type offsetSample struct {
+	offset    int64
+	timestamp int64
+}
+
+// lagTracker computes the lag of the consumers from the offsets tracked by the
+// processor. The commit offset of a consumer is the offset of the next message
+// it will consume, as committed to Kafka, and the lag is the number of
+// messages between it and the high watermark of the partition, i.e. the offset
+// of the next message to be produced. The high watermark is the one reported
+// by the broker to the consumers of this process, or else the one following
+// the last offset produced by this process. The lag in seconds is only known
+// for the partitions this process produces to.
+type lagTracker struct {
+	produced       map[partitionKey][]offsetSample // by increasing offset
+	highWatermarks map[partitionKey]int64
+	committed      map[partitionConsumerKey]int64
+}
+
+func newLagTracker() *lagTracker {
+	return &lagTracker{
+		produced:       make(map[partitionKey][]offsetSample),
+		highWatermarks: make(map[partitionKey]int64),
+		committed:      make(map[partitionConsumerKey]int64),
+	}
+}
+
+func (l *lagTracker) add(o queueOffset) {
+	key := partitionKey{queueType: o.queueType, partition: o.partition, topic: o.topic}
+	switch o.offsetType {
+	case commitOffset:
+		l.committed[partitionConsumerKey{
+			queueType: o.queueType,
+			partition: o.partition,
+			topic:     o.topic,
+			group:     o.group,
+		}] = o.offset
+		return
+	case highWatermarkOffset:
+		l.highWatermarks[key] = o.offset
+		return
+	}
+	samples := l.produced[key]
+	if n := len(samples); n > 0 && o.offset <= samples[n-1].offset {
+		return
+	}
+	if len(samples) == maxOffsetSamples {
+		samples = append(samples[:0], samples[1:]...)
+	}
+	l.produced[key] = append(samples, offsetSample{offset: o.offset, timestamp: o.timestamp})
+}
+
+// report sends the lag of each consumer, in offsets and in seconds, as of
+// now, in unix nanoseconds.
+func (l *lagTracker) report(statsd internal.StatsdClient, now int64) {
+	for key, committed := range l.committed {
+		partition := partitionKey{queueType: key.queueType, partition: key.partition, topic: key.topic}
+		samples := l.produced[partition]
+		high, ok := l.highWatermarks[partition]
+		if n := len(samples); n > 0 && samples[n-1].offset+1 > high {
+			high, ok = samples[n-1].offset+1, true
+		}
+		if !ok {
+			continue
+		}
+		tags := make([]string, 0, 4)
+		if key.group != "" {
+			tags = append(tags, fmt.Sprintf("consumer_group:%s", key.group))
+		}
+		tags = append(tags, fmt.Sprintf("partition:%d", key.partition), fmt.Sprintf("topic:%s", key.topic), fmt.Sprintf("type:%s", key.queueType))
+		if committed >= high {
+			statsd.Gauge("datadog.datastreams.consumer_lag.offsets", 0, tags, 1)
+			statsd.Gauge("datadog.datastreams.consumer_lag.seconds", 0, tags, 1)
+			continue
+		}
+		statsd.Gauge("datadog.datastreams.consumer_lag.offsets", float64(high-committed), tags, 1)
+		if seconds, ok := lagSeconds(samples, committed, now); ok {
+			statsd.Gauge("datadog.datastreams.consumer_lag.seconds", seconds, tags, 1)
+		}
+	}
+}
+
+// lagSeconds returns the lag in seconds of a consumer which committed the
+// given offset, as of now. It is estimated as the age of the oldest offset
+// produced since the committed one, i.e. the next message to consume, and is
+// unknown if no such offset was tracked.
+func lagSeconds(samples []offsetSample, committed, now int64) (float64, bool) {
+	for _, s := range samples {
+		if s.offset >= committed {
+			return math.Max(float64(now-s.timestamp)/float64(time.Second), 0), true
+		}
+	}
+	return 0, false
+}
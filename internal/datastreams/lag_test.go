@@ -0,0 +1,131 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-present Datadog, Inc.
+
+package datastreams
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+	"github.com/stretchr/testify/assert"
+)
+
+// gaugeStatsdClient records the gauges it receives, by name and tags.
+type gaugeStatsdClient struct {
+	statsd.NoOpClient
+	gauges map[string]float64
+}
+
+func (c *gaugeStatsdClient) Gauge(name string, value float64, tags []string, _ float64) error {
+	c.gauges[name+"|"+strings.Join(tags, ",")] = value
+	return nil
+}
+
+func TestLagTracker(t *testing.T) {
+	start := time.Now()
+	ts := func(d time.Duration) int64 { return start.Add(d).UnixNano() }
+	l := newLagTracker()
+	l.add(queueOffset{queueType: "kafka", topic: "topic1", partition: 0, offset: 10, offsetType: produceOffset, timestamp: ts(0)})
+	l.add(queueOffset{queueType: "kafka", topic: "topic1", partition: 0, offset: 20, offsetType: produceOffset, timestamp: ts(10 * time.Second)})
+	l.add(queueOffset{queueType: "kafka", topic: "topic1", partition: 0, offset: 15, offsetType: produceOffset, timestamp: ts(15 * time.Second)}) // out of order
+	l.add(queueOffset{queueType: "kafka", topic: "topic1", partition: 0, offset: 30, offsetType: produceOffset, timestamp: ts(20 * time.Second)})
+	l.add(queueOffset{queueType: "kafka", topic: "topic1", partition: 0, group: "group1", offset: 12, offsetType: commitOffset})
+	l.add(queueOffset{queueType: "kafka", topic: "topic1", partition: 0, group: "group2", offset: 31, offsetType: commitOffset})
+	l.add(queueOffset{queueType: "redis", topic: "stream1", partition: 0, offset: 5, offsetType: commitOffset}) // nothing produced
+
+	c := &gaugeStatsdClient{gauges: make(map[string]float64)}
+	l.report(c, ts(25*time.Second))
+	assert.Equal(t, map[string]float64{
+		"datadog.datastreams.consumer_lag.offsets|consumer_group:group1,partition:0,topic:topic1,type:kafka": 19,
+		"datadog.datastreams.consumer_lag.seconds|consumer_group:group1,partition:0,topic:topic1,type:kafka": 15,
+		"datadog.datastreams.consumer_lag.offsets|consumer_group:group2,partition:0,topic:topic1,type:kafka": 0,
+		"datadog.datastreams.consumer_lag.seconds|consumer_group:group2,partition:0,topic:topic1,type:kafka": 0,
+	}, c.gauges)
+}
+
+func TestLagTrackerBoundary(t *testing.T) {
+	start := time.Now()
+	for _, tc := range []struct {
+		committed int64
+		offsets   float64
+		seconds   float64
+	}{
+		{committed: 6, offsets: 0, seconds: 0}, // the last produced message was consumed
+		{committed: 5, offsets: 1, seconds: 2}, // it is the next message to consume
+	} {
+		l := newLagTracker()
+		l.add(queueOffset{queueType: "kafka", topic: "topic1", offset: 5, offsetType: produceOffset, timestamp: start.UnixNano()})
+		l.add(queueOffset{queueType: "kafka", topic: "topic1", group: "group1", offset: tc.committed, offsetType: commitOffset})
+		c := &gaugeStatsdClient{gauges: make(map[string]float64)}
+		l.report(c, start.Add(2*time.Second).UnixNano())
+		assert.Equal(t, map[string]float64{
+			"datadog.datastreams.consumer_lag.offsets|consumer_group:group1,partition:0,topic:topic1,type:kafka": tc.offsets,
+			"datadog.datastreams.consumer_lag.seconds|consumer_group:group1,partition:0,topic:topic1,type:kafka": tc.seconds,
+		}, c.gauges, "committed %d", tc.committed)
+	}
+}
+
+func TestLagTrackerHighWatermark(t *testing.T) {
+	l := newLagTracker()
+	// nothing produced by this process, the lag in seconds is unknown
+	l.add(queueOffset{queueType: "kafka", topic: "topic1", offset: 10, offsetType: highWatermarkOffset})
+	l.add(queueOffset{queueType: "kafka", topic: "topic1", group: "group1", offset: 7, offsetType: commitOffset})
+	l.add(queueOffset{queueType: "kafka", topic: "topic1", group: "group2", offset: 10, offsetType: commitOffset})
+	// the high watermark reported by the broker is behind the produced offsets
+	l.add(queueOffset{queueType: "kafka", topic: "topic2", offset: 3, offsetType: highWatermarkOffset})
+	l.add(queueOffset{queueType: "kafka", topic: "topic2", offset: 4, offsetType: produceOffset})
+	l.add(queueOffset{queueType: "kafka", topic: "topic2", group: "group1", offset: 3, offsetType: commitOffset})
+
+	c := &gaugeStatsdClient{gauges: make(map[string]float64)}
+	l.report(c, int64(time.Second))
+	assert.Equal(t, map[string]float64{
+		"datadog.datastreams.consumer_lag.offsets|consumer_group:group1,partition:0,topic:topic1,type:kafka": 3,
+		"datadog.datastreams.consumer_lag.offsets|consumer_group:group2,partition:0,topic:topic1,type:kafka": 0,
+		"datadog.datastreams.consumer_lag.seconds|consumer_group:group2,partition:0,topic:topic1,type:kafka": 0,
+		"datadog.datastreams.consumer_lag.offsets|consumer_group:group1,partition:0,topic:topic2,type:kafka": 2,
+		"datadog.datastreams.consumer_lag.seconds|consumer_group:group1,partition:0,topic:topic2,type:kafka": 1,
+	}, c.gauges)
+}
+
+func TestLagTrackerMaxSamples(t *testing.T) {
+	l := newLagTracker()
+	for i := 0; i < maxOffsetSamples+10; i++ {
+		l.add(queueOffset{queueType: "kafka", topic: "topic1", offset: int64(i), offsetType: produceOffset, timestamp: int64(i)})
+	}
+	samples := l.produced[partitionKey{queueType: "kafka", topic: "topic1"}]
+	assert.Len(t, samples, maxOffsetSamples)
+	assert.Equal(t, int64(10), samples[0].offset)
+
+	seconds, ok := lagSeconds(samples, 0, int64(time.Second)+10)
+	assert.True(t, ok)
+	assert.Equal(t, 1.0, seconds, "the oldest known sample is used")
+}
+
+func TestProcessorLagMetrics(t *testing.T) {
+	c := &gaugeStatsdClient{gauges: make(map[string]float64)}
+	p := NewProcessor(c, "env", "service", "v1", nil, nil, NewMemorySink(), func() bool { return true })
+	p.EnableLagMetrics()
+	p.stop = make(chan struct{})
+	tick := make(chan time.Time)
+	done := make(chan struct{})
+	go func() {
+		p.run(tick)
+		close(done)
+	}()
+	p.TrackKafkaProduceOffset("topic1", 0, 10)
+	p.TrackKafkaCommitOffset("group1", "topic1", 0, 4)
+	p.TrackKafkaHighWatermarkOffset("topic2", 0, 8)
+	p.TrackKafkaCommitOffset("group1", "topic2", 0, 5)
+	assert.Eventually(t, func() bool {
+		return len(p.inOffsets) == 0
+	}, time.Second, time.Millisecond)
+	tick <- time.Now()
+	close(p.stop)
+	<-done
+	assert.Equal(t, 7.0, c.gauges["datadog.datastreams.consumer_lag.offsets|consumer_group:group1,partition:0,topic:topic1,type:kafka"])
+	assert.Equal(t, 3.0, c.gauges["datadog.datastreams.consumer_lag.offsets|consumer_group:group1,partition:0,topic:topic2,type:kafka"])
+}
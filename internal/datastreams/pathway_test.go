@@ -133,6 +133,8 @@ func TestPathway(t *testing.T) {
 			{"dog:bark", false},
 			{"type:", true},
 			{"type:dog", true},
+			{"routing_key:dog", true},
+			{"subscription:dog", true},
 			{"type::dog", false},
 			{"type:d:o:g", false},
 			{"type::", false},
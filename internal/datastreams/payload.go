@@ -7,6 +7,8 @@
 
 package datastreams
 
+//msgp:ignore SchemaDefinition Transaction
+
 // StatsPayload stores client computed stats.
 type StatsPayload struct {
 	// Env specifies the env. of the application, as defined by the user.
@@ -54,6 +56,43 @@ type StatsBucket struct {
 	Stats []StatsPoint
 	// Backlogs store information used to compute queue backlog
 	Backlogs []Backlog
+	// Schemas holds the definitions of the schemas sampled during this bucket.
+	// They are only handed to the sinks set with WithDataStreamsSink, and are
+	// not sent to the agent, whose intake doesn't accept them.
+	Schemas []SchemaDefinition `msg:"-"`
+	// Transactions holds the transaction checkpoints recorded during this
+	// bucket. Like Schemas, they are not sent to the agent.
+	Transactions []Transaction `msg:"-"`
+}
+
+// Transaction is a checkpoint reached by a transaction, identified by a
+// user-defined ID, e.g. a business ID carried across systems which can't be
+// instrumented. The checkpoints of a transaction are stitched together by the
+// backend to compute its end-to-end latency.
+type Transaction struct {
+	// ID is the user-defined ID of the transaction.
+	ID string
+	// Checkpoint is the name of the checkpoint.
+	Checkpoint string
+	// Timestamp is the time the checkpoint was reached, in unix nanoseconds.
+	Timestamp int64
+	// PathwayHash is the hash of the pathway the transaction was on when it
+	// reached the checkpoint, or 0 if none.
+	PathwayHash uint64
+}
+
+// SchemaDefinition is the definition of a schema of the payloads going
+// through an edge.
+type SchemaDefinition struct {
+	// EdgeTags are the tags of the edge.
+	EdgeTags []string
+	// Type is the type of the schema, e.g. "avro".
+	Type string
+	// ID is the fingerprint of the definition, which the stats points of the
+	// payloads with this schema are tagged with.
+	ID string
+	// Definition is the definition of the schema.
+	Definition string
 }
 
 // TimestampType can be either current or origin.
@@ -81,4 +120,7 @@ type StatsPoint struct {
 	EdgeLatency    []byte
 	PayloadSize    []byte
 	TimestampType  TimestampType
+	// SchemaID is the ID of the schema of the payloads, if known. Like the
+	// schemas of StatsBucket, it is not sent to the agent.
+	SchemaID string `msg:"-"`
 }
@@ -11,6 +11,7 @@ import (
 	"math"
 	"net/http"
 	"net/url"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -30,6 +31,9 @@ const (
 	bucketDuration            = time.Second * 10
 	loadAgentFeaturesInterval = time.Second * 30
 	defaultServiceName        = "unnamed-go-service"
+	// schemaSampleInterval is the minimum interval between two reports of
+	// the definition of a schema on an edge.
+	schemaSampleInterval = time.Second * 30
 )
 
 var sketchMapping, _ = mapping.NewLogarithmicMapping(0.01)
@@ -42,6 +46,13 @@ type statsPoint struct {
 	pathwayLatency int64
 	edgeLatency    int64
 	payloadSize    int64
+	schema         *options.Schema
+}
+
+// statsGroupKey identifies the points aggregated in a statsGroup.
+type statsGroupKey struct {
+	hash     uint64
+	schemaID string
 }
 
 type statsGroup struct {
@@ -49,22 +60,25 @@ type statsGroup struct {
 	edgeTags       []string
 	hash           uint64
 	parentHash     uint64
+	schemaID       string
 	pathwayLatency *ddsketch.DDSketch
 	edgeLatency    *ddsketch.DDSketch
 	payloadSize    *ddsketch.DDSketch
 }
 
 type bucket struct {
-	points               map[uint64]statsGroup
+	points               map[statsGroupKey]statsGroup
 	latestCommitOffsets  map[partitionConsumerKey]int64
 	latestProduceOffsets map[partitionKey]int64
+	schemas              []SchemaDefinition
+	transactions         []Transaction
 	start                uint64
 	duration             uint64
 }
 
 func newBucket(start, duration uint64) bucket {
 	return bucket{
-		points:               make(map[uint64]statsGroup),
+		points:               make(map[statsGroupKey]statsGroup),
 		latestCommitOffsets:  make(map[partitionConsumerKey]int64),
 		latestProduceOffsets: make(map[partitionKey]int64),
 		start:                start,
@@ -99,19 +113,27 @@ func (b bucket) export(timestampType TimestampType) StatsBucket {
 			ParentHash:     s.parentHash,
 			TimestampType:  timestampType,
 			PayloadSize:    payloadSize,
+			SchemaID:       s.schemaID,
 		})
 	}
 	exported := StatsBucket{
-		Start:    b.start,
-		Duration: b.duration,
-		Stats:    stats,
-		Backlogs: make([]Backlog, 0, len(b.latestCommitOffsets)+len(b.latestProduceOffsets)),
+		Start:        b.start,
+		Duration:     b.duration,
+		Stats:        stats,
+		Backlogs:     make([]Backlog, 0, len(b.latestCommitOffsets)+len(b.latestProduceOffsets)),
+		Schemas:      b.schemas,
+		Transactions: b.transactions,
 	}
 	for key, offset := range b.latestProduceOffsets {
-		exported.Backlogs = append(exported.Backlogs, Backlog{Tags: []string{fmt.Sprintf("partition:%d", key.partition), fmt.Sprintf("topic:%s", key.topic), "type:kafka_produce"}, Value: offset})
+		exported.Backlogs = append(exported.Backlogs, Backlog{Tags: []string{fmt.Sprintf("partition:%d", key.partition), fmt.Sprintf("topic:%s", key.topic), fmt.Sprintf("type:%s_produce", key.queueType)}, Value: offset})
 	}
 	for key, offset := range b.latestCommitOffsets {
-		exported.Backlogs = append(exported.Backlogs, Backlog{Tags: []string{fmt.Sprintf("consumer_group:%s", key.group), fmt.Sprintf("partition:%d", key.partition), fmt.Sprintf("topic:%s", key.topic), "type:kafka_commit"}, Value: offset})
+		tags := make([]string, 0, 4)
+		if key.group != "" {
+			tags = append(tags, fmt.Sprintf("consumer_group:%s", key.group))
+		}
+		tags = append(tags, fmt.Sprintf("partition:%d", key.partition), fmt.Sprintf("topic:%s", key.topic), fmt.Sprintf("type:%s_commit", key.queueType))
+		exported.Backlogs = append(exported.Backlogs, Backlog{Tags: tags, Value: offset})
 	}
 	return exported
 }
@@ -124,12 +146,20 @@ type processorStats struct {
 	dropped         int64
 }
 
+// schemaSampleKey identifies a schema on an edge.
+type schemaSampleKey struct {
+	edge     string
+	schemaID string
+}
+
 type partitionKey struct {
+	queueType string
 	partition int32
 	topic     string
 }
 
 type partitionConsumerKey struct {
+	queueType string
 	partition int32
 	topic     string
 	group     string
@@ -140,9 +170,16 @@ type offsetType int
 const (
 	produceOffset offsetType = iota
 	commitOffset
+	// highWatermarkOffset is only used to compute the lag of the consumers,
+	// it isn't sent in the payloads.
+	highWatermarkOffset
 )
 
-type kafkaOffset struct {
+// queueOffset is an offset produced to, or committed by a consumer of, a
+// partition of a queue of the given type, e.g. a Kafka topic, or the high
+// watermark of the partition.
+type queueOffset struct {
+	queueType  string
 	offset     int64
 	topic      string
 	group      string
@@ -153,15 +190,18 @@ type kafkaOffset struct {
 
 type Processor struct {
 	in                   chan statsPoint
-	inKafka              chan kafkaOffset
+	inOffsets            chan queueOffset
+	inTransactions       chan Transaction
 	tsTypeCurrentBuckets map[int64]bucket
 	tsTypeOriginBuckets  map[int64]bucket
+	schemaSamples        map[schemaSampleKey]int64 // time of the last report of each schema, in nanoseconds
 	wg                   sync.WaitGroup
 	stopped              uint64
 	stop                 chan struct{} // closing this channel triggers shutdown
 	flushRequest         chan chan<- struct{}
 	stats                processorStats
-	transport            *httpTransport
+	sink                 Sink
+	lag                  *lagTracker // nil unless EnableLagMetrics is called
 	statsd               internal.StatsdClient
 	env                  string
 	primaryTag           string
@@ -180,21 +220,28 @@ func (p *Processor) time() time.Time {
 	return time.Now()
 }
 
-func NewProcessor(statsd internal.StatsdClient, env, service, version string, agentURL *url.URL, httpClient *http.Client, getAgentSupportsDataStreams func() bool) *Processor {
+// NewProcessor returns a new Processor, flushing the stats it computes to
+// sink, or to the agent at agentURL if sink is nil.
+func NewProcessor(statsd internal.StatsdClient, env, service, version string, agentURL *url.URL, httpClient *http.Client, sink Sink, getAgentSupportsDataStreams func() bool) *Processor {
 	if service == "" {
 		service = defaultServiceName
 	}
+	if sink == nil {
+		sink = newHTTPTransport(agentURL, httpClient)
+	}
 	p := &Processor{
 		tsTypeCurrentBuckets:        make(map[int64]bucket),
 		tsTypeOriginBuckets:         make(map[int64]bucket),
+		schemaSamples:               make(map[schemaSampleKey]int64),
 		in:                          make(chan statsPoint, 10000),
-		inKafka:                     make(chan kafkaOffset, 10000),
+		inOffsets:                   make(chan queueOffset, 10000),
+		inTransactions:              make(chan Transaction, 10000),
 		stopped:                     1,
 		statsd:                      statsd,
 		env:                         env,
 		service:                     service,
 		version:                     version,
-		transport:                   newHTTPTransport(agentURL, httpClient),
+		sink:                        sink,
 		timeSource:                  time.Now,
 		getAgentSupportsDataStreams: getAgentSupportsDataStreams,
 	}
@@ -216,17 +263,22 @@ func (p *Processor) getBucket(btime int64, buckets map[int64]bucket) bucket {
 }
 func (p *Processor) addToBuckets(point statsPoint, btime int64, buckets map[int64]bucket) {
 	b := p.getBucket(btime, buckets)
-	group, ok := b.points[point.hash]
+	key := statsGroupKey{hash: point.hash}
+	if point.schema != nil {
+		key.schemaID = point.schema.ID
+	}
+	group, ok := b.points[key]
 	if !ok {
 		group = statsGroup{
 			edgeTags:       point.edgeTags,
 			parentHash:     point.parentHash,
 			hash:           point.hash,
+			schemaID:       key.schemaID,
 			pathwayLatency: ddsketch.NewDDSketch(sketchMapping, store.DenseStoreConstructor(), store.DenseStoreConstructor()),
 			edgeLatency:    ddsketch.NewDDSketch(sketchMapping, store.DenseStoreConstructor(), store.DenseStoreConstructor()),
 			payloadSize:    ddsketch.NewDDSketch(sketchMapping, store.DenseStoreConstructor(), store.DenseStoreConstructor()),
 		}
-		b.points[point.hash] = group
+		b.points[key] = group
 	}
 	if err := group.pathwayLatency.Add(math.Max(float64(point.pathwayLatency)/float64(time.Second), 0)); err != nil {
 		log.Error("failed to add pathway latency. Ignoring %v.", err)
@@ -242,39 +294,90 @@ func (p *Processor) addToBuckets(point statsPoint, btime int64, buckets map[int6
 func (p *Processor) add(point statsPoint) {
 	currentBucketTime := alignTs(point.timestamp, bucketDuration.Nanoseconds())
 	p.addToBuckets(point, currentBucketTime, p.tsTypeCurrentBuckets)
+	if point.schema != nil {
+		p.sampleSchema(point, currentBucketTime)
+	}
 	originTimestamp := point.timestamp - point.pathwayLatency
 	originBucketTime := alignTs(originTimestamp, bucketDuration.Nanoseconds())
 	p.addToBuckets(point, originBucketTime, p.tsTypeOriginBuckets)
 }
 
-func (p *Processor) addKafkaOffset(o kafkaOffset) {
+// sampleSchema adds the definition of the schema of point to the bucket
+// starting at btime, unless it was already reported for the same edge during
+// the last schemaSampleInterval.
+func (p *Processor) sampleSchema(point statsPoint, btime int64) {
+	key := schemaSampleKey{edge: strings.Join(point.edgeTags, ","), schemaID: point.schema.ID}
+	if last, ok := p.schemaSamples[key]; ok && point.timestamp-last < schemaSampleInterval.Nanoseconds() {
+		return
+	}
+	p.schemaSamples[key] = point.timestamp
+	b := p.getBucket(btime, p.tsTypeCurrentBuckets)
+	b.schemas = append(b.schemas, SchemaDefinition{
+		EdgeTags:   point.edgeTags,
+		Type:       point.schema.Type,
+		ID:         point.schema.ID,
+		Definition: point.schema.Definition,
+	})
+	p.tsTypeCurrentBuckets[btime] = b
+}
+
+func (p *Processor) addOffset(o queueOffset) {
+	if p.lag != nil {
+		p.lag.add(o)
+	}
+	if o.offsetType == highWatermarkOffset {
+		return
+	}
 	btime := alignTs(o.timestamp, bucketDuration.Nanoseconds())
 	b := p.getBucket(btime, p.tsTypeCurrentBuckets)
 	if o.offsetType == produceOffset {
 		b.latestProduceOffsets[partitionKey{
+			queueType: o.queueType,
 			partition: o.partition,
 			topic:     o.topic,
 		}] = o.offset
 		return
 	}
 	b.latestCommitOffsets[partitionConsumerKey{
+		queueType: o.queueType,
 		partition: o.partition,
 		group:     o.group,
 		topic:     o.topic,
 	}] = o.offset
 }
 
+// EnableLagMetrics enables the computation of the lag of the consumers, in
+// offsets and in seconds, from the offsets tracked by the processor. It is
+// reported with the statsd client, every time the stats are flushed. It must
+// be called before Start.
+func (p *Processor) EnableLagMetrics() {
+	p.lag = newLagTracker()
+}
+
+func (p *Processor) addTransaction(t Transaction) {
+	btime := alignTs(t.Timestamp, bucketDuration.Nanoseconds())
+	b := p.getBucket(btime, p.tsTypeCurrentBuckets)
+	b.transactions = append(b.transactions, t)
+	p.tsTypeCurrentBuckets[btime] = b
+}
+
 func (p *Processor) run(tick <-chan time.Time) {
 	for {
 		select {
 		case s := <-p.in:
 			atomic.AddInt64(&p.stats.payloadsIn, 1)
 			p.add(s)
-		case o := <-p.inKafka:
-			p.addKafkaOffset(o)
+		case o := <-p.inOffsets:
+			p.addOffset(o)
+		case t := <-p.inTransactions:
+			p.addTransaction(t)
 		case now := <-tick:
 			p.sendToAgent(p.flush(now))
+			if p.lag != nil {
+				p.lag.report(p.statsd, now.UnixNano())
+			}
 		case done := <-p.flushRequest:
+			p.drain()
 			p.sendToAgent(p.flush(time.Now().Add(bucketDuration * 10)))
 			close(done)
 		case <-p.stop:
@@ -285,6 +388,24 @@ func (p *Processor) run(tick <-chan time.Time) {
 	}
 }
 
+// drain adds the stats points, offsets and transactions waiting in the input
+// channels, so that a flush requested after they were sent includes them.
+func (p *Processor) drain() {
+	for {
+		select {
+		case s := <-p.in:
+			atomic.AddInt64(&p.stats.payloadsIn, 1)
+			p.add(s)
+		case o := <-p.inOffsets:
+			p.addOffset(o)
+		case t := <-p.inTransactions:
+			p.addTransaction(t)
+		default:
+			return
+		}
+	}
+}
+
 func (p *Processor) Start() {
 	if atomic.SwapUint64(&p.stopped, 0) == 0 {
 		// already running
@@ -293,8 +414,13 @@ func (p *Processor) Start() {
 	}
 	p.stop = make(chan struct{})
 	p.flushRequest = make(chan chan<- struct{})
-	p.wg.Add(2)
-	go p.reportStats()
+	p.wg.Add(3)
+	go func() {
+		defer p.wg.Done()
+		tick := time.NewTicker(time.Second * 10)
+		defer tick.Stop()
+		p.reportStats(tick.C)
+	}()
 	go func() {
 		defer p.wg.Done()
 		tick := time.NewTicker(bucketDuration)
@@ -330,8 +456,13 @@ func (p *Processor) Stop() {
 	p.wg.Wait()
 }
 
-func (p *Processor) reportStats() {
-	for range time.NewTicker(time.Second * 10).C {
+func (p *Processor) reportStats(tick <-chan time.Time) {
+	for {
+		select {
+		case <-tick:
+		case <-p.stop:
+			return
+		}
 		p.statsd.Count("datadog.datastreams.processor.payloads_in", atomic.SwapInt64(&p.stats.payloadsIn, 0), nil, 1)
 		p.statsd.Count("datadog.datastreams.processor.flushed_payloads", atomic.SwapInt64(&p.stats.flushedPayloads, 0), nil, 1)
 		p.statsd.Count("datadog.datastreams.processor.flushed_buckets", atomic.SwapInt64(&p.stats.flushedBuckets, 0), nil, 1)
@@ -370,13 +501,23 @@ func (p *Processor) flush(now time.Time) StatsPayload {
 		}
 		sp.Stats = append(sp.Stats, p.flushBucket(p.tsTypeOriginBuckets, ts, TimestampTypeOrigin))
 	}
+	for key, last := range p.schemaSamples {
+		// schemas which weren't reported during the last interval would be
+		// reported again anyway
+		if nowNano-last >= schemaSampleInterval.Nanoseconds() {
+			delete(p.schemaSamples, key)
+		}
+	}
 	return sp
 }
 
 func (p *Processor) sendToAgent(payload StatsPayload) {
+	if len(payload.Stats) == 0 {
+		return
+	}
 	atomic.AddInt64(&p.stats.flushedPayloads, 1)
 	atomic.AddInt64(&p.stats.flushedBuckets, int64(len(payload.Stats)))
-	if err := p.transport.sendPipelineStats(&payload); err != nil {
+	if err := p.sink.Send(&payload); err != nil {
 		atomic.AddInt64(&p.stats.flushErrors, 1)
 	}
 }
@@ -410,6 +551,7 @@ func (p *Processor) SetCheckpointWithParams(ctx context.Context, params options.
 		pathwayLatency: now.Sub(pathwayStart).Nanoseconds(),
 		edgeLatency:    now.Sub(edgeStart).Nanoseconds(),
 		payloadSize:    params.PayloadSize,
+		schema:         params.Schema,
 	}:
 	default:
 		atomic.AddInt64(&p.stats.dropped, 1)
@@ -417,30 +559,85 @@ func (p *Processor) SetCheckpointWithParams(ctx context.Context, params options.
 	return ContextWithPathway(ctx, child)
 }
 
+// TrackKafkaCommitOffset tracks the offset committed by a Kafka consumer
+// group, see TrackConsumeOffset.
 func (p *Processor) TrackKafkaCommitOffset(group string, topic string, partition int32, offset int64) {
-	select {
-	case p.inKafka <- kafkaOffset{
+	p.TrackConsumeOffset("kafka", group, topic, partition, offset)
+}
+
+// TrackKafkaHighWatermarkOffset tracks the high watermark of a Kafka topic
+// partition, i.e. the offset of the next message to be produced to it, as
+// reported by the broker to a consumer. It is used to compute the consumer
+// lag of the partitions this process doesn't produce to.
+func (p *Processor) TrackKafkaHighWatermarkOffset(topic string, partition int32, offset int64) {
+	p.trackOffset(queueOffset{
+		queueType:  "kafka",
 		offset:     offset,
-		group:      group,
 		topic:      topic,
 		partition:  partition,
+		offsetType: highWatermarkOffset,
+	})
+}
+
+// TrackKafkaProduceOffset tracks the offset of a message produced to Kafka,
+// see TrackProduceOffset.
+func (p *Processor) TrackKafkaProduceOffset(topic string, partition int32, offset int64) {
+	p.TrackProduceOffset("kafka", topic, partition, offset)
+}
+
+// TrackConsumeOffset tracks the offset committed by a consumer, in the given
+// group if any, of a partition of a queue of the given type. As with Kafka
+// commits, it is the offset of the next message to consume, i.e. the one
+// following the last consumed message. Together with TrackProduceOffset, it
+// is used to compute the consumer lag.
+func (p *Processor) TrackConsumeOffset(queueType, group, queue string, partition int32, offset int64) {
+	p.trackOffset(queueOffset{
+		queueType:  queueType,
+		offset:     offset,
+		group:      group,
+		topic:      queue,
+		partition:  partition,
 		offsetType: commitOffset,
-		timestamp:  p.time().UnixNano(),
-	}:
+	})
+}
+
+// TrackProduceOffset tracks the offset of a message produced to a partition
+// of a queue of the given type.
+func (p *Processor) TrackProduceOffset(queueType, queue string, partition int32, offset int64) {
+	p.trackOffset(queueOffset{
+		queueType:  queueType,
+		offset:     offset,
+		topic:      queue,
+		partition:  partition,
+		offsetType: produceOffset,
+	})
+}
+
+func (p *Processor) trackOffset(o queueOffset) {
+	o.timestamp = p.time().UnixNano()
+	select {
+	case p.inOffsets <- o:
 	default:
 		atomic.AddInt64(&p.stats.dropped, 1)
 	}
 }
 
-func (p *Processor) TrackKafkaProduceOffset(topic string, partition int32, offset int64) {
+// TrackTransaction records that the transaction with the given user-defined
+// ID, e.g. a business ID, reached the named checkpoint, on the pathway of ctx
+// if any. The backend stitches together the checkpoints of a transaction,
+// including the ones recorded by other services, to compute its end-to-end
+// latency across systems which can't be instrumented.
+func (p *Processor) TrackTransaction(ctx context.Context, checkpointName, transactionID string) {
+	t := Transaction{
+		ID:         transactionID,
+		Checkpoint: checkpointName,
+		Timestamp:  p.time().UnixNano(),
+	}
+	if pathway, ok := PathwayFromContext(ctx); ok {
+		t.PathwayHash = pathway.GetHash()
+	}
 	select {
-	case p.inKafka <- kafkaOffset{
-		offset:     offset,
-		topic:      topic,
-		partition:  partition,
-		offsetType: produceOffset,
-		timestamp:  p.time().UnixNano(),
-	}:
+	case p.inTransactions <- t:
 	default:
 		atomic.AddInt64(&p.stats.dropped, 1)
 	}
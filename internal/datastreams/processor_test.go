@@ -13,12 +13,14 @@ import (
 	"testing"
 	"time"
 
+	"gopkg.in/DataDog/dd-trace-go.v1/datastreams/options"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/version"
 
 	"github.com/DataDog/sketches-go/ddsketch"
 	"github.com/DataDog/sketches-go/ddsketch/store"
 	"github.com/golang/protobuf/proto"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func buildSketch(values ...float64) []byte {
@@ -31,7 +33,7 @@ func buildSketch(values ...float64) []byte {
 }
 
 func TestProcessor(t *testing.T) {
-	p := NewProcessor(nil, "env", "service", "v1", &url.URL{Scheme: "http", Host: "agent-address"}, nil, func() bool { return true })
+	p := NewProcessor(nil, "env", "service", "v1", &url.URL{Scheme: "http", Host: "agent-address"}, nil, nil, func() bool { return true })
 	tp1 := time.Now().Truncate(bucketDuration)
 	tp2 := tp1.Add(time.Minute)
 
@@ -213,12 +215,12 @@ func TestSetCheckpoint(t *testing.T) {
 }
 
 func TestKafkaLag(t *testing.T) {
-	p := NewProcessor(nil, "env", "service", "v1", &url.URL{Scheme: "http", Host: "agent-address"}, nil, func() bool { return true })
+	p := NewProcessor(nil, "env", "service", "v1", &url.URL{Scheme: "http", Host: "agent-address"}, nil, nil, func() bool { return true })
 	tp1 := time.Now()
-	p.addKafkaOffset(kafkaOffset{offset: 1, topic: "topic1", partition: 1, group: "group1", offsetType: commitOffset})
-	p.addKafkaOffset(kafkaOffset{offset: 10, topic: "topic2", partition: 1, group: "group1", offsetType: commitOffset})
-	p.addKafkaOffset(kafkaOffset{offset: 5, topic: "topic1", partition: 1, offsetType: produceOffset})
-	p.addKafkaOffset(kafkaOffset{offset: 15, topic: "topic1", partition: 1, offsetType: produceOffset})
+	p.addOffset(queueOffset{queueType: "kafka", offset: 1, topic: "topic1", partition: 1, group: "group1", offsetType: commitOffset})
+	p.addOffset(queueOffset{queueType: "kafka", offset: 10, topic: "topic2", partition: 1, group: "group1", offsetType: commitOffset})
+	p.addOffset(queueOffset{queueType: "kafka", offset: 5, topic: "topic1", partition: 1, offsetType: produceOffset})
+	p.addOffset(queueOffset{queueType: "kafka", offset: 15, topic: "topic1", partition: 1, offsetType: produceOffset})
 	point := p.flush(tp1.Add(bucketDuration * 2))
 	sort.Slice(point.Stats[0].Backlogs, func(i, j int) bool {
 		return strings.Join(point.Stats[0].Backlogs[i].Tags, "") < strings.Join(point.Stats[0].Backlogs[j].Tags, "")
@@ -239,3 +241,89 @@ func TestKafkaLag(t *testing.T) {
 	}
 	assert.Equal(t, expectedBacklogs, point.Stats[0].Backlogs)
 }
+
+func TestQueueLag(t *testing.T) {
+	p := NewProcessor(nil, "env", "service", "v1", &url.URL{Scheme: "http", Host: "agent-address"}, nil, nil, func() bool { return true })
+	tp1 := time.Now()
+	p.addOffset(queueOffset{queueType: "redis", offset: 3, topic: "stream1", partition: 0, offsetType: commitOffset})
+	p.addOffset(queueOffset{queueType: "redis", offset: 7, topic: "stream1", partition: 0, offsetType: produceOffset})
+	p.addOffset(queueOffset{queueType: "kafka", offset: 5, topic: "stream1", partition: 0, offsetType: produceOffset})
+	point := p.flush(tp1.Add(bucketDuration * 2))
+	sort.Slice(point.Stats[0].Backlogs, func(i, j int) bool {
+		return strings.Join(point.Stats[0].Backlogs[i].Tags, "") < strings.Join(point.Stats[0].Backlogs[j].Tags, "")
+	})
+	expectedBacklogs := []Backlog{
+		{
+			Tags:  []string{"partition:0", "topic:stream1", "type:kafka_produce"},
+			Value: 5,
+		},
+		{
+			Tags:  []string{"partition:0", "topic:stream1", "type:redis_commit"},
+			Value: 3,
+		},
+		{
+			Tags:  []string{"partition:0", "topic:stream1", "type:redis_produce"},
+			Value: 7,
+		},
+	}
+	assert.Equal(t, expectedBacklogs, point.Stats[0].Backlogs)
+}
+
+func TestSchemas(t *testing.T) {
+	p := NewProcessor(nil, "env", "service", "v1", &url.URL{Scheme: "http", Host: "agent-address"}, nil, nil, func() bool { return true })
+	tp := time.Now().Truncate(bucketDuration)
+	v1 := &options.Schema{Type: "avro", ID: "1", Definition: "v1"}
+	v2 := &options.Schema{Type: "avro", ID: "2", Definition: "v2"}
+	point := func(ts time.Time, edge string, schema *options.Schema) statsPoint {
+		return statsPoint{edgeTags: []string{"direction:out", "topic:" + edge}, hash: 2, parentHash: 1, timestamp: ts.UnixNano(), schema: schema}
+	}
+	p.add(point(tp, "topic1", v1))
+	p.add(point(tp.Add(time.Second), "topic1", v1)) // already sampled
+	p.add(point(tp.Add(time.Second), "topic1", v2))
+	p.add(point(tp.Add(time.Second), "topic2", v1))
+	p.add(point(tp.Add(time.Second), "topic2", nil))
+	p.add(point(tp.Add(schemaSampleInterval), "topic1", v1))
+
+	sp := p.flush(tp.Add(schemaSampleInterval + bucketDuration))
+	var schemas []SchemaDefinition
+	ids := make(map[string]int)
+	for _, b := range sp.Stats {
+		schemas = append(schemas, b.Schemas...)
+		for _, s := range b.Stats {
+			if b.Start == uint64(tp.UnixNano()) && s.TimestampType == TimestampTypeCurrent {
+				ids[s.SchemaID]++
+			}
+		}
+	}
+	assert.Equal(t, map[string]int{"1": 1, "2": 1, "": 1}, ids, "points are grouped by schema")
+	assert.ElementsMatch(t, []SchemaDefinition{
+		{EdgeTags: []string{"direction:out", "topic:topic1"}, Type: "avro", ID: "1", Definition: "v1"},
+		{EdgeTags: []string{"direction:out", "topic:topic1"}, Type: "avro", ID: "2", Definition: "v2"},
+		{EdgeTags: []string{"direction:out", "topic:topic2"}, Type: "avro", ID: "1", Definition: "v1"},
+		{EdgeTags: []string{"direction:out", "topic:topic1"}, Type: "avro", ID: "1", Definition: "v1"},
+	}, schemas)
+	assert.Equal(t, map[schemaSampleKey]int64{
+		{edge: "direction:out,topic:topic1", schemaID: "1"}: tp.Add(schemaSampleInterval).UnixNano(),
+	}, p.schemaSamples, "the samples older than the interval are expired")
+}
+
+func TestTrackTransaction(t *testing.T) {
+	tp := time.Now().Truncate(bucketDuration)
+	p := NewProcessor(nil, "env", "service", "v1", &url.URL{Scheme: "http", Host: "agent-address"}, nil, nil, func() bool { return true })
+	p.timeSource = func() time.Time { return tp }
+
+	p.TrackTransaction(context.Background(), "file-received", "order-1")
+	ctx := p.SetCheckpoint(context.Background(), "direction:out", "type:sftp")
+	pathway, _ := PathwayFromContext(ctx)
+	p.TrackTransaction(ctx, "file-sent", "order-1")
+	<-p.in
+	p.addTransaction(<-p.inTransactions)
+	p.addTransaction(<-p.inTransactions)
+
+	sp := p.flush(tp.Add(bucketDuration))
+	require.Len(t, sp.Stats, 1)
+	assert.Equal(t, []Transaction{
+		{ID: "order-1", Checkpoint: "file-received", Timestamp: tp.UnixNano()},
+		{ID: "order-1", Checkpoint: "file-sent", Timestamp: tp.UnixNano(), PathwayHash: pathway.GetHash()},
+	}, sp.Stats[0].Transactions)
+}
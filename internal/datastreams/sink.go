@@ -0,0 +1,77 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-present Datadog, Inc.
+
+package datastreams
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// A Sink receives the stats payloads flushed by a Processor. By default, they
+// are sent to the agent.
+type Sink interface {
+	// Send sends the payload. It is called by a single goroutine at a time.
+	Send(p *StatsPayload) error
+}
+
+var (
+	_ Sink = (*httpTransport)(nil)
+	_ Sink = (*MemorySink)(nil)
+	_ Sink = (*jsonLinesSink)(nil)
+)
+
+// MemorySink is a Sink keeping the payloads in memory, e.g. for tests.
+type MemorySink struct {
+	mu       sync.Mutex
+	payloads []StatsPayload
+}
+
+// NewMemorySink returns a new, empty, MemorySink.
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+// Send implements Sink.
+func (s *MemorySink) Send(p *StatsPayload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.payloads = append(s.payloads, *p)
+	return nil
+}
+
+// Payloads returns the payloads sent to the sink since it was created or
+// reset.
+func (s *MemorySink) Payloads() []StatsPayload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	payloads := make([]StatsPayload, len(s.payloads))
+	copy(payloads, s.payloads)
+	return payloads
+}
+
+// Reset drops the payloads sent to the sink.
+func (s *MemorySink) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.payloads = nil
+}
+
+type jsonLinesSink struct {
+	enc *json.Encoder
+}
+
+// NewJSONLinesSink returns a Sink writing each payload to w as a line of
+// JSON, e.g. to a file for offline analysis. The latency and payload size
+// distributions of the stats points are DDSketch protobufs, encoded in base64.
+func NewJSONLinesSink(w io.Writer) Sink {
+	return &jsonLinesSink{enc: json.NewEncoder(w)}
+}
+
+// Send implements Sink.
+func (s *jsonLinesSink) Send(p *StatsPayload) error {
+	return s.enc.Encode(p)
+}
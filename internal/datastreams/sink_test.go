@@ -0,0 +1,63 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-present Datadog, Inc.
+
+package datastreams
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemorySink(t *testing.T) {
+	s := NewMemorySink()
+	p := NewProcessor(nil, "env", "service", "v1", nil, nil, s, func() bool { return true })
+	p.Start()
+	ctx := p.SetCheckpoint(context.Background(), "direction:out", "topic:topic1", "type:kafka")
+	p.SetCheckpoint(ctx, "direction:in", "topic:topic1", "type:kafka")
+	p.Flush()
+
+	payloads := s.Payloads()
+	require.Len(t, payloads, 1)
+	assert.Equal(t, "service", payloads[0].Service)
+	var edges [][]string
+	for _, b := range payloads[0].Stats {
+		for _, sp := range b.Stats {
+			if sp.TimestampType == TimestampTypeCurrent {
+				edges = append(edges, sp.EdgeTags)
+			}
+		}
+	}
+	assert.ElementsMatch(t, [][]string{
+		{"direction:out", "topic:topic1", "type:kafka"},
+		{"direction:in", "topic:topic1", "type:kafka"},
+	}, edges)
+
+	s.Reset()
+	assert.Empty(t, s.Payloads())
+	p.Stop()
+	assert.Empty(t, s.Payloads(), "empty payloads are not sent")
+}
+
+func TestJSONLinesSink(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewJSONLinesSink(&buf)
+	require.NoError(t, s.Send(&StatsPayload{Service: "service-1", Stats: []StatsBucket{{Start: 1}}}))
+	require.NoError(t, s.Send(&StatsPayload{Service: "service-2"}))
+
+	var services []string
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var p StatsPayload
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &p))
+		services = append(services, p.Service)
+	}
+	assert.Equal(t, []string{"service-1", "service-2"}, services)
+}
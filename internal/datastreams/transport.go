@@ -76,7 +76,8 @@ func newHTTPTransport(agentURL *url.URL, client *http.Client) *httpTransport {
 	}
 }
 
-func (t *httpTransport) sendPipelineStats(p *StatsPayload) error {
+// Send sends the payload to the agent. It implements Sink.
+func (t *httpTransport) Send(p *StatsPayload) error {
 	var buf bytes.Buffer
 	gzipWriter, err := gzip.NewWriterLevel(&buf, gzip.BestSpeed)
 	if err != nil {
@@ -82,3 +82,9 @@ func NewGCPPubsubOutboundOp(opts ...Option) *Schema {
 	newOpts := append([]Option{WithOverrideV0("pubsub.publish")}, opts...)
 	return NewMessagingOutboundOp("gcp.pubsub", newOpts...)
 }
+
+// NewGCPCloudTasksInboundOp creates a new schema for GCP Cloud Tasks (messaging) inbound operations.
+func NewGCPCloudTasksInboundOp(opts ...Option) *Schema {
+	newOpts := append([]Option{WithOverrideV0("cloudtasks.receive")}, opts...)
+	return NewMessagingInboundOp("gcp.cloudtasks", newOpts...)
+}
@@ -54,6 +54,14 @@ func TestOpContribSchemas(t *testing.T) {
 			wantV0: "pubsub.receive",
 			wantV1: "gcp.pubsub.process",
 		},
+		{
+			name: "gcp cloud tasks inbound",
+			newSchema: func() *namingschema.Schema {
+				return namingschema.NewGCPCloudTasksInboundOp()
+			},
+			wantV0: "cloudtasks.receive",
+			wantV1: "gcp.cloudtasks.process",
+		},
 		{
 			name: "messaging outbound override",
 			newSchema: func() *namingschema.Schema {
@@ -0,0 +1,177 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package traceprof
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// FinishedSpan holds the information about a finished span that is made
+// available to span observers.
+type FinishedSpan struct {
+	Name            string
+	Service         string
+	Resource        string
+	SpanID          uint64
+	LocalRootSpanID uint64
+	Start           time.Time
+	Duration        time.Duration
+	Error           bool
+	// Meta holds the string tags of the span. It must not be modified, nor
+	// retained after the observer returns.
+	Meta map[string]string
+}
+
+// SpanObserver is called by the tracer when a span it observes finishes. It
+// is called synchronously while the span is being finished, so it must be
+// cheap.
+type SpanObserver func(f FinishedSpan)
+
+// spanObserverSet is an immutable set of registered observers. It is
+// replaced on every change so that the tracer never needs to lock.
+type spanObserverSet struct {
+	all    []*SpanObserver            // observers of every span
+	byName map[string][]*SpanObserver // observers of spans with a given operation name
+}
+
+var spanObservers struct {
+	mu  sync.Mutex   // guards changes to set
+	set atomic.Value // *spanObserverSet
+}
+
+func loadSpanObservers() *spanObserverSet {
+	set, _ := spanObservers.set.Load().(*spanObserverSet)
+	return set
+}
+
+// AddSpanObserver registers o to be called for every finished span with the
+// given operation name, or for every finished span if name is empty. It
+// returns a function that removes the observer again. Observers of all spans
+// have a cost on every span, so observing a given name should be preferred.
+func AddSpanObserver(name string, o SpanObserver) (remove func()) {
+	entry := &o
+	updateSpanObservers(func(set *spanObserverSet) {
+		if name == "" {
+			set.all = append(set.all, entry)
+		} else {
+			set.byName[name] = append(set.byName[name], entry)
+		}
+	})
+	return func() {
+		updateSpanObservers(func(set *spanObserverSet) {
+			set.all = removeSpanObserver(set.all, entry)
+			if list := removeSpanObserver(set.byName[name], entry); len(list) > 0 {
+				set.byName[name] = list
+			} else {
+				delete(set.byName, name)
+			}
+		})
+	}
+}
+
+// updateSpanObservers applies update to a copy of the current set of
+// observers and stores it.
+func updateSpanObservers(update func(set *spanObserverSet)) {
+	spanObservers.mu.Lock()
+	defer spanObservers.mu.Unlock()
+	next := &spanObserverSet{byName: make(map[string][]*SpanObserver)}
+	if set := loadSpanObservers(); set != nil {
+		next.all = append(next.all, set.all...)
+		for name, list := range set.byName {
+			next.byName[name] = append([]*SpanObserver(nil), list...)
+		}
+	}
+	update(next)
+	if len(next.all) == 0 && len(next.byName) == 0 {
+		next = nil
+	}
+	spanObservers.set.Store(next)
+}
+
+func removeSpanObserver(list []*SpanObserver, entry *SpanObserver) []*SpanObserver {
+	var out []*SpanObserver
+	for _, e := range list {
+		if e != entry {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// ObservesSpan reports whether any span observer is interested in spans with
+// the given operation name. Tracers use it to avoid building a FinishedSpan
+// when nobody is listening.
+func ObservesSpan(name string) bool {
+	set := loadSpanObservers()
+	if set == nil {
+		return false
+	}
+	if len(set.all) > 0 {
+		return true
+	}
+	_, ok := set.byName[name]
+	return ok
+}
+
+// ObserveSpan calls the span observers interested in f.
+func ObserveSpan(f FinishedSpan) {
+	set := loadSpanObservers()
+	if set == nil {
+		return
+	}
+	for _, o := range set.all {
+		(*o)(f)
+	}
+	for _, o := range set.byName[f.Name] {
+		(*o)(f)
+	}
+}
+
+// StartedSpan holds the information about a started span that is made
+// available to the span start observer.
+type StartedSpan struct {
+	Name     string
+	Service  string
+	Resource string
+	SpanID   uint64
+	// Meta and Metrics hold the tags the span was started with. They must
+	// not be modified, nor retained after the observer returns.
+	Meta    map[string]string
+	Metrics map[string]float64
+}
+
+// SpanStartObserver is called by the tracer when a span starts. It is called
+// synchronously while the span is being started, so it must be cheap.
+type SpanStartObserver func(s StartedSpan)
+
+var spanStartObserver atomic.Value // *SpanStartObserver
+
+// SetSpanStartObserver registers o to be called for every started span,
+// replacing the previously registered one, if any. It returns a function that
+// removes the observer again.
+func SetSpanStartObserver(o SpanStartObserver) (remove func()) {
+	entry := &o
+	spanStartObserver.Store(entry)
+	return func() {
+		spanStartObserver.CompareAndSwap(entry, (*SpanStartObserver)(nil))
+	}
+}
+
+// ObservesSpanStart reports whether a span start observer is registered.
+// Tracers use it to avoid building a StartedSpan when nobody is listening.
+func ObservesSpanStart() bool {
+	o, _ := spanStartObserver.Load().(*SpanStartObserver)
+	return o != nil
+}
+
+// ObserveSpanStart calls the span start observer, if any.
+func ObserveSpanStart(s StartedSpan) {
+	if o, _ := spanStartObserver.Load().(*SpanStartObserver); o != nil {
+		(*o)(s)
+	}
+}
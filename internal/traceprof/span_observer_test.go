@@ -0,0 +1,85 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package traceprof
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpanObservers(t *testing.T) {
+	assert.False(t, ObservesSpan("first"))
+	var all, named []string
+	removeAll := AddSpanObserver("", func(f FinishedSpan) { all = append(all, f.Name) })
+	removeNamed := AddSpanObserver("second", func(f FinishedSpan) { named = append(named, f.Name) })
+	assert.True(t, ObservesSpan("first"))
+
+	ObserveSpan(FinishedSpan{Name: "first"})
+	removeAll()
+	assert.False(t, ObservesSpan("first"))
+	assert.True(t, ObservesSpan("second"))
+	ObserveSpan(FinishedSpan{Name: "second"})
+	removeNamed()
+	ObserveSpan(FinishedSpan{Name: "second"})
+
+	assert.Equal(t, []string{"first"}, all)
+	assert.Equal(t, []string{"second"}, named)
+	assert.False(t, ObservesSpan("second"))
+}
+
+// BenchmarkObserveSpan measures the overhead span observers add to finishing
+// a span in the tracer, which calls ObservesSpan and, when it returns true,
+// ObserveSpan.
+func BenchmarkObserveSpan(b *testing.B) {
+	meta := map[string]string{"http.method": "GET"}
+	finish := func(name string) {
+		if ObservesSpan(name) {
+			ObserveSpan(FinishedSpan{
+				Name:     name,
+				Resource: "GET /",
+				SpanID:   1,
+				Start:    time.Unix(0, 1),
+				Duration: time.Millisecond,
+				Meta:     meta,
+			})
+		}
+	}
+	for _, observed := range []string{"", "db.query", "http.request"} {
+		b.Run("observed="+observed, func(b *testing.B) {
+			if observed != "" {
+				defer AddSpanObserver(observed, func(FinishedSpan) {})()
+			}
+			b.ReportAllocs()
+			b.RunParallel(func(p *testing.PB) {
+				for p.Next() {
+					finish("http.request")
+				}
+			})
+		})
+	}
+}
+
+func TestSpanStartObserver(t *testing.T) {
+	assert.False(t, ObservesSpanStart())
+	ObserveSpanStart(StartedSpan{Name: "ignored"})
+
+	var first, second []string
+	removeFirst := SetSpanStartObserver(func(s StartedSpan) { first = append(first, s.Name) })
+	assert.True(t, ObservesSpanStart())
+	ObserveSpanStart(StartedSpan{Name: "a"})
+	removeSecond := SetSpanStartObserver(func(s StartedSpan) { second = append(second, s.Name) })
+	ObserveSpanStart(StartedSpan{Name: "b"})
+	removeFirst()
+	assert.True(t, ObservesSpanStart(), "removing a replaced observer has no effect")
+	removeSecond()
+	assert.False(t, ObservesSpanStart())
+	ObserveSpanStart(StartedSpan{Name: "c"})
+
+	assert.Equal(t, []string{"a"}, first)
+	assert.Equal(t, []string{"b"}, second)
+}
@@ -0,0 +1,438 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package profiler
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"runtime"
+	rtmetrics "runtime/metrics"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/traceprof"
+)
+
+const (
+	// DefaultCaptureDuration specifies the default length of the profiles
+	// collected by a capture.
+	DefaultCaptureDuration = 10 * time.Second
+
+	// DefaultCaptureRateLimit specifies the default minimum amount of time
+	// between two captures.
+	DefaultCaptureRateLimit = 5 * time.Minute
+)
+
+// CaptureExecutionTrace can be passed to CaptureNow and WithCaptureTypes to
+// collect a runtime execution trace as part of a capture. Passing it to
+// WithProfileTypes has no effect, see DD_PROFILING_EXECUTION_TRACE_ENABLED
+// instead.
+const CaptureExecutionTrace = executionTrace
+
+var (
+	// ErrProfilerNotRunning is returned by CaptureNow when the profiler has
+	// not been started.
+	ErrProfilerNotRunning = errors.New("profiler: not running")
+
+	// ErrCaptureRateLimited is returned by CaptureNow when a capture was
+	// requested less than the configured rate limit ago, see
+	// WithCaptureRateLimit.
+	ErrCaptureRateLimited = errors.New("profiler: capture rate limited")
+)
+
+// defaultCaptureTypes are the profile types collected by captures unless
+// configured otherwise.
+var defaultCaptureTypes = []ProfileType{CPUProfile, HeapProfile, GoroutineProfile}
+
+// canCapture reports whether profiles of type t can be collected by a
+// capture. Metrics need a full profiling period to be meaningful and the
+// goroutine wait profile is experimental.
+func canCapture(t ProfileType) bool {
+	switch t {
+	case CPUProfile, HeapProfile, BlockProfile, MutexProfile, GoroutineProfile, executionTrace:
+		return true
+	default:
+		return false
+	}
+}
+
+// CaptureNow requests an out-of-cycle capture of the given profile types,
+// tagged with "capture_reason:<reason>". If no types are given, the types
+// configured with WithCaptureTypes are captured.
+//
+// Captures don't run concurrently with the regular profiling cycle: the
+// current cycle is cut short and uploaded, then the capture profiles are
+// collected for the duration configured with WithCaptureDuration and
+// uploaded, before the regular cycle resumes. CaptureNow returns once the
+// capture is scheduled.
+//
+// Captures are rate limited, see WithCaptureRateLimit. ErrCaptureRateLimited
+// is returned when a capture can't be taken because of the limit.
+func CaptureNow(reason string, types ...ProfileType) error {
+	mu.Lock()
+	p := activeProfiler
+	mu.Unlock()
+	if p == nil {
+		return ErrProfilerNotRunning
+	}
+	return p.requestCapture(reason, types)
+}
+
+// captureRequest holds the parameters of a requested capture.
+type captureRequest struct {
+	reason string
+	types  []ProfileType
+	// duration overrides the configured capture duration, if not 0.
+	duration time.Duration
+	// window is the trace window which requested the capture, if any.
+	window *traceWindows
+}
+
+// cycle holds the parameters of a single profiling cycle, which is either a
+// regular one or a capture.
+type cycle struct {
+	period      time.Duration
+	cpuDuration time.Duration
+	// cut is closed to end the cycle early. It is nil for captures, which
+	// can't be cut short.
+	cut     chan struct{}
+	cutOnce sync.Once
+}
+
+func newCycle(period, cpuDuration time.Duration) *cycle {
+	return &cycle{period: period, cpuDuration: cpuDuration, cut: make(chan struct{})}
+}
+
+// isCapture reports whether c is a capture.
+func (c *cycle) isCapture() bool {
+	return c.cut == nil
+}
+
+// cutShort ends the cycle early, if it is not a capture.
+func (c *cycle) cutShort() {
+	if c.cut != nil {
+		c.cutOnce.Do(func() { close(c.cut) })
+	}
+}
+
+// setCycle makes c the current cycle. If a capture is already pending, e.g.
+// because it was requested while the previous cycle was being uploaded, c is
+// cut short right away so that the capture doesn't wait for a full period.
+func (p *profiler) setCycle(c *cycle) {
+	p.captureMu.Lock()
+	defer p.captureMu.Unlock()
+	p.cycle = c
+	if p.pendingCapture != nil {
+		c.cutShort()
+	}
+}
+
+// requestCapture schedules a capture of the given types, unless rate limited.
+func (p *profiler) requestCapture(reason string, types []ProfileType) error {
+	if len(types) == 0 {
+		types = p.cfg.capture.types
+	}
+	for _, t := range types {
+		if !canCapture(t) {
+			return fmt.Errorf("profile type %s can not be captured", t)
+		}
+	}
+	return p.scheduleCapture(&captureRequest{reason: reason, types: types})
+}
+
+// scheduleCapture makes req the pending capture, unless rate limited.
+func (p *profiler) scheduleCapture(req *captureRequest) error {
+	tags := append(p.cfg.tags.Slice(), "capture_reason:"+normalizeCaptureReason(req.reason))
+	p.captureMu.Lock()
+	defer p.captureMu.Unlock()
+	if p.pendingCapture != nil || (!p.lastCapture.IsZero() && time.Since(p.lastCapture) < p.cfg.capture.rateLimit) {
+		p.cfg.statsd.Count("datadog.profiling.go.capture_rate_limited", 1, tags, 1)
+		return ErrCaptureRateLimited
+	}
+	p.lastCapture = time.Now()
+	p.pendingCapture = req
+	p.cycle.cutShort()
+	p.cfg.statsd.Count("datadog.profiling.go.capture", 1, tags, 1)
+	return nil
+}
+
+// takeCapture returns the pending capture request, if any, and clears it.
+func (p *profiler) takeCapture() *captureRequest {
+	p.captureMu.Lock()
+	defer p.captureMu.Unlock()
+	req := p.pendingCapture
+	p.pendingCapture = nil
+	return req
+}
+
+// capture collects the profiles requested by req and enqueues them for
+// upload as their own batch.
+func (p *profiler) capture(req *captureRequest) {
+	d := p.cfg.capture.duration
+	if req.duration != 0 {
+		d = req.duration
+	}
+	c := &cycle{period: d, cpuDuration: d}
+	p.setCycle(c)
+	log.Debug("Capturing %v profiles, reason: %s", req.types, req.reason)
+	bat := batch{
+		seq:   p.seq,
+		host:  p.cfg.hostname,
+		start: now(),
+		extraTags: []string{
+			fmt.Sprintf("_dd.profiler.go_execution_trace_enabled:%v", p.cfg.traceConfig.Enabled),
+			"capture_reason:" + normalizeCaptureReason(req.reason),
+		},
+	}
+	p.seq++
+	// Keep the deterministic ordering of enabledProfileTypes, see its
+	// comment.
+	types := append([]ProfileType(nil), req.types...)
+	sort.Slice(types, func(i, j int) bool { return captureOrder(types[i]) < captureOrder(types[j]) })
+	p.collectProfiles(&bat, types)
+	select {
+	case <-p.exit:
+		return
+	default:
+	}
+	bat.end = time.Now()
+	if req.window != nil {
+		bat.spanIDs = req.window.take()
+	}
+	p.enqueueUpload(bat)
+}
+
+// captureOrder returns the position of t in the order used by
+// enabledProfileTypes.
+func captureOrder(t ProfileType) int {
+	if t == CPUProfile {
+		return -1
+	}
+	return int(t)
+}
+
+// normalizeCaptureReason makes reason usable as a tag value.
+func normalizeCaptureReason(reason string) string {
+	if reason == "" {
+		return "unknown"
+	}
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ',', ' ', '\t', '\n':
+			return '_'
+		}
+		return r
+	}, reason)
+}
+
+// A CaptureTrigger decides when to take a capture automatically. Triggers
+// are registered with WithCaptureTriggers and checked periodically, from a
+// single goroutine.
+type CaptureTrigger interface {
+	// Start prepares the trigger to be checked and returns a function
+	// releasing any resources it holds. It is called when the profiler
+	// starts.
+	Start() (stop func())
+	// Check returns the reason for taking a capture, or "" if none should
+	// be taken. now is the time of the check.
+	Check(now time.Time) string
+}
+
+// defaultTriggerCheckInterval is how often capture triggers are checked.
+const defaultTriggerCheckInterval = 10 * time.Second
+
+// watchTriggers checks the configured capture triggers until the profiler
+// is stopped, and requests captures when they fire.
+func (p *profiler) watchTriggers() {
+	for _, t := range p.cfg.capture.triggers {
+		defer t.Start()()
+	}
+	tick := time.NewTicker(p.cfg.capture.checkInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-p.exit:
+			return
+		case now := <-tick.C:
+			for _, t := range p.cfg.capture.triggers {
+				reason := t.Check(now)
+				if reason == "" {
+					continue
+				}
+				if err := p.requestCapture(reason, nil); err != nil {
+					log.Debug("Capture triggered by %s not taken: %v", reason, err)
+				}
+			}
+		}
+	}
+}
+
+// minSpanSamples is the minimum number of spans a span trigger needs to
+// observe within a check interval before it can fire.
+const minSpanSamples = 20
+
+// maxSpanSamples bounds the memory used by a span trigger within a check
+// interval. Durations beyond that are reservoir sampled.
+const maxSpanSamples = 4096
+
+// spanTrigger fires based on the spans with a given operation name which
+// finished since the last check.
+type spanTrigger struct {
+	name   string
+	reason string
+	fire   func(durations []time.Duration, failed int) bool
+
+	mu        sync.Mutex
+	seen      int // number of matching spans since the last check
+	failed    int // number of matching spans with an error since the last check
+	durations []time.Duration
+}
+
+// SpanLatencyTrigger returns a CaptureTrigger which fires when the 99th
+// percentile of the duration of the spans with the given operation name,
+// finished since the last check, exceeds threshold. The trigger requires the
+// tracer to be started in the same process.
+func SpanLatencyTrigger(operationName string, threshold time.Duration) CaptureTrigger {
+	return &spanTrigger{
+		name:   operationName,
+		reason: "span_latency:" + operationName,
+		fire: func(durations []time.Duration, _ int) bool {
+			sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+			// nearest-rank percentile
+			return durations[(len(durations)*99+99)/100-1] > threshold
+		},
+	}
+}
+
+// SpanErrorRateTrigger returns a CaptureTrigger which fires when the
+// fraction of the spans with the given operation name, finished since the
+// last check, which are errors exceeds rate. The trigger requires the tracer
+// to be started in the same process.
+func SpanErrorRateTrigger(operationName string, rate float64) CaptureTrigger {
+	return &spanTrigger{
+		name:   operationName,
+		reason: "span_error_rate:" + operationName,
+		fire: func(durations []time.Duration, failed int) bool {
+			return float64(failed)/float64(len(durations)) > rate
+		},
+	}
+}
+
+func (t *spanTrigger) Start() (stop func()) {
+	return traceprof.AddSpanObserver(t.name, t.observe)
+}
+
+func (t *spanTrigger) observe(s traceprof.FinishedSpan) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.seen++
+	if s.Error {
+		t.failed++
+	}
+	if len(t.durations) < maxSpanSamples {
+		t.durations = append(t.durations, s.Duration)
+	} else if i := rand.Intn(t.seen); i < maxSpanSamples {
+		t.durations[i] = s.Duration
+	}
+}
+
+func (t *spanTrigger) Check(_ time.Time) string {
+	t.mu.Lock()
+	durations, seen, failed := t.durations, t.seen, t.failed
+	t.durations, t.seen, t.failed = nil, 0, 0
+	t.mu.Unlock()
+	if seen < minSpanSamples {
+		return ""
+	}
+	// scale the error count to the sampled durations
+	failed = failed * len(durations) / seen
+	if !t.fire(durations, failed) {
+		return ""
+	}
+	return t.reason
+}
+
+// goroutineTrigger fires when the number of goroutines grows too fast.
+type goroutineTrigger struct {
+	increase int
+	count    func() int // replaced in tests
+	last     int
+}
+
+// GoroutineGrowthTrigger returns a CaptureTrigger which fires when the number
+// of goroutines increased by at least n since the last check.
+func GoroutineGrowthTrigger(n int) CaptureTrigger {
+	return &goroutineTrigger{increase: n, count: runtime.NumGoroutine}
+}
+
+func (t *goroutineTrigger) Start() (stop func()) {
+	t.last = t.count()
+	return func() {}
+}
+
+func (t *goroutineTrigger) Check(_ time.Time) string {
+	n := t.count()
+	last := t.last
+	t.last = n
+	if n-last < t.increase {
+		return ""
+	}
+	return "goroutine_growth"
+}
+
+// heapObjectsMetric is the runtime/metrics name of the memory occupied by
+// live and not yet swept heap objects.
+const heapObjectsMetric = "/memory/classes/heap/objects:bytes"
+
+// heapTrigger fires when the heap grows too fast.
+type heapTrigger struct {
+	rate     float64            // bytes per second
+	heapSize func() uint64      // replaced in tests
+	last     uint64             // heap size at the last check
+	lastTime time.Time          // time of the last check
+	sample   []rtmetrics.Sample // reused across checks
+}
+
+// HeapGrowthTrigger returns a CaptureTrigger which fires when the heap grew
+// by more than bytesPerSecond on average since the last check.
+func HeapGrowthTrigger(bytesPerSecond uint64) CaptureTrigger {
+	t := &heapTrigger{
+		rate:   float64(bytesPerSecond),
+		sample: []rtmetrics.Sample{{Name: heapObjectsMetric}},
+	}
+	t.heapSize = t.readHeapSize
+	return t
+}
+
+func (t *heapTrigger) readHeapSize() uint64 {
+	rtmetrics.Read(t.sample)
+	if t.sample[0].Value.Kind() != rtmetrics.KindUint64 {
+		return 0
+	}
+	return t.sample[0].Value.Uint64()
+}
+
+func (t *heapTrigger) Start() (stop func()) {
+	t.last, t.lastTime = t.heapSize(), time.Now()
+	return func() {}
+}
+
+func (t *heapTrigger) Check(now time.Time) string {
+	size := t.heapSize()
+	last, elapsed := t.last, now.Sub(t.lastTime)
+	t.last, t.lastTime = size, now
+	if size <= last || elapsed <= 0 {
+		return ""
+	}
+	if float64(size-last)/elapsed.Seconds() <= t.rate {
+		return ""
+	}
+	return "heap_growth"
+}
@@ -0,0 +1,170 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package profiler
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/traceprof"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCaptureNow(t *testing.T) {
+	assert.Equal(t, ErrProfilerNotRunning, CaptureNow("test"))
+
+	got := make(chan profileMeta)
+	server := httptest.NewServer(&mockBackend{t: t, profiles: got})
+	defer server.Close()
+
+	t.Setenv("DD_PROFILING_EXECUTION_TRACE_ENABLED", "false")
+	err := Start(
+		WithAgentAddr(server.Listener.Addr().String()),
+		WithProfileTypes(HeapProfile),
+		WithPeriod(time.Hour),
+		WithCaptureDuration(10*time.Millisecond),
+	)
+	require.NoError(t, err)
+	defer Stop()
+
+	require.NoError(t, CaptureNow("latency spike", GoroutineProfile, HeapProfile))
+	assert.Equal(t, ErrCaptureRateLimited, CaptureNow("again"))
+	assert.Error(t, CaptureNow("metrics", MetricsProfile))
+
+	// the regular cycle is cut short and uploaded first
+	regular := <-got
+	assert.NotContains(t, regular.tags, "capture_reason:latency_spike")
+	// metrics.json is missing, as it is collected after less than a second
+	assert.Equal(t, []string{"delta-heap.pprof"}, regular.event.Attachments)
+
+	capture := <-got
+	assert.Contains(t, capture.tags, "capture_reason:latency_spike")
+	assert.ElementsMatch(t, []string{"delta-heap.pprof", "goroutines.pprof"}, capture.event.Attachments)
+}
+
+func TestCaptureExecutionTrace(t *testing.T) {
+	got := make(chan profileMeta)
+	server := httptest.NewServer(&mockBackend{t: t, profiles: got})
+	defer server.Close()
+
+	t.Setenv("DD_PROFILING_EXECUTION_TRACE_ENABLED", "false")
+	err := Start(
+		WithAgentAddr(server.Listener.Addr().String()),
+		// traces are only collected by captures, even if enabled here
+		WithProfileTypes(HeapProfile, CaptureExecutionTrace),
+		WithPeriod(time.Hour),
+		WithCaptureDuration(10*time.Millisecond),
+		WithCaptureTypes(CPUProfile, CaptureExecutionTrace),
+	)
+	require.NoError(t, err)
+	defer Stop()
+
+	require.NoError(t, CaptureNow("test"))
+	regular := <-got
+	assert.NotContains(t, regular.event.Attachments, "go.trace")
+	capture := <-got
+	assert.ElementsMatch(t, []string{"cpu.pprof", "go.trace"}, capture.event.Attachments)
+	assert.Contains(t, capture.tags, "go_execution_traced:yes")
+}
+
+func TestCaptureTriggers(t *testing.T) {
+	t.Run("span-latency", func(t *testing.T) {
+		trigger := SpanLatencyTrigger("http.request", 100*time.Millisecond)
+		defer trigger.Start()()
+		observe := func(name string, d time.Duration, n int) {
+			for i := 0; i < n; i++ {
+				traceprof.ObserveSpan(traceprof.FinishedSpan{Name: name, Duration: d})
+			}
+		}
+
+		observe("http.request", time.Second, minSpanSamples-1)
+		assert.Empty(t, trigger.Check(time.Now()), "not enough samples")
+
+		observe("http.request", time.Millisecond, 99)
+		observe("http.request", time.Second, 1)
+		observe("db.query", time.Second, 100)
+		assert.Empty(t, trigger.Check(time.Now()))
+
+		observe("http.request", time.Millisecond, 90)
+		observe("http.request", time.Second, 10)
+		assert.Equal(t, "span_latency:http.request", trigger.Check(time.Now()))
+	})
+
+	t.Run("span-error-rate", func(t *testing.T) {
+		trigger := SpanErrorRateTrigger("http.request", 0.1)
+		defer trigger.Start()()
+		for i := 0; i < 100; i++ {
+			traceprof.ObserveSpan(traceprof.FinishedSpan{Name: "http.request", Error: i%5 == 0})
+		}
+		assert.Equal(t, "span_error_rate:http.request", trigger.Check(time.Now()))
+		assert.Empty(t, trigger.Check(time.Now()))
+	})
+
+	t.Run("goroutine-growth", func(t *testing.T) {
+		n := 10
+		trigger := GoroutineGrowthTrigger(50).(*goroutineTrigger)
+		trigger.count = func() int { return n }
+		defer trigger.Start()()
+		n = 40
+		assert.Empty(t, trigger.Check(time.Now()))
+		n = 100
+		assert.Equal(t, "goroutine_growth", trigger.Check(time.Now()))
+	})
+
+	t.Run("heap-growth", func(t *testing.T) {
+		size := uint64(1 << 20)
+		trigger := HeapGrowthTrigger(1 << 20).(*heapTrigger)
+		trigger.heapSize = func() uint64 { return size }
+		defer trigger.Start()()
+		start := trigger.lastTime
+		size = 2 << 20
+		assert.Empty(t, trigger.Check(start.Add(2*time.Second)))
+		size = 8 << 20
+		assert.Equal(t, "heap_growth", trigger.Check(start.Add(4*time.Second)))
+		assert.NotZero(t, HeapGrowthTrigger(0).(*heapTrigger).readHeapSize())
+	})
+}
+
+func TestCaptureDeltaBaseline(t *testing.T) {
+	profile := func(text string) []byte {
+		return textProfile{Text: "contentions/count delay/nanoseconds\n" + text}.Protobuf()
+	}
+	returnProfs := [][]byte{
+		profile("main;foo 1 1\n"), // regular cycle
+		profile("main;foo 3 1\n"), // capture baseline
+		profile("main;foo 4 1\n"), // capture
+		profile("main;foo 6 1\n"), // regular cycle
+	}
+	p, err := unstartedProfiler(WithPeriod(time.Millisecond), WithProfileTypes(MutexProfile))
+	require.NoError(t, err)
+	p.testHooks.lookupProfile = func(_ string, w io.Writer, _ int) error {
+		_, err := w.Write(returnProfs[0])
+		returnProfs = returnProfs[1:]
+		return err
+	}
+
+	_, err = p.runProfile(MutexProfile)
+	require.NoError(t, err)
+
+	regular := p.cycle
+	p.cycle = &cycle{period: time.Millisecond, cpuDuration: time.Millisecond}
+	profs, err := p.runProfile(MutexProfile)
+	require.NoError(t, err)
+	require.Len(t, profs, 1)
+	assert.Contains(t, protobufToText(profs[0].data), "main;foo 1 0")
+
+	// the next regular profile covers the whole cycle, including the capture
+	p.cycle = regular
+	profs, err = p.runProfile(MutexProfile)
+	require.NoError(t, err)
+	require.Len(t, profs, 1)
+	assert.Contains(t, protobufToText(profs[0].data), "main;foo 5 0")
+	assert.Empty(t, returnProfs)
+}
@@ -0,0 +1,142 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package profiler
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	pprofile "github.com/google/pprof/profile"
+)
+
+// contentionSite holds the contention recorded at a call site during a
+// profiling period.
+type contentionSite struct {
+	name  string        // function name of the call site
+	count int64         // number of contentions
+	delay time.Duration // total time spent waiting
+	isNew bool          // whether the site had no contention during the previous period
+}
+
+// avgDelay returns the average time spent waiting per contention.
+func (s contentionSite) avgDelay() time.Duration {
+	if s.count == 0 {
+		return 0
+	}
+	return s.delay / time.Duration(s.count)
+}
+
+// contentionReport computes contention reports from consecutive delta mutex
+// and block profiles. It is only used by the collect goroutine.
+type contentionReport struct {
+	topN int
+	// prev holds the call sites with contention during the previous period,
+	// by profile type. Sites missing from it are new.
+	prev map[ProfileType]map[string]struct{}
+}
+
+func newContentionReport(topN int) *contentionReport {
+	return &contentionReport{topN: topN, prev: make(map[ProfileType]map[string]struct{})}
+}
+
+// contentionSites aggregates the samples of the given delta mutex or block
+// profile by call site, and returns the topN sites by total delay.
+func (r *contentionReport) contentionSites(pt ProfileType, data []byte) ([]contentionSite, error) {
+	prof, err := pprofile.ParseData(data)
+	if err != nil {
+		return nil, err
+	}
+	countIdx := sampleTypeIndex(prof, "contentions")
+	delayIdx := sampleTypeIndex(prof, "delay")
+	if countIdx < 0 || delayIdx < 0 {
+		return nil, errors.New("unexpected sample types")
+	}
+	bySite := make(map[string]*contentionSite)
+	for _, s := range prof.Sample {
+		count, delay := s.Value[countIdx], s.Value[delayIdx]
+		if count == 0 && delay == 0 {
+			continue
+		}
+		name := contentionCallSite(s.Location)
+		site, ok := bySite[name]
+		if !ok {
+			site = &contentionSite{name: name}
+			bySite[name] = site
+		}
+		site.count += count
+		site.delay += time.Duration(delay)
+	}
+	prev, hasPrev := r.prev[pt]
+	r.prev[pt] = make(map[string]struct{}, len(bySite))
+	sites := make([]contentionSite, 0, len(bySite))
+	for name, site := range bySite {
+		r.prev[pt][name] = struct{}{}
+		if _, ok := prev[name]; hasPrev && !ok {
+			// The first period has no baseline, so nothing is new.
+			site.isNew = true
+		}
+		sites = append(sites, *site)
+	}
+	sort.Slice(sites, func(i, j int) bool {
+		if sites[i].delay != sites[j].delay {
+			return sites[i].delay > sites[j].delay
+		}
+		return sites[i].name < sites[j].name
+	})
+	if len(sites) > r.topN {
+		sites = sites[:r.topN]
+	}
+	return sites, nil
+}
+
+// contentionCallSite returns the function name of the call site of a
+// contention, i.e. the first frame of the stack outside of the runtime and
+// of the sync package.
+func contentionCallSite(stack []*pprofile.Location) string {
+	var last string
+	for _, loc := range stack {
+		for _, line := range loc.Line {
+			if line.Function == nil {
+				continue
+			}
+			last = line.Function.Name
+			if !strings.HasPrefix(last, "runtime.") && !strings.HasPrefix(last, "sync.") {
+				return last
+			}
+		}
+	}
+	return last
+}
+
+// reportContention sends the contention report of the delta mutex and block
+// profiles among profs to the configured statsd client.
+func (p *profiler) reportContention(profs []*profile) {
+	for _, prof := range profs {
+		if prof.pt != MutexProfile && prof.pt != BlockProfile {
+			continue
+		}
+		if !strings.HasPrefix(prof.name, "delta-") {
+			// cumulative profiles cover the whole process lifetime
+			continue
+		}
+		sites, err := p.contention.contentionSites(prof.pt, prof.data)
+		if err != nil {
+			p.cfg.statsd.Count("datadog.profiling.go.contention_report_error", 1, append(p.cfg.tags.Slice(), prof.pt.Tag()), 1)
+			continue
+		}
+		for _, site := range sites {
+			tags := append(p.cfg.tags.Slice(), prof.pt.Tag(), "call_site:"+site.name)
+			p.cfg.statsd.Count("datadog.profiling.go.contention.count", site.count, tags, 1)
+			p.cfg.statsd.Timing("datadog.profiling.go.contention.delay", site.delay, tags, 1)
+			p.cfg.statsd.Timing("datadog.profiling.go.contention.avg_delay", site.avgDelay(), tags, 1)
+			if site.isNew {
+				p.cfg.statsd.Count("datadog.profiling.go.contention.new_hot_lock", 1, tags, 1)
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package profiler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentionReport(t *testing.T) {
+	mutex := func(samples map[string][2]int64) []byte {
+		sp := newStackProfile("contentions/count", "delay/nanoseconds")
+		for stack, v := range samples {
+			sp.add(stack, nil, v[0], v[1])
+		}
+		return sp.bytes(t)
+	}
+	statsd := &statsdRecorder{}
+	p, err := unstartedProfiler(WithStatsd(statsd), WithContentionReport(2))
+	require.NoError(t, err)
+
+	p.reportContention([]*profile{{name: "delta-mutex.pprof", pt: MutexProfile, data: mutex(map[string][2]int64{
+		"sync.(*Mutex).Unlock;main.a;main.main": {2, 100},
+		"sync.(*Mutex).Unlock;main.a;main.b":    {1, 50},
+		"sync.(*Mutex).Unlock;main.c":           {1, 10},
+		"sync.(*Mutex).Unlock;main.d":           {1, 1},
+		"sync.(*Mutex).Unlock;main.unchanged":   {0, 0},
+	})}})
+	assert.Equal(t, map[string]int64{
+		"datadog.profiling.go.contention.count call_site:main.a": 3,
+		"datadog.profiling.go.contention.count call_site:main.c": 1,
+	}, statsd.counts, "top 2 sites, nothing is new without a previous period")
+	assert.Equal(t, []time.Duration{150}, statsd.timings["datadog.profiling.go.contention.delay call_site:main.a"])
+	assert.Equal(t, []time.Duration{50}, statsd.timings["datadog.profiling.go.contention.avg_delay call_site:main.a"])
+
+	statsd.counts = nil
+	p.reportContention([]*profile{
+		{name: "delta-mutex.pprof", pt: MutexProfile, data: mutex(map[string][2]int64{
+			"sync.(*Mutex).Unlock;main.a":   {1, 10},
+			"sync.(*Mutex).Unlock;main.new": {1, 1000},
+		})},
+		{name: "mutex.pprof", pt: MutexProfile, data: []byte("cumulative profiles are ignored")},
+		{name: "delta-block.pprof", pt: BlockProfile, data: []byte("invalid")},
+	})
+	assert.Equal(t, map[string]int64{
+		"datadog.profiling.go.contention.count call_site:main.a":          1,
+		"datadog.profiling.go.contention.count call_site:main.new":        1,
+		"datadog.profiling.go.contention.new_hot_lock call_site:main.new": 1,
+		"datadog.profiling.go.contention_report_error profile_type:block": 1,
+	}, statsd.counts)
+}
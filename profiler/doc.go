@@ -50,6 +50,11 @@ The code is laid out in the following files:
 	* upload.go: implements uploading a batch of profiles to our agent's
 	  backend proxy, including bundling them together in the required
 	  multi-part form layout and adding required metadata such as tags.
+	* exporter.go: implements the Exporter interface, through which batches
+	  are passed to the Datadog upload, written to local directories or
+	  pushed to other backends.
+	* handler.go: implements Handler, which serves the recently collected
+	  profiles over HTTP for local use with "go tool pprof".
 	* options.go: implements configuration logic, including default values
 	  and functional options which are passed to profiler.Start.
 	* telemetry.go: sends an instrumentation telemetry message containing
@@ -0,0 +1,174 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package profiler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/traceprof"
+
+	pprofile "github.com/google/pprof/profile"
+)
+
+// allocSiteDepth is the number of frames identifying an allocation site.
+const allocSiteDepth = 16
+
+// deriveProfile computes a profile of type t from the given collected
+// profiles. It returns a nil profile if the profiles it is derived from are
+// missing, e.g. if their collection failed.
+func (p *profiler) deriveProfile(t ProfileType, profs []*profile) (*profile, error) {
+	var cpu, heap *profile
+	for _, prof := range profs {
+		switch prof.pt {
+		case CPUProfile:
+			cpu = prof
+		case HeapProfile:
+			heap = prof
+		}
+	}
+	if cpu == nil || heap == nil {
+		return nil, nil
+	}
+	data, err := endpointAllocations(cpu.data, heap.data)
+	if err != nil {
+		return nil, err
+	}
+	return &profile{name: t.Filename(), pt: t, data: data}, nil
+}
+
+// endpointAllocations returns a profile estimating the allocations of the
+// given heap profile made by each endpoint. As heap samples carry no labels,
+// the allocations of each allocation site are split among endpoints in
+// proportion to the CPU time each endpoint spent allocating at that site,
+// according to the runtime.mallocgc samples of the given CPU profile. This is
+// a heuristic: it assumes that the allocations of a site all cost the same CPU
+// time, and misses the allocations made while the CPU profiler wasn't running.
+// Allocations which can't be attributed are kept without label. The profile
+// carries a comment saying that its values are estimates.
+func endpointAllocations(cpuData, heapData []byte) ([]byte, error) {
+	cpu, err := pprofile.ParseData(cpuData)
+	if err != nil {
+		return nil, err
+	}
+	heap, err := pprofile.ParseData(heapData)
+	if err != nil {
+		return nil, err
+	}
+	cpuIdx := sampleTypeIndex(cpu, "cpu")
+	objectsIdx := sampleTypeIndex(heap, "alloc_objects")
+	spaceIdx := sampleTypeIndex(heap, "alloc_space")
+	if cpuIdx < 0 || objectsIdx < 0 || spaceIdx < 0 {
+		return nil, errors.New("unexpected sample types")
+	}
+
+	// weights holds the CPU time spent allocating by each endpoint, by
+	// allocation site.
+	weights := make(map[string]map[string]int64)
+	for _, s := range cpu.Sample {
+		endpoint := sampleLabel(s, traceprof.TraceEndpoint)
+		if endpoint == "" {
+			continue
+		}
+		site, ok := mallocSite(s.Location)
+		if !ok {
+			continue
+		}
+		w, ok := weights[site]
+		if !ok {
+			w = make(map[string]int64)
+			weights[site] = w
+		}
+		w[endpoint] += s.Value[cpuIdx]
+	}
+
+	samples := heap.Sample
+	heap.Sample = nil
+	for _, s := range samples {
+		objects, space := s.Value[objectsIdx], s.Value[spaceIdx]
+		if objects == 0 && space == 0 {
+			continue
+		}
+		w := weights[allocSite(s.Location)]
+		var total int64
+		for _, ns := range w {
+			total += ns
+		}
+		if total == 0 {
+			heap.Sample = append(heap.Sample, &pprofile.Sample{Location: s.Location, Value: []int64{objects, space}})
+			continue
+		}
+		for endpoint, ns := range w {
+			heap.Sample = append(heap.Sample, &pprofile.Sample{
+				Location: s.Location,
+				Value:    []int64{objects * ns / total, space * ns / total},
+				Label:    map[string][]string{traceprof.TraceEndpoint: {endpoint}},
+			})
+		}
+	}
+	heap.SampleType = []*pprofile.ValueType{heap.SampleType[objectsIdx], heap.SampleType[spaceIdx]}
+	heap.DefaultSampleType = "alloc_space"
+	heap.Comments = append(heap.Comments, "estimated: allocations are attributed to endpoints in proportion to their CPU time in runtime.mallocgc")
+	if err := heap.CheckValid(); err != nil {
+		return nil, fmt.Errorf("invalid profile: %v", err)
+	}
+	var buf bytes.Buffer
+	err = heap.Compact().Write(&buf)
+	return buf.Bytes(), err
+}
+
+func sampleTypeIndex(p *pprofile.Profile, typ string) int {
+	for i, st := range p.SampleType {
+		if st.Type == typ {
+			return i
+		}
+	}
+	return -1
+}
+
+// mallocSite returns the allocation site of a CPU sample taken while
+// allocating, i.e. within runtime.mallocgc.
+func mallocSite(stack []*pprofile.Location) (string, bool) {
+	for i, loc := range stack {
+		for _, line := range loc.Line {
+			if line.Function != nil && line.Function.Name == "runtime.mallocgc" {
+				return allocSite(stack[i+1:]), true
+			}
+		}
+	}
+	return "", false
+}
+
+// allocSite returns a key identifying the allocation site of the given stack,
+// leaf first, made of its first allocSiteDepth function names after skipping
+// the runtime's allocation functions, such as runtime.newobject.
+func allocSite(stack []*pprofile.Location) string {
+	var (
+		site  strings.Builder
+		depth int
+		leaf  = true
+	)
+	for _, loc := range stack {
+		for _, line := range loc.Line {
+			if line.Function == nil {
+				continue
+			}
+			name := line.Function.Name
+			if leaf && strings.HasPrefix(name, "runtime.") {
+				continue
+			}
+			leaf = false
+			site.WriteString(name)
+			site.WriteByte('\n')
+			if depth++; depth == allocSiteDepth {
+				return site.String()
+			}
+		}
+	}
+	return site.String()
+}
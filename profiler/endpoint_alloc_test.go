@@ -0,0 +1,120 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package profiler
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/traceprof"
+
+	pprofile "github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stackProfile builds profiles from samples given as a leaf-first
+// ";"-separated stack, values and labels.
+type stackProfile struct {
+	prof  *pprofile.Profile
+	funcs map[string]*pprofile.Location
+}
+
+func newStackProfile(types ...string) *stackProfile {
+	sp := &stackProfile{prof: &pprofile.Profile{}, funcs: make(map[string]*pprofile.Location)}
+	for _, t := range types {
+		typ, unit, _ := strings.Cut(t, "/")
+		sp.prof.SampleType = append(sp.prof.SampleType, &pprofile.ValueType{Type: typ, Unit: unit})
+	}
+	return sp
+}
+
+func (sp *stackProfile) add(stack string, labels map[string][]string, values ...int64) {
+	s := &pprofile.Sample{Value: values, Label: labels}
+	for _, name := range strings.Split(stack, ";") {
+		loc, ok := sp.funcs[name]
+		if !ok {
+			id := uint64(len(sp.funcs) + 1)
+			fn := &pprofile.Function{ID: id, Name: name}
+			loc = &pprofile.Location{ID: id, Line: []pprofile.Line{{Function: fn}}}
+			sp.prof.Function = append(sp.prof.Function, fn)
+			sp.prof.Location = append(sp.prof.Location, loc)
+			sp.funcs[name] = loc
+		}
+		s.Location = append(s.Location, loc)
+	}
+	sp.prof.Sample = append(sp.prof.Sample, s)
+}
+
+func (sp *stackProfile) bytes(t *testing.T) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, sp.prof.Write(&buf))
+	return buf.Bytes()
+}
+
+func TestEndpointAllocations(t *testing.T) {
+	endpoint := func(e string) map[string][]string {
+		return map[string][]string{traceprof.TraceEndpoint: {e}}
+	}
+	cpu := newStackProfile("samples/count", "cpu/nanoseconds")
+	cpu.add("runtime.mallocgc;runtime.newobject;main.alloc;main.handler", endpoint("GET /a"), 1, 30)
+	cpu.add("runtime.mallocgc;runtime.newobject;main.alloc;main.handler", endpoint("GET /b"), 1, 10)
+	cpu.add("runtime.mallocgc;runtime.makeslice;main.slice", endpoint("GET /b"), 1, 10)
+	cpu.add("main.alloc;main.handler", endpoint("GET /c"), 1, 100)
+	cpu.add("runtime.mallocgc;runtime.newobject;main.unlabeled", nil, 1, 10)
+
+	heap := newStackProfile("alloc_objects/count", "alloc_space/bytes", "inuse_objects/count", "inuse_space/bytes")
+	heap.add("runtime.newobject;main.alloc;main.handler", nil, 4, 400, 1, 100)
+	heap.add("main.slice", nil, 2, 200, 2, 200)
+	heap.add("main.unlabeled", nil, 1, 100, 0, 0)
+	heap.add("main.inuse", nil, 0, 0, 1, 100)
+
+	data, err := endpointAllocations(cpu.bytes(t), heap.bytes(t))
+	require.NoError(t, err)
+	prof, err := pprofile.ParseData(data)
+	require.NoError(t, err)
+	assert.Equal(t, "alloc_space", prof.DefaultSampleType)
+	require.Len(t, prof.Comments, 1)
+	assert.Contains(t, prof.Comments[0], "estimated")
+	got := map[string][]int64{}
+	for _, s := range prof.Sample {
+		key := s.Location[len(s.Location)-1].Line[0].Function.Name + " " + sampleLabel(s, traceprof.TraceEndpoint)
+		got[key] = s.Value
+	}
+	assert.Equal(t, map[string][]int64{
+		"main.handler GET /a": {3, 300},
+		"main.handler GET /b": {1, 100},
+		"main.slice GET /b":   {2, 200},
+		"main.unlabeled ":     {1, 100},
+	}, got)
+}
+
+func TestEndpointAllocationProfile(t *testing.T) {
+	p, err := unstartedProfiler(WithProfileTypes(EndpointAllocationProfile, HeapProfile))
+	require.NoError(t, err)
+	assert.NotContains(t, p.enabledProfileTypes(), EndpointAllocationProfile)
+
+	p, err = unstartedProfiler(
+		WithProfileTypes(EndpointAllocationProfile, HeapProfile, CPUProfile),
+		WithPeriod(10*time.Millisecond),
+		CPUDuration(10*time.Millisecond),
+	)
+	require.NoError(t, err)
+	prof, err := p.deriveProfile(EndpointAllocationProfile, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, prof)
+
+	var bat batch
+	p.collectProfiles(&bat, p.enabledProfileTypes())
+	var names []string
+	for _, prof := range bat.profiles {
+		names = append(names, prof.name)
+	}
+	assert.Contains(t, names, "endpoint-allocs.pprof")
+	assert.Contains(t, bat.extraTags, "endpoint_alloc:estimated")
+}
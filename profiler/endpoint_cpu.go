@@ -0,0 +1,65 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package profiler
+
+import (
+	"errors"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/traceprof"
+
+	pprofile "github.com/google/pprof/profile"
+)
+
+// attributeEndpointCPU aggregates the samples of the given CPU profile by the
+// endpoint labels applied by the tracer, and reports the CPU time of each
+// endpoint to statsd, along with the number of distinct local root spans, i.e.
+// requests, found in its samples.
+func (p *profiler) attributeEndpointCPU(data []byte) error {
+	prof, err := pprofile.ParseData(data)
+	if err != nil {
+		return err
+	}
+	cpu := -1
+	for i, st := range prof.SampleType {
+		if st.Type == "cpu" && st.Unit == "nanoseconds" {
+			cpu = i
+		}
+	}
+	if cpu < 0 {
+		return errors.New("no cpu sample type")
+	}
+	var (
+		byEndpoint = make(map[string]int64)
+		requests   = make(map[string]map[string]struct{})
+	)
+	for _, s := range prof.Sample {
+		endpoint := sampleLabel(s, traceprof.TraceEndpoint)
+		if endpoint == "" {
+			continue
+		}
+		byEndpoint[endpoint] += s.Value[cpu]
+		if id := sampleLabel(s, traceprof.LocalRootSpanID); id != "" {
+			if requests[endpoint] == nil {
+				requests[endpoint] = make(map[string]struct{})
+			}
+			requests[endpoint][id] = struct{}{}
+		}
+	}
+	for endpoint, ns := range byEndpoint {
+		tags := append(p.cfg.tags.Slice(), "endpoint:"+endpoint)
+		p.cfg.statsd.Count("datadog.profiling.go.endpoint_cpu_ns", ns, tags, 1)
+		p.cfg.statsd.Count("datadog.profiling.go.endpoint_cpu_requests", int64(len(requests[endpoint])), tags, 1)
+	}
+	return nil
+}
+
+// sampleLabel returns the value of the given string label of s.
+func sampleLabel(s *pprofile.Sample, key string) string {
+	if v := s.Label[key]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
@@ -0,0 +1,101 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package profiler
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/traceprof"
+
+	pprofile "github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// statsdRecorder is a StatsdClient recording the values it receives, by
+// event and first tag.
+type statsdRecorder struct {
+	mu      sync.Mutex
+	counts  map[string]int64
+	timings map[string][]time.Duration
+}
+
+func (s *statsdRecorder) key(event string, tags []string) string {
+	if len(tags) > 0 {
+		return event + " " + tags[len(tags)-1]
+	}
+	return event
+}
+
+func (s *statsdRecorder) Count(event string, times int64, tags []string, _ float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.counts == nil {
+		s.counts = make(map[string]int64)
+	}
+	s.counts[s.key(event, tags)] += times
+	return nil
+}
+
+func (s *statsdRecorder) Timing(event string, d time.Duration, tags []string, _ float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.timings == nil {
+		s.timings = make(map[string][]time.Duration)
+	}
+	k := s.key(event, tags)
+	s.timings[k] = append(s.timings[k], d)
+	return nil
+}
+
+// labeledCPUProfile returns a CPU profile with a sample for each of the given
+// label sets, with the given CPU time.
+func labeledCPUProfile(t *testing.T, samples map[int64]map[string]string) []byte {
+	fn := &pprofile.Function{ID: 1, Name: "main"}
+	loc := &pprofile.Location{ID: 1, Line: []pprofile.Line{{Function: fn}}}
+	prof := &pprofile.Profile{
+		SampleType: []*pprofile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}},
+		PeriodType: &pprofile.ValueType{Type: "cpu", Unit: "nanoseconds"},
+		Function:   []*pprofile.Function{fn},
+		Location:   []*pprofile.Location{loc},
+	}
+	for ns, labels := range samples {
+		s := &pprofile.Sample{Location: []*pprofile.Location{loc}, Value: []int64{1, ns}, Label: map[string][]string{}}
+		for k, v := range labels {
+			s.Label[k] = []string{v}
+		}
+		prof.Sample = append(prof.Sample, s)
+	}
+	var buf bytes.Buffer
+	require.NoError(t, prof.Write(&buf))
+	return buf.Bytes()
+}
+
+func TestAttributeEndpointCPU(t *testing.T) {
+	data := labeledCPUProfile(t, map[int64]map[string]string{
+		10: {traceprof.LocalRootSpanID: "1", traceprof.TraceEndpoint: "GET /users"},
+		20: {traceprof.LocalRootSpanID: "1", traceprof.SpanID: "5", traceprof.TraceEndpoint: "GET /users"},
+		40: {traceprof.LocalRootSpanID: "2", traceprof.TraceEndpoint: "GET /users"},
+		80: {traceprof.LocalRootSpanID: "3"},
+		1:  {},
+	})
+
+	statsd := &statsdRecorder{}
+	p, err := unstartedProfiler(WithStatsd(statsd), WithSpanCPUMetrics(true))
+	require.NoError(t, err)
+	require.NoError(t, p.attributeEndpointCPU(data))
+
+	assert.Equal(t, map[string]int64{
+		"datadog.profiling.go.endpoint_cpu_ns endpoint:GET /users":       70,
+		"datadog.profiling.go.endpoint_cpu_requests endpoint:GET /users": 2,
+	}, statsd.counts)
+	assert.Empty(t, statsd.timings)
+
+	assert.Error(t, p.attributeEndpointCPU(textProfile{Text: "main 1"}.Protobuf()))
+}
@@ -0,0 +1,369 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package profiler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+)
+
+// Batch is a set of profiles of different types collected over the same
+// period of time, as passed to an Exporter.
+type Batch struct {
+	// Start and End delimit the period of time the profiles were collected over.
+	Start, End time.Time
+
+	// Profiles holds the collected profiles.
+	Profiles []Profile
+
+	// Tags holds the tags of the batch in the "key:value" form, including the
+	// ones configured using WithTags, WithService, WithEnv and WithVersion.
+	Tags []string
+
+	// EndpointCounts holds the number of hits per endpoint during the period,
+	// when enabled using WithEndpointCounts.
+	EndpointCounts map[string]uint64
+
+	// SpanIDs holds the IDs of the spans which armed the trace window of the
+	// batch, or started while it was armed, see WithExecutionTraceWindows.
+	SpanIDs []uint64
+}
+
+// Profile is a single profile of a Batch.
+type Profile struct {
+	// Name is the file name of the profile, e.g. "cpu.pprof" or "metrics.json".
+	Name string
+
+	// Type is the type of the profile.
+	Type ProfileType
+
+	// Data holds the encoded profile. It must not be modified.
+	Data []byte
+}
+
+// Exporter exports batches of profiles. Exporters are configured using
+// WithExporter.
+type Exporter interface {
+	// Export exports the given batch. Batches are exported one at a time.
+	// The context is cancelled when the upload timeout expires, see
+	// WithUploadTimeout, or when the profiler is stopped.
+	Export(ctx context.Context, bat Batch) error
+}
+
+var errDatadogExporter = errors.New("profiler: the Datadog exporter can only be used with WithExporter")
+
+// datadogExporter is handled by the profiler itself, as its uploads are
+// retried and use the profiler configuration.
+type datadogExporter struct{}
+
+// Export implements Exporter.
+func (datadogExporter) Export(_ context.Context, _ Batch) error {
+	return errDatadogExporter
+}
+
+// DatadogExporter returns the exporter uploading profiles to the Datadog agent,
+// or to the Datadog intake when agentless uploads are enabled. It is the
+// default exporter, and must be passed to WithExporter alongside other
+// exporters to keep uploading profiles to Datadog.
+func DatadogExporter() Exporter {
+	return datadogExporter{}
+}
+
+// export passes bat to each of the configured exporters.
+func (p *profiler) export(bat batch) {
+	var exported *Batch
+	for _, e := range p.cfg.exporters {
+		if _, ok := e.(datadogExporter); ok {
+			if err := p.uploadFunc(bat); err != nil {
+				log.Error("Failed to upload profile: %v", err)
+			}
+			continue
+		}
+		if exported == nil {
+			exported = p.exportedBatch(bat)
+		}
+		ctx, cancel := p.uploadContext()
+		err := e.Export(ctx, *exported)
+		cancel()
+		if err != nil {
+			p.cfg.statsd.Count("datadog.profiling.go.export_error", 1, nil, 1)
+			log.Error("Failed to export profile: %v", err)
+		}
+	}
+}
+
+func (p *profiler) exportedBatch(bat batch) *Batch {
+	exported := &Batch{
+		Start:          bat.start,
+		End:            bat.end,
+		Tags:           p.batchTags(bat),
+		EndpointCounts: bat.endpointCounts,
+		SpanIDs:        bat.spanIDs,
+	}
+	for _, prof := range bat.profiles {
+		exported.Profiles = append(exported.Profiles, Profile{Name: prof.name, Type: prof.pt, Data: prof.data})
+	}
+	return exported
+}
+
+// uploadContext returns a context which is cancelled once the upload timeout
+// expires or the profiler is stopped.
+func (p *profiler) uploadContext() (context.Context, context.CancelFunc) {
+	// uploadTimeout is guaranteed to be >= 0, see newProfiler.
+	ctx, cancel := context.WithTimeout(context.Background(), p.cfg.uploadTimeout)
+	go func() {
+		select {
+		case <-p.exit:
+		case <-ctx.Done():
+		}
+		cancel()
+	}()
+	return ctx, cancel
+}
+
+// dirTimeFormat is the Basic ISO 8601 Format in UTC used as the name of the
+// directories batches are written to.
+const dirTimeFormat = "20060102T150405Z"
+
+type dirExporter struct {
+	dir  string
+	keep int
+}
+
+// DirExporter returns an exporter writing each batch into a new directory within
+// dir, named after the end time of the batch. Besides the profiles, the directory
+// holds an "event.json" file with the batch metadata, in the format used by the
+// Datadog intake. Only the keep most recent directories are kept, or all of them
+// if keep is 0.
+func DirExporter(dir string, keep int) Exporter {
+	return &dirExporter{dir: dir, keep: keep}
+}
+
+// Export implements Exporter.
+func (e *dirExporter) Export(_ context.Context, bat Batch) error {
+	if err := writeBatchDir(e.dir, bat, true); err != nil {
+		return err
+	}
+	if e.keep > 0 {
+		return rotateBatchDirs(e.dir, e.keep)
+	}
+	return nil
+}
+
+// writeBatchDir writes the profiles of bat, and optionally its metadata, into
+// a new directory within dir.
+func writeBatchDir(dir string, bat Batch, withEvent bool) error {
+	name := bat.End.UTC().Format(dirTimeFormat)
+	// 0755 is what mkdir does, should be reasonable for the use cases here.
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	dirPath := filepath.Join(dir, name)
+	for i := 1; ; i++ {
+		err := os.Mkdir(dirPath, 0755)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+		// several batches may end within the same second, e.g. captures
+		dirPath = filepath.Join(dir, fmt.Sprintf("%s-%d", name, i))
+	}
+	event := uploadEvent{
+		Version:        "4",
+		Family:         "go",
+		Start:          bat.Start.Format(time.RFC3339Nano),
+		End:            bat.End.Format(time.RFC3339Nano),
+		Tags:           strings.Join(bat.Tags, ","),
+		EndpointCounts: bat.EndpointCounts,
+		SpanIDs:        formatSpanIDs(bat.SpanIDs),
+	}
+	for _, prof := range bat.Profiles {
+		event.Attachments = append(event.Attachments, prof.Name)
+		// 0644 is what touch does, should be reasonable for the use cases here.
+		if err := os.WriteFile(filepath.Join(dirPath, prof.Name), prof.Data, 0644); err != nil {
+			return err
+		}
+	}
+	if !withEvent {
+		return nil
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dirPath, "event.json"), data, 0644)
+}
+
+// rotateBatchDirs removes the oldest batch directories within dir, keeping
+// the keep most recent ones. Other files are left untouched.
+func rotateBatchDirs(dir string, keep int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var dirs []string
+	for _, e := range entries {
+		name := e.Name()
+		if len(name) < len(dirTimeFormat) || !e.IsDir() {
+			continue
+		}
+		if _, err := time.Parse(dirTimeFormat, name[:len(dirTimeFormat)]); err == nil {
+			dirs = append(dirs, name)
+		}
+	}
+	if len(dirs) <= keep {
+		return nil
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		ti, si := splitBatchDir(dirs[i])
+		tj, sj := splitBatchDir(dirs[j])
+		if ti != tj {
+			return ti < tj
+		}
+		return si < sj
+	})
+	for _, name := range dirs[:len(dirs)-keep] {
+		if err := os.RemoveAll(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitBatchDir splits the name of a batch directory into its timestamp and
+// its collision suffix.
+func splitBatchDir(name string) (string, int) {
+	ts, suffix, _ := strings.Cut(name, "-")
+	n, _ := strconv.Atoi(suffix)
+	return ts, n
+}
+
+type pprofPushExporter struct {
+	url    string
+	client *http.Client
+}
+
+// PprofPushExporter returns an exporter pushing each pprof profile of a batch to
+// the given URL, using the HTTP API of Pyroscope-compatible servers, e.g.
+// "http://localhost:4040/ingest". Each profile is sent as a multipart form with
+// a "profile" file, and the query parameters name, from, until, format and
+// spyName. The name is made of the service, the profile type and the batch
+// tags, e.g. "my-service.cpu{env=prod,version=1.2}". Non-pprof profiles, such as
+// the metrics and the execution traces, are skipped. If client is nil,
+// http.DefaultClient is used.
+func PprofPushExporter(url string, client *http.Client) Exporter {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &pprofPushExporter{url: url, client: client}
+}
+
+// Export implements Exporter.
+func (e *pprofPushExporter) Export(ctx context.Context, bat Batch) error {
+	service, labels := pushLabels(bat.Tags)
+	for _, prof := range bat.Profiles {
+		if !strings.HasSuffix(prof.Name, ".pprof") {
+			continue
+		}
+		if err := e.push(ctx, service+"."+prof.Type.String()+labels, bat, prof); err != nil {
+			return fmt.Errorf("pushing %s: %v", prof.Name, err)
+		}
+	}
+	return nil
+}
+
+func (e *pprofPushExporter) push(ctx context.Context, name string, bat Batch, prof Profile) error {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	f, err := mw.CreateFormFile("profile", prof.Name)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(prof.Data); err != nil {
+		return err
+	}
+	if err := mw.Close(); err != nil {
+		return err
+	}
+	u, err := url.Parse(e.url)
+	if err != nil {
+		return err
+	}
+	q := u.Query()
+	q.Set("name", name)
+	q.Set("from", strconv.FormatInt(bat.Start.Unix(), 10))
+	q.Set("until", strconv.FormatInt(bat.End.Unix(), 10))
+	q.Set("format", "pprof")
+	q.Set("spyName", "gospy")
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, "POST", u.String(), &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
+
+// pushLabels returns the service and the "{k=v,...}" labels of the given
+// tags. Tags which can't be represented as labels, and tags varying on each
+// batch, are left out.
+func pushLabels(tags []string) (service string, labels string) {
+	var kvs []string
+	for _, t := range tags {
+		k, v, ok := strings.Cut(t, ":")
+		switch {
+		case !ok:
+			continue
+		case k == "service":
+			service = v
+			continue
+		case k == "profile_seq", !isLabelName(k), strings.ContainsAny(v, ",{}=\""):
+			continue
+		}
+		kvs = append(kvs, k+"="+v)
+	}
+	if len(kvs) == 0 {
+		return service, ""
+	}
+	return service, "{" + strings.Join(kvs, ",") + "}"
+}
+
+// isLabelName reports whether s is a valid label name, matching [a-zA-Z_][a-zA-Z0-9_.]*.
+func isLabelName(s string) bool {
+	for i, c := range s {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case i > 0 && (c == '.' || c >= '0' && c <= '9'):
+		default:
+			return false
+		}
+	}
+	return s != ""
+}
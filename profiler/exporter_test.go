@@ -0,0 +1,162 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package profiler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type exporterFunc func(ctx context.Context, bat Batch) error
+
+func (f exporterFunc) Export(ctx context.Context, bat Batch) error { return f(ctx, bat) }
+
+func TestWithExporter(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		p, err := unstartedProfiler()
+		require.NoError(t, err)
+		assert.Equal(t, []Exporter{DatadogExporter()}, p.cfg.exporters)
+		assert.Equal(t, errDatadogExporter, DatadogExporter().Export(context.Background(), Batch{}))
+	})
+
+	t.Run("custom", func(t *testing.T) {
+		var got []Batch
+		p, err := unstartedProfiler(
+			WithService("my-service"),
+			WithEnv("prod"),
+			WithExporter(exporterFunc(func(ctx context.Context, bat Batch) error {
+				_, ok := ctx.Deadline()
+				assert.True(t, ok)
+				got = append(got, bat)
+				return nil
+			})),
+		)
+		require.NoError(t, err)
+		uploaded := false
+		p.uploadFunc = func(batch) error {
+			uploaded = true
+			return nil
+		}
+		p.export(testBatch)
+
+		assert.False(t, uploaded, "the Datadog exporter was replaced")
+		require.Len(t, got, 1)
+		bat := got[0]
+		assert.Equal(t, testBatch.start, bat.Start)
+		assert.Equal(t, testBatch.end, bat.End)
+		assert.Subset(t, bat.Tags, []string{"service:my-service", "env:prod", "profile_seq:23", "host:my-host", "runtime:go"})
+		require.Len(t, bat.Profiles, 2)
+		assert.Equal(t, Profile{Name: "cpu.pprof", Data: []byte("my-cpu-profile")}, bat.Profiles[0])
+	})
+
+	t.Run("datadog", func(t *testing.T) {
+		p, err := unstartedProfiler(WithExporter(DatadogExporter(), DirExporter(t.TempDir(), 1)))
+		require.NoError(t, err)
+		uploaded := false
+		p.uploadFunc = func(batch) error {
+			uploaded = true
+			return nil
+		}
+		p.export(testBatch)
+		assert.True(t, uploaded)
+	})
+}
+
+func TestDirExporter(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README"), nil, 0644))
+	e := DirExporter(dir, 2)
+	start := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	// batches ending within the same second get distinct directories
+	for _, end := range []time.Time{start, start, start.Add(time.Minute), start.Add(2 * time.Minute)} {
+		bat := Batch{
+			Start:    end.Add(-time.Minute),
+			End:      end,
+			Tags:     []string{"service:svc"},
+			Profiles: []Profile{{Name: "cpu.pprof", Type: CPUProfile, Data: []byte("cpu")}},
+		}
+		require.NoError(t, e.Export(context.Background(), bat))
+	}
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{"20230102T030505Z", "20230102T030605Z", "README"}, names)
+
+	data, err := os.ReadFile(filepath.Join(dir, "20230102T030605Z", "cpu.pprof"))
+	require.NoError(t, err)
+	assert.Equal(t, "cpu", string(data))
+	data, err = os.ReadFile(filepath.Join(dir, "20230102T030605Z", "event.json"))
+	require.NoError(t, err)
+	var event uploadEvent
+	require.NoError(t, json.Unmarshal(data, &event))
+	assert.Equal(t, []string{"cpu.pprof"}, event.Attachments)
+	assert.Equal(t, "service:svc", event.Tags)
+}
+
+func TestPprofPushExporter(t *testing.T) {
+	type push struct {
+		query   map[string]string
+		profile string
+	}
+	var got []push
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, _, err := r.FormFile("profile")
+		require.NoError(t, err)
+		data, err := io.ReadAll(f)
+		require.NoError(t, err)
+		query := map[string]string{}
+		for k := range r.URL.Query() {
+			query[k] = r.URL.Query().Get(k)
+		}
+		got = append(got, push{query: query, profile: string(data)})
+		if query["name"] == "svc.heap{env=prod}" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	start := time.Unix(1000, 0)
+	bat := Batch{
+		Start: start,
+		End:   start.Add(time.Minute),
+		Tags:  []string{"service:svc", "env:prod", "profile_seq:3", "invalid-key:x", "x:a,b"},
+		Profiles: []Profile{
+			{Name: "cpu.pprof", Type: CPUProfile, Data: []byte("cpu")},
+			{Name: "metrics.json", Type: MetricsProfile, Data: []byte("{}")},
+		},
+	}
+	e := PprofPushExporter(server.URL+"/ingest", nil)
+	require.NoError(t, e.Export(context.Background(), bat))
+	assert.Equal(t, []push{{
+		query: map[string]string{
+			"name":    "svc.cpu{env=prod}",
+			"from":    "1000",
+			"until":   "1060",
+			"format":  "pprof",
+			"spyName": "gospy",
+		},
+		profile: "cpu",
+	}}, got)
+
+	bat.Profiles = []Profile{{Name: "delta-heap.pprof", Type: HeapProfile}}
+	assert.EqualError(t, e.Export(context.Background(), bat), "pushing delta-heap.pprof: 400 Bad Request")
+}
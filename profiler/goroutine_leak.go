@@ -0,0 +1,241 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package profiler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DataDog/gostackparse"
+	pprofile "github.com/google/pprof/profile"
+)
+
+const (
+	// DefaultLeakGrowthPeriods is the default number of consecutive
+	// profiling periods a group of goroutines must grow for to be reported
+	// as leaking.
+	DefaultLeakGrowthPeriods = 3
+
+	// DefaultLeakBlockedDuration is the default amount of time goroutines
+	// must be blocked for to be reported as leaking.
+	DefaultLeakBlockedDuration = 10 * time.Minute
+)
+
+// leak reasons, used as the "leak reason" label of goroutine leak profiles
+// and as the "reason" tag of the metrics.
+const (
+	leakGrowing = "growing"
+	leakBlocked = "blocked"
+)
+
+// leakDetector tracks goroutines grouped by the call site which created them
+// across profiling periods, to find groups which keep growing, and
+// goroutines which stay blocked. It is only used by the collection of
+// GoroutineLeakProfile, which runs once per period.
+type leakDetector struct {
+	growthPeriods int
+	blockedFor    time.Duration
+	// history holds the number of goroutines of each group over the last
+	// periods, oldest first.
+	history map[string][]int
+}
+
+func newLeakDetector(growthPeriods int, blockedFor time.Duration) *leakDetector {
+	return &leakDetector{
+		growthPeriods: growthPeriods,
+		blockedFor:    blockedFor,
+		history:       make(map[string][]int),
+	}
+}
+
+// leakGroup is a group of goroutines created by the same call site which is
+// suspected of leaking.
+type leakGroup struct {
+	createdBy string
+	growing   bool // whether the group kept growing
+	// goroutines holds the offending goroutines, i.e. all of them if the
+	// group is growing, or the blocked ones otherwise.
+	goroutines []*gostackparse.Goroutine
+}
+
+// reason returns the leak reason of g, which belongs to a leak group.
+func (d *leakDetector) reason(g *gostackparse.Goroutine) string {
+	if g.Wait >= d.blockedFor {
+		return leakBlocked
+	}
+	return leakGrowing
+}
+
+// update records the given goroutines as the ones of a new period, and
+// returns the groups suspected of leaking, sorted by creating call site.
+func (d *leakDetector) update(goroutines []*gostackparse.Goroutine) []*leakGroup {
+	groups := make(map[string][]*gostackparse.Goroutine)
+	for _, g := range goroutines {
+		if g.CreatedBy == nil {
+			// main and runtime goroutines
+			continue
+		}
+		createdBy := g.CreatedBy.Func + " " + g.CreatedBy.File + ":" + strconv.Itoa(g.CreatedBy.Line)
+		groups[createdBy] = append(groups[createdBy], g)
+	}
+	for createdBy := range d.history {
+		if _, ok := groups[createdBy]; !ok {
+			delete(d.history, createdBy)
+		}
+	}
+	var leaks []*leakGroup
+	for createdBy, gs := range groups {
+		h := append(d.history[createdBy], len(gs))
+		if len(h) > d.growthPeriods+1 {
+			h = h[len(h)-d.growthPeriods-1:]
+		}
+		d.history[createdBy] = h
+		leak := &leakGroup{createdBy: createdBy, growing: isGrowing(h, d.growthPeriods)}
+		for _, g := range gs {
+			if leak.growing || g.Wait >= d.blockedFor {
+				leak.goroutines = append(leak.goroutines, g)
+			}
+		}
+		if len(leak.goroutines) > 0 {
+			leaks = append(leaks, leak)
+		}
+	}
+	sort.Slice(leaks, func(i, j int) bool { return leaks[i].createdBy < leaks[j].createdBy })
+	return leaks
+}
+
+// isGrowing reports whether the given counts grew during each of the last n
+// periods.
+func isGrowing(counts []int, n int) bool {
+	if len(counts) < n+1 {
+		return false
+	}
+	for i := len(counts) - n; i < len(counts); i++ {
+		if counts[i] <= counts[i-1] {
+			return false
+		}
+	}
+	return true
+}
+
+// collectGoroutineLeaks collects the goroutines of the program and returns the
+// goroutine leak profile for the current period.
+func (p *profiler) collectGoroutineLeaks() ([]byte, error) {
+	if n := runtime.NumGoroutine(); n > p.cfg.maxGoroutinesWait {
+		return nil, fmt.Errorf("skipping goroutine leak profile: %d goroutines exceeds DD_PROFILING_WAIT_PROFILE_MAX_GOROUTINES limit of %d", n, p.cfg.maxGoroutinesWait)
+	}
+	p.cycleSleep(p.cycle.period)
+
+	var buf bytes.Buffer
+	sw := startStopwatch()
+	defer func() { p.overhead.record("goroutineleak", stageCollect, sw.stop(buf.Len())) }()
+	text, _, err := p.lookupGoroutineDump()
+	if err != nil {
+		return nil, err
+	}
+	goroutines, err := parseGoroutines(bytes.NewReader(text))
+	if err != nil {
+		return nil, err
+	}
+	leaks := p.leaks.update(goroutines)
+	for _, leak := range leaks {
+		byReason := make(map[string]int64)
+		for _, g := range leak.goroutines {
+			byReason[p.leaks.reason(g)]++
+		}
+		for reason, n := range byReason {
+			tags := append(p.cfg.tags.Slice(), "created_by:"+strings.SplitN(leak.createdBy, " ", 2)[0], "reason:"+reason)
+			p.cfg.statsd.Count("datadog.profiling.go.goroutine_leak.goroutines", n, tags, 1)
+		}
+	}
+	err = p.leaks.writeProfile(&buf, leaks, now())
+	return buf.Bytes(), err
+}
+
+// parseGoroutines parses a goroutine dump in the debug=2 format, recovering
+// from unexpected panics like goroutineDebug2ToPprof.
+func parseGoroutines(r io.Reader) (goroutines []*gostackparse.Goroutine, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	goroutines, _ = gostackparse.Parse(r)
+	return goroutines, nil
+}
+
+// writeProfile writes a pprof profile holding the stacks of the goroutines of
+// the given leak groups, labeled with their leak reason and creating call site.
+func (d *leakDetector) writeProfile(w io.Writer, leaks []*leakGroup, t time.Time) error {
+	p := &pprofile.Profile{
+		TimeNanos:  t.UnixNano(),
+		SampleType: []*pprofile.ValueType{{Type: "goroutines", Unit: "count"}},
+		PeriodType: &pprofile.ValueType{Type: "goroutines", Unit: "count"},
+	}
+	m := &pprofile.Mapping{ID: 1, HasFunctions: true}
+	p.Mapping = []*pprofile.Mapping{m}
+	functions := make(map[string]*pprofile.Function)
+	locations := make(map[gostackparse.Frame]*pprofile.Location)
+	location := func(f gostackparse.Frame) *pprofile.Location {
+		if loc, ok := locations[f]; ok {
+			return loc
+		}
+		fn, ok := functions[f.Func+"\x00"+f.File]
+		if !ok {
+			fn = &pprofile.Function{ID: uint64(len(p.Function) + 1), Name: f.Func, Filename: f.File}
+			p.Function = append(p.Function, fn)
+			functions[f.Func+"\x00"+f.File] = fn
+		}
+		loc := &pprofile.Location{
+			ID:      uint64(len(p.Location) + 1),
+			Mapping: m,
+			Line:    []pprofile.Line{{Function: fn, Line: int64(f.Line)}},
+		}
+		p.Location = append(p.Location, loc)
+		locations[f] = loc
+		return loc
+	}
+	// Goroutines with the same stack, creating call site and reason are
+	// aggregated into a single sample.
+	samples := make(map[string]*pprofile.Sample)
+	for _, leak := range leaks {
+		for _, g := range leak.goroutines {
+			stack := append(g.Stack[:len(g.Stack):len(g.Stack)], g.CreatedBy)
+			reason := d.reason(g)
+			var key strings.Builder
+			key.WriteString(reason + "\x00" + leak.createdBy)
+			for _, f := range stack {
+				fmt.Fprintf(&key, "\x00%s:%s:%d", f.Func, f.File, f.Line)
+			}
+			if s, ok := samples[key.String()]; ok {
+				s.Value[0]++
+				continue
+			}
+			s := &pprofile.Sample{
+				Value: []int64{1},
+				Label: map[string][]string{
+					"leak reason": {reason},
+					"created by":  {leak.createdBy},
+				},
+			}
+			for _, f := range stack {
+				s.Location = append(s.Location, location(*f))
+			}
+			samples[key.String()] = s
+			p.Sample = append(p.Sample, s)
+		}
+	}
+	if err := p.CheckValid(); err != nil {
+		return fmt.Errorf("goroutine leak profile: %v", err)
+	}
+	return p.Write(w)
+}
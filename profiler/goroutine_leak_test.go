@@ -0,0 +1,171 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package profiler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DataDog/gostackparse"
+	pprofile "github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// leakDump returns a goroutine dump in the debug=2 format holding n goroutines
+// created by each of the given functions, and blocked for the given number of
+// minutes.
+func leakDump(n map[string]int, minutes int) string {
+	var dump strings.Builder
+	id := 1
+	fmt.Fprintf(&dump, "goroutine %d [running]:\nmain.main()\n\t/example/main.go:10 +0x3d2\n\n", id)
+	for _, fn := range []string{"main.worker", "main.server"} {
+		for i := 0; i < n[fn]; i++ {
+			id++
+			fmt.Fprintf(&dump, "goroutine %d [chan receive, %d minutes]:\nmain.wait()\n\t/example/main.go:20 +0xbf\n", id, minutes)
+			fmt.Fprintf(&dump, "created by %s\n\t/example/main.go:30 +0x35\n\n", fn)
+		}
+	}
+	return dump.String()
+}
+
+func parseLeakDump(t *testing.T, dump string) []*gostackparse.Goroutine {
+	goroutines, err := parseGoroutines(strings.NewReader(dump))
+	require.NoError(t, err)
+	return goroutines
+}
+
+func TestLeakDetector(t *testing.T) {
+	createdBy := func(leaks []*leakGroup) []string {
+		var got []string
+		for _, l := range leaks {
+			got = append(got, fmt.Sprintf("%s %v %d", l.createdBy, l.growing, len(l.goroutines)))
+		}
+		return got
+	}
+
+	t.Run("growing", func(t *testing.T) {
+		d := newLeakDetector(2, time.Hour)
+		leaks := d.update(parseLeakDump(t, leakDump(map[string]int{"main.worker": 1, "main.server": 2}, 0)))
+		assert.Empty(t, leaks)
+		leaks = d.update(parseLeakDump(t, leakDump(map[string]int{"main.worker": 2, "main.server": 2}, 0)))
+		assert.Empty(t, leaks, "not growing for long enough")
+		leaks = d.update(parseLeakDump(t, leakDump(map[string]int{"main.worker": 3, "main.server": 1}, 0)))
+		assert.Equal(t, []string{"main.worker /example/main.go:30 true 3"}, createdBy(leaks))
+		leaks = d.update(parseLeakDump(t, leakDump(map[string]int{"main.worker": 3, "main.server": 1}, 0)))
+		assert.Empty(t, leaks, "stopped growing")
+	})
+
+	t.Run("blocked", func(t *testing.T) {
+		d := newLeakDetector(2, 10*time.Minute)
+		leaks := d.update(parseLeakDump(t, leakDump(map[string]int{"main.worker": 1}, 5)))
+		assert.Empty(t, leaks)
+		leaks = d.update(parseLeakDump(t, leakDump(map[string]int{"main.worker": 1, "main.server": 2}, 10)))
+		assert.Equal(t, []string{
+			"main.server /example/main.go:30 false 2",
+			"main.worker /example/main.go:30 false 1",
+		}, createdBy(leaks))
+		assert.Equal(t, leakBlocked, d.reason(leaks[0].goroutines[0]))
+	})
+
+	t.Run("history", func(t *testing.T) {
+		d := newLeakDetector(1, time.Hour)
+		for i := 1; i <= 5; i++ {
+			d.update(parseLeakDump(t, leakDump(map[string]int{"main.worker": i}, 0)))
+		}
+		assert.Equal(t, map[string][]int{"main.worker /example/main.go:30": {4, 5}}, d.history)
+		d.update(parseLeakDump(t, leakDump(map[string]int{"main.server": 1}, 0)))
+		assert.Equal(t, map[string][]int{"main.server /example/main.go:30": {1}}, d.history, "gone groups are forgotten")
+	})
+}
+
+func TestGoroutineLeakProfile(t *testing.T) {
+	dumps := []string{
+		leakDump(map[string]int{"main.worker": 1, "main.server": 1}, 0),
+		leakDump(map[string]int{"main.worker": 2, "main.server": 1}, 20),
+	}
+	statsd := &statsdRecorder{}
+	p, err := unstartedProfiler(
+		WithPeriod(10*time.Millisecond),
+		WithProfileTypes(GoroutineLeakProfile),
+		WithGoroutineLeakThresholds(1, 15*time.Minute),
+		WithStatsd(statsd),
+	)
+	require.NoError(t, err)
+	p.testHooks.lookupProfile = func(name string, w io.Writer, debug int) error {
+		require.Equal(t, "goroutine", name)
+		require.Equal(t, 2, debug)
+		_, err := io.WriteString(w, dumps[0])
+		dumps = dumps[1:]
+		return err
+	}
+
+	profs, err := p.runProfile(GoroutineLeakProfile)
+	require.NoError(t, err)
+	require.Equal(t, "goroutineleaks.pprof", profs[0].name)
+	pp, err := pprofile.Parse(bytes.NewReader(profs[0].data))
+	require.NoError(t, err)
+	assert.Empty(t, pp.Sample)
+
+	profs, err = p.runProfile(GoroutineLeakProfile)
+	require.NoError(t, err)
+	pp, err = pprofile.Parse(bytes.NewReader(profs[0].data))
+	require.NoError(t, err)
+	require.Len(t, pp.Sample, 2)
+	got := make(map[string]int64)
+	for _, s := range pp.Sample {
+		var stack []string
+		for _, loc := range s.Location {
+			stack = append(stack, loc.Line[0].Function.Name)
+		}
+		assert.Equal(t, []string{"main.wait", s.Label["created by"][0][:strings.Index(s.Label["created by"][0], " ")]}, stack)
+		got[s.Label["leak reason"][0]+" "+s.Label["created by"][0]] = s.Value[0]
+	}
+	assert.Equal(t, map[string]int64{
+		"blocked main.server /example/main.go:30": 1,
+		"blocked main.worker /example/main.go:30": 2,
+	}, got, "goroutines blocked long enough are blocked rather than growing")
+	assert.Equal(t, map[string]int64{
+		"datadog.profiling.go.goroutine_leak.goroutines reason:blocked": 3,
+	}, statsd.counts)
+
+	_, err = unstartedProfiler(WithGoroutineLeakThresholds(0, time.Minute))
+	assert.Error(t, err)
+}
+
+func TestGoroutineLeakProfileSharedDump(t *testing.T) {
+	p, err := unstartedProfiler(
+		WithPeriod(10*time.Millisecond),
+		WithProfileTypes(GoroutineLeakProfile),
+	)
+	require.NoError(t, err)
+	var dumps int
+	p.testHooks.lookupProfile = func(_ string, w io.Writer, _ int) error {
+		dumps++
+		_, err := io.WriteString(w, leakDump(map[string]int{"main.worker": 1}, 0))
+		return err
+	}
+
+	var bat batch
+	p.collectProfiles(&bat, []ProfileType{expGoroutineWaitProfile, GoroutineLeakProfile})
+	var names []string
+	for _, prof := range bat.profiles {
+		names = append(names, prof.name)
+	}
+	assert.ElementsMatch(t, []string{"goroutineswait.pprof", "goroutineleaks.pprof"}, names)
+	assert.Equal(t, 1, dumps, "the goroutine dump is shared")
+	assert.Nil(t, p.goroutineDump)
+}
+
+func TestParseGoroutinesCrashSafety(t *testing.T) {
+	_, err := parseGoroutines(panicReader{})
+	require.Error(t, err)
+	assert.Equal(t, "panic: 42", err.Error())
+}
@@ -0,0 +1,146 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package profiler
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"path"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pprofile "github.com/google/pprof/profile"
+)
+
+// HandlerBatches is the number of recent profile batches kept in memory once
+// Handler has been called.
+const HandlerBatches = 5
+
+// recentBatches holds the last batches collected by the profiler, for Handler.
+type recentBatches struct {
+	mu      sync.Mutex
+	batches []batch // oldest first
+}
+
+// activeRecentBatches is set by Handler. Until then, the profiler doesn't keep
+// any batch.
+var activeRecentBatches atomic.Pointer[recentBatches]
+
+func (r *recentBatches) add(bat batch) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.batches) == HandlerBatches {
+		r.batches = append(r.batches[:0], r.batches[1:]...)
+	}
+	r.batches = append(r.batches, bat)
+}
+
+// profiles returns the kept profiles of the given type, oldest first, along
+// with the time ranges of their batches.
+func (r *recentBatches) profiles(pt ProfileType) (profs []*profile, starts, ends []time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, bat := range r.batches {
+		for _, prof := range bat.profiles {
+			if prof.pt == pt {
+				profs = append(profs, prof)
+				starts = append(starts, bat.start)
+				ends = append(ends, bat.end)
+			}
+		}
+	}
+	return profs, starts, ends
+}
+
+// Handler returns an http.Handler serving the profiles recently collected by
+// the profiler, so that they can be inspected with "go tool pprof" without the
+// Datadog backend. Once Handler has been called, the profiler keeps the last
+// HandlerBatches batches in memory. The handler serves the following paths,
+// relative to where it is mounted:
+//
+//   - /cpu: the CPU profiles of the kept batches, merged.
+//   - /heap: the most recent delta heap profile, as uploaded by the
+//     profiler. It covers the last profiling period, or the whole process
+//     lifetime if delta profiles are disabled, see WithDeltaProfiles.
+//   - /mutex and /block: like /heap, when the profile types are enabled.
+//   - /goroutine: the most recent goroutine profile.
+//   - /trace: the most recent execution trace.
+//
+// For example:
+//
+//	http.Handle("/debug/datadog/", http.StripPrefix("/debug/datadog", profiler.Handler()))
+//
+// and then:
+//
+//	go tool pprof http://localhost:8080/debug/datadog/heap
+func Handler() http.Handler {
+	activeRecentBatches.CompareAndSwap(nil, new(recentBatches))
+	return &handler{recent: activeRecentBatches.Load()}
+}
+
+type handler struct {
+	recent *recentBatches
+}
+
+// handlerProfiles maps the paths served by the handler to profile types.
+var handlerProfiles = map[string]ProfileType{
+	"cpu":       CPUProfile,
+	"heap":      HeapProfile,
+	"mutex":     MutexProfile,
+	"block":     BlockProfile,
+	"goroutine": GoroutineProfile,
+	"trace":     executionTrace,
+}
+
+// ServeHTTP implements http.Handler.
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := path.Base(r.URL.Path)
+	pt, ok := handlerProfiles[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	profs, starts, ends := h.recent.profiles(pt)
+	if len(profs) == 0 {
+		http.Error(w, fmt.Sprintf("no %s profile collected yet", name), http.StatusNotFound)
+		return
+	}
+	data := profs[len(profs)-1].data
+	if pt == CPUProfile {
+		var err error
+		if data, err = mergeProfiles(profs, starts[0], ends[len(ends)-1]); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, profs[0].name))
+	w.Write(data)
+}
+
+// mergeProfiles merges the given profiles into a single one covering the
+// period from start to end.
+func mergeProfiles(profs []*profile, start, end time.Time) ([]byte, error) {
+	parsed := make([]*pprofile.Profile, 0, len(profs))
+	for _, prof := range profs {
+		pp, err := pprofile.ParseData(prof.data)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, pp)
+	}
+	merged, err := pprofile.Merge(parsed)
+	if err != nil {
+		return nil, err
+	}
+	merged.TimeNanos = start.UnixNano()
+	merged.DurationNanos = end.Sub(start).Nanoseconds()
+	var buf bytes.Buffer
+	err = merged.Write(&buf)
+	return buf.Bytes(), err
+}
@@ -0,0 +1,77 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package profiler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	pprofile "github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler(t *testing.T) {
+	defer activeRecentBatches.Store(nil)
+	server := httptest.NewServer(http.StripPrefix("/debug", Handler()))
+	defer server.Close()
+
+	get := func(path string) (int, []byte) {
+		resp, err := http.Get(server.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, data
+	}
+	code, _ := get("/debug/cpu")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	start := time.Unix(1000, 0)
+	for i := 0; i < HandlerBatches+1; i++ {
+		end := start.Add(time.Duration(i+1) * time.Minute)
+		bat := batch{start: end.Add(-time.Minute), end: end}
+		bat.addProfile(&profile{name: "cpu.pprof", pt: CPUProfile, data: textProfile{Text: `
+samples/count cpu/nanoseconds
+main;foo 1 10
+`}.Protobuf()})
+		bat.addProfile(&profile{name: "goroutines.pprof", pt: GoroutineProfile, data: []byte("goroutines")})
+		bat.addProfile(&profile{name: "delta-heap.pprof", pt: HeapProfile, data: []byte(fmt.Sprintf("delta %d", i))})
+		activeRecentBatches.Load().add(bat)
+	}
+
+	t.Run("cpu", func(t *testing.T) {
+		code, data := get("/debug/cpu")
+		require.Equal(t, http.StatusOK, code)
+		prof, err := pprofile.ParseData(data)
+		require.NoError(t, err)
+		// the first batch was evicted
+		assert.Equal(t, start.Add(time.Minute).UnixNano(), prof.TimeNanos)
+		assert.Equal(t, (time.Duration(HandlerBatches) * time.Minute).Nanoseconds(), prof.DurationNanos)
+		assert.Equal(t, "samples/count cpu/nanoseconds\nmain;foo 5 50\n", protobufToText(data))
+	})
+
+	t.Run("heap", func(t *testing.T) {
+		// the delta profile is served as uploaded
+		code, data := get("/debug/heap")
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, fmt.Sprintf("delta %d", HandlerBatches), string(data))
+	})
+
+	t.Run("latest", func(t *testing.T) {
+		code, data := get("/debug/goroutine")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "goroutines", string(data))
+		code, _ = get("/debug/trace")
+		assert.Equal(t, http.StatusNotFound, code)
+		code, _ = get("/debug/unknown")
+		assert.Equal(t, http.StatusNotFound, code)
+	})
+}
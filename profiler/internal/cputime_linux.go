@@ -0,0 +1,38 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package internal
+
+import (
+	"syscall"
+	"time"
+)
+
+// rusageThread is RUSAGE_THREAD, which the syscall package doesn't define.
+const rusageThread = 1
+
+// ThreadCPUTime returns the CPU time used by the calling thread.
+func ThreadCPUTime() time.Duration {
+	return rusageCPUTime(rusageThread)
+}
+
+// ThreadID returns the ID of the calling thread.
+func ThreadID() int {
+	return syscall.Gettid()
+}
+
+// ProcessCPUTime returns the CPU time used by the process, and whether it
+// could be measured.
+func ProcessCPUTime() (time.Duration, bool) {
+	return rusageCPUTime(syscall.RUSAGE_SELF), true
+}
+
+func rusageCPUTime(who int) time.Duration {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(who, &ru); err != nil {
+		return 0
+	}
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano())
+}
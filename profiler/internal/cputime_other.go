@@ -0,0 +1,27 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+//go:build !linux
+
+package internal
+
+import "time"
+
+// ThreadCPUTime returns the CPU time used by the calling thread. It is only
+// measured on Linux.
+func ThreadCPUTime() time.Duration {
+	return 0
+}
+
+// ThreadID returns the ID of the calling thread. It is only known on Linux.
+func ThreadID() int {
+	return 0
+}
+
+// ProcessCPUTime returns the CPU time used by the process, and whether it
+// could be measured. It is only measured on Linux.
+func ProcessCPUTime() (time.Duration, bool) {
+	return 0, false
+}
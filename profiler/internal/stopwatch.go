@@ -5,7 +5,9 @@
 
 package internal
 
-import "time"
+import (
+	"time"
+)
 
 // Stopwatch is used to time code execution.
 type Stopwatch struct {
@@ -28,3 +30,33 @@ func (s *Stopwatch) Tick() time.Duration {
 	s.prev = now
 	return td
 }
+
+// CPUStopwatch measures the wall and CPU time spent by the calling goroutine.
+// The CPU time is the one of the thread running the goroutine, which is only
+// measured on Linux, see ThreadCPUTime. As the goroutine isn't locked to its
+// thread, it is an approximation: it is only measured if the goroutine runs on
+// the same thread when the stopwatch starts and stops, and then includes the
+// time of any other goroutine which ran on that thread in between, up to the
+// wall time.
+type CPUStopwatch struct {
+	start  time.Time
+	thread int
+	cpu    time.Duration
+}
+
+// StartCPUStopwatch starts a CPU stopwatch.
+func StartCPUStopwatch() CPUStopwatch {
+	return CPUStopwatch{start: time.Now(), thread: ThreadID(), cpu: ThreadCPUTime()}
+}
+
+// Stop returns the wall and CPU time elapsed since the stopwatch started.
+func (s CPUStopwatch) Stop() (wall, cpu time.Duration) {
+	wall = time.Since(s.start)
+	if ThreadID() != s.thread {
+		return wall, 0
+	}
+	if cpu = ThreadCPUTime() - s.cpu; cpu > wall {
+		cpu = wall
+	}
+	return wall, cpu
+}
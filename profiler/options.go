@@ -110,6 +110,31 @@ type config struct {
 	logStartup           bool
 	traceConfig          executionTraceConfig
 	endpointCountEnabled bool
+	capture              captureConfig
+	traceWindow          traceWindowConfig
+	overheadBudget       float64
+	pgo                  *PGOConfig
+	exporters            []Exporter
+	spanCPUMetrics       bool
+	contentionTopN       int
+	leakGrowthPeriods    int
+	leakBlockedFor       time.Duration
+}
+
+// traceWindowConfig holds the configuration of trace windows, see
+// WithExecutionTraceWindows.
+type traceWindowConfig struct {
+	triggers []TraceWindowTrigger
+	duration time.Duration // length of the execution traces
+}
+
+// captureConfig holds the configuration of on-demand captures, see CaptureNow.
+type captureConfig struct {
+	types         []ProfileType // types captured unless specified otherwise
+	duration      time.Duration // length of the captured profiles
+	rateLimit     time.Duration // minimum amount of time between captures
+	triggers      []CaptureTrigger
+	checkInterval time.Duration // how often triggers are checked
 }
 
 // logStartup records the configuration to the configured logger in JSON format
@@ -144,6 +169,18 @@ func logStartup(c *config) {
 		"execution_trace_period":     c.traceConfig.Period.String(),
 		"execution_trace_size_limit": c.traceConfig.Limit,
 		"endpoint_count_enabled":     c.endpointCountEnabled,
+		"capture_duration":           c.capture.duration.String(),
+		"capture_rate_limit":         c.capture.rateLimit.String(),
+		"capture_triggers":           len(c.capture.triggers),
+		"trace_window_triggers":      len(c.traceWindow.triggers),
+		"trace_window_duration":      c.traceWindow.duration.String(),
+		"overhead_budget":            c.overheadBudget,
+		"pgo_enabled":                c.pgo != nil,
+		"exporters":                  exporterNames(c.exporters),
+		"span_cpu_metrics":           c.spanCPUMetrics,
+		"contention_report_top_n":    c.contentionTopN,
+		"leak_growth_periods":        c.leakGrowthPeriods,
+		"leak_blocked_duration":      c.leakBlockedFor.String(),
 	}
 	b, err := json.Marshal(info)
 	if err != nil {
@@ -194,6 +231,18 @@ func defaultConfig() (*config, error) {
 		deltaProfiles:        internal.BoolEnv("DD_PROFILING_DELTA", true),
 		logStartup:           internal.BoolEnv("DD_TRACE_STARTUP_LOGS", true),
 		endpointCountEnabled: internal.BoolEnv(traceprof.EndpointCountEnvVar, false),
+		exporters:            []Exporter{DatadogExporter()},
+		leakGrowthPeriods:    DefaultLeakGrowthPeriods,
+		leakBlockedFor:       DefaultLeakBlockedDuration,
+		capture: captureConfig{
+			types:         defaultCaptureTypes,
+			duration:      DefaultCaptureDuration,
+			rateLimit:     DefaultCaptureRateLimit,
+			checkInterval: defaultTriggerCheckInterval,
+		},
+		traceWindow: traceWindowConfig{
+			duration: DefaultTraceWindowDuration,
+		},
 	}
 	c.tags = c.tags.Append(fmt.Sprintf("process_id:%d", os.Getpid()))
 	for _, t := range defaultProfileTypes {
@@ -491,6 +540,82 @@ func withOutputDir(dir string) Option {
 	}
 }
 
+// WithExporter sets the exporters receiving the collected profiles, replacing
+// the default DatadogExporter. Pass DatadogExporter along with other exporters
+// to keep uploading profiles to Datadog, e.g.
+//
+//	profiler.WithExporter(profiler.DatadogExporter(), profiler.DirExporter("/tmp/profiles", 10))
+func WithExporter(exporters ...Exporter) Option {
+	return func(cfg *config) {
+		cfg.exporters = exporters
+	}
+}
+
+// exporterNames returns the names of the given exporters, for logging.
+func exporterNames(exporters []Exporter) []string {
+	names := make([]string, 0, len(exporters))
+	for _, e := range exporters {
+		switch e.(type) {
+		case datadogExporter:
+			names = append(names, "datadog")
+		case *dirExporter:
+			names = append(names, "dir")
+		case *pprofPushExporter:
+			names = append(names, "pprof_push")
+		default:
+			names = append(names, fmt.Sprintf("%T", e))
+		}
+	}
+	return names
+}
+
+// WithSpanCPUMetrics enables reporting the CPU time spent by each endpoint to
+// the configured statsd client, by aggregating the samples of each CPU profile
+// by the endpoint labels applied by the tracer. The CPU time of each endpoint
+// is reported as the datadog.profiling.go.endpoint_cpu_ns count, and the
+// number of requests found in its samples as the
+// datadog.profiling.go.endpoint_cpu_requests count, both tagged with
+// "endpoint:<resource>", so that their ratio gives the CPU cost of a request.
+// Both code hotspots and endpoint profiling must be enabled in the tracer. As
+// the CPU profiler only runs for part of each profiling period, see WithPeriod
+// and CPUDuration, these values are samples of the actual CPU time.
+func WithSpanCPUMetrics(enabled bool) Option {
+	return func(cfg *config) {
+		cfg.spanCPUMetrics = enabled
+	}
+}
+
+// WithContentionReport enables reporting the n call sites with the most lock
+// contention during each profiling period to the configured statsd client,
+// based on the delta mutex and block profiles, whichever are enabled. For
+// each call site, tagged with "call_site:<function>" and "profile_type:<type>",
+// the number of contentions is reported as datadog.profiling.go.contention.count,
+// and the total and average time spent waiting as the
+// datadog.profiling.go.contention.delay and .avg_delay timings. Call sites
+// which had no contention during the previous period are also counted as
+// datadog.profiling.go.contention.new_hot_lock. A value of 0, the default,
+// disables the report. Delta profiles must be enabled, see WithDeltaProfiles.
+func WithContentionReport(n int) Option {
+	return func(cfg *config) {
+		cfg.contentionTopN = n
+	}
+}
+
+// WithGoroutineLeakThresholds sets the thresholds of the GoroutineLeakProfile:
+// the goroutines created by a call site are reported when their number grew
+// during each of the last growthPeriods profiling periods, and goroutines are
+// reported when they have been blocked for at least blockedFor. The number of
+// reported goroutines is also sent to the configured statsd client as the
+// datadog.profiling.go.goroutine_leak.goroutines count, tagged with
+// "created_by:<function>" and "reason:growing" or "reason:blocked". The
+// defaults are DefaultLeakGrowthPeriods and DefaultLeakBlockedDuration.
+func WithGoroutineLeakThresholds(growthPeriods int, blockedFor time.Duration) Option {
+	return func(cfg *config) {
+		cfg.leakGrowthPeriods = growthPeriods
+		cfg.leakBlockedFor = blockedFor
+	}
+}
+
 // WithLogStartup toggles logging the configuration of the profiler to standard
 // error when profiling is started. The configuration is logged in a JSON
 // format. This option is enabled by default.
@@ -509,6 +634,85 @@ func WithHostname(hostname string) Option {
 	}
 }
 
+// WithCaptureTypes specifies the profile types collected by captures which
+// don't specify any, including the ones taken by capture triggers. The
+// default types are CPUProfile, HeapProfile and GoroutineProfile. See
+// CaptureNow for more information.
+func WithCaptureTypes(types ...ProfileType) Option {
+	return func(cfg *config) {
+		cfg.capture.types = types
+	}
+}
+
+// WithCaptureDuration specifies how long the profiles of a capture cover. The
+// default is DefaultCaptureDuration. Using a negative value or 0 will cause
+// an error when starting the profiler.
+func WithCaptureDuration(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.capture.duration = d
+	}
+}
+
+// WithCaptureRateLimit specifies the minimum amount of time between two
+// captures, whether they are requested by CaptureNow or by a trigger. The
+// default is DefaultCaptureRateLimit.
+func WithCaptureRateLimit(every time.Duration) Option {
+	return func(cfg *config) {
+		cfg.capture.rateLimit = every
+	}
+}
+
+// WithCaptureTriggers registers triggers which automatically take a capture
+// when they fire. Triggers are checked every 10 seconds and are subject to
+// the capture rate limit. See CaptureNow for more information.
+func WithCaptureTriggers(triggers ...CaptureTrigger) Option {
+	return func(cfg *config) {
+		cfg.capture.triggers = append(cfg.capture.triggers, triggers...)
+	}
+}
+
+// WithExecutionTraceWindows enables trace windows: when a span matching one of
+// the given triggers starts, a capture of an execution trace lasting d is
+// requested, so that the execution of the span, e.g. a slow request, is
+// traced. The IDs of the matching spans started until the trace is uploaded
+// are recorded in the upload event, to correlate them with the trace. A
+// duration of 0 uses DefaultTraceWindowDuration.
+//
+// Trace windows are captures tagged with "capture_reason:trace_window", and
+// are subject to the capture rate limit, see CaptureNow and
+// WithCaptureRateLimit. They start shortly after the span which armed them,
+// once the current profiling cycle was cut short. They require the tracer to
+// be started in the same process.
+func WithExecutionTraceWindows(d time.Duration, triggers ...TraceWindowTrigger) Option {
+	return func(cfg *config) {
+		if d == 0 {
+			d = DefaultTraceWindowDuration
+		}
+		cfg.traceWindow.duration = d
+		cfg.traceWindow.triggers = append(cfg.traceWindow.triggers, triggers...)
+	}
+}
+
+// WithOverheadBudget enables throttling the profiler when the CPU time it
+// spends collecting, computing delta profiles, compressing and uploading
+// exceeds the given fraction of the CPU time of the process during a
+// profiling period, e.g. 0.01 for 1%. While the budget is exceeded, the
+// profiler throttles itself further after each period: it first skips
+// execution traces, then disables the block and mutex profiles, and then
+// halves the CPU profile rate, down to 10 Hz. It stops throttling step by
+// step once the overhead falls below half of the budget. Throttled batches
+// are tagged with "profiler_throttle_level:<level>".
+//
+// The cost of each stage is reported in the upload event and as telemetry
+// whether or not throttling is enabled. CPU times are only measured on Linux,
+// so throttling has no effect on other platforms. The default budget of 0
+// disables throttling.
+func WithOverheadBudget(fraction float64) Option {
+	return func(cfg *config) {
+		cfg.overheadBudget = fraction
+	}
+}
+
 // executionTraceConfig controls how often, and for how long, runtime execution
 // traces are collected.
 type executionTraceConfig struct {
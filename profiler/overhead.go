@@ -0,0 +1,220 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package profiler
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/telemetry"
+	pinternal "gopkg.in/DataDog/dd-trace-go.v1/profiler/internal"
+)
+
+// The stages of the profiler's work whose cost is measured.
+const (
+	stageCollect     = "collect"     // reading the profile from the runtime
+	stageDelta       = "delta"       // computing the delta profile
+	stageCompression = "compression" // compressing the delta profile
+	stageUpload      = "upload"      // encoding and uploading a batch
+)
+
+// stageCost is the cost of a stage of the profiler's work, e.g. collecting a
+// profile or uploading a batch.
+type stageCost struct {
+	Wall  time.Duration `json:"wall_ns"`
+	CPU   time.Duration `json:"cpu_ns"`
+	Bytes int64         `json:"bytes"`
+}
+
+func (c *stageCost) add(o stageCost) {
+	c.Wall += o.Wall
+	c.CPU += o.CPU
+	c.Bytes += o.Bytes
+}
+
+// stopwatch measures the cost of a stage of the profiler's work.
+type stopwatch struct {
+	pinternal.CPUStopwatch
+}
+
+func startStopwatch() stopwatch {
+	return stopwatch{pinternal.StartCPUStopwatch()}
+}
+
+// stop returns the cost of the measured stage, which produced the given
+// number of bytes.
+func (s stopwatch) stop(bytes int) stageCost {
+	wall, cpu := s.Stop()
+	return stageCost{Wall: wall, CPU: cpu, Bytes: int64(bytes)}
+}
+
+// uploadCostKey is the key of the cost of uploads, which don't belong to a
+// single profile type.
+const uploadCostKey = "all"
+
+// overheadCosts holds the cost of the profiler's work, by profile type name
+// and stage.
+type overheadCosts map[string]map[string]stageCost
+
+// cpu returns the total CPU time of c.
+func (c overheadCosts) cpu() time.Duration {
+	var total time.Duration
+	for _, stages := range c {
+		for _, cost := range stages {
+			total += cost.CPU
+		}
+	}
+	return total
+}
+
+// overheadRecorder accumulates the costs of the profiler's work until they
+// are taken. It is safe for concurrent use.
+type overheadRecorder struct {
+	mu    sync.Mutex
+	costs overheadCosts
+}
+
+// record adds c to the cost of the given stage of profile type t, which is
+// a profile type name or uploadCostKey.
+func (r *overheadRecorder) record(t, stage string, c stageCost) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.costs == nil {
+		r.costs = make(overheadCosts)
+	}
+	stages, ok := r.costs[t]
+	if !ok {
+		stages = make(map[string]stageCost)
+		r.costs[t] = stages
+	}
+	cost := stages[stage]
+	cost.add(c)
+	stages[stage] = cost
+}
+
+// take returns the recorded costs and resets them.
+func (r *overheadRecorder) take() overheadCosts {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	costs := r.costs
+	r.costs = nil
+	return costs
+}
+
+// The throttle levels, which apply the throttling of the levels below them.
+// Above throttleBlockMutex, each level halves the CPU profile rate.
+const (
+	throttleNone       = iota
+	throttleTraces     // execution traces are skipped, except for captures
+	throttleBlockMutex // block and mutex profiles are disabled
+	maxThrottleLevel   = throttleBlockMutex + 3
+)
+
+// defaultCPUProfileRate is the CPU profile rate used by runtime/pprof.
+const defaultCPUProfileRate = 100
+
+// minCPUProfileRate is the lowest CPU profile rate throttling sets.
+const minCPUProfileRate = 10
+
+// reportOverhead sends the given costs to the telemetry client.
+func (p *profiler) reportOverhead(costs overheadCosts) {
+	for t, stages := range costs {
+		for stage, cost := range stages {
+			tags := []string{"profile_type:" + t, "stage:" + stage}
+			telemetry.GlobalClient.Record(telemetry.NamespaceProfilers, telemetry.MetricKindDist, "overhead.wall_ns", float64(cost.Wall), tags, false)
+			telemetry.GlobalClient.Record(telemetry.NamespaceProfilers, telemetry.MetricKindDist, "overhead.cpu_ns", float64(cost.CPU), tags, false)
+			telemetry.GlobalClient.Record(telemetry.NamespaceProfilers, telemetry.MetricKindDist, "overhead.bytes", float64(cost.Bytes), tags, false)
+		}
+	}
+	telemetry.GlobalClient.Record(telemetry.NamespaceProfilers, telemetry.MetricKindGauge, "overhead.throttle_level", float64(p.throttleLevel), nil, false)
+}
+
+// adjustThrottle compares the CPU time of the profiler's work during the last
+// profiling cycle to the CPU time of the process over the same period, and
+// raises the throttle level by one if it exceeds the overhead budget, or
+// lowers it by one if it is below half of the budget. It is only called by
+// the collect goroutine, between cycles.
+func (p *profiler) adjustThrottle(costs overheadCosts, processCPU time.Duration) {
+	if processCPU <= 0 {
+		return
+	}
+	overhead := float64(costs.cpu()) / float64(processCPU)
+	level := p.throttleLevel
+	switch {
+	case overhead > p.cfg.overheadBudget && level < maxThrottleLevel:
+		level++
+	case overhead < p.cfg.overheadBudget/2 && level > throttleNone:
+		level--
+	default:
+		return
+	}
+	log.Debug("Profiler overhead is %.2f%% of the process CPU time, throttle level %d -> %d", overhead*100, p.throttleLevel, level)
+	p.setThrottleLevel(level)
+}
+
+// setThrottleLevel applies the given throttle level.
+func (p *profiler) setThrottleLevel(level int) {
+	_, block := p.cfg.types[BlockProfile]
+	_, mutex := p.cfg.types[MutexProfile]
+	wasBlockMutexOff := p.throttleLevel >= throttleBlockMutex
+	p.throttleLevel = level
+	isBlockMutexOff := level >= throttleBlockMutex
+	if wasBlockMutexOff == isBlockMutexOff {
+		return
+	}
+	blockRate, mutexFraction := p.cfg.blockRate, p.cfg.mutexFraction
+	if isBlockMutexOff {
+		blockRate, mutexFraction = 0, 0
+	}
+	if block {
+		runtime.SetBlockProfileRate(blockRate)
+	}
+	if mutex {
+		runtime.SetMutexProfileFraction(mutexFraction)
+	}
+}
+
+// throttled reports whether profiles of type t are skipped by the current
+// throttle level.
+func (p *profiler) throttled(t ProfileType) bool {
+	switch t {
+	case executionTrace:
+		return p.throttleLevel >= throttleTraces
+	case BlockProfile, MutexProfile:
+		return p.throttleLevel >= throttleBlockMutex
+	default:
+		return false
+	}
+}
+
+// cpuProfileRate returns the CPU profile rate to use given the current
+// throttle level, or 0 to use the default rate.
+func (p *profiler) cpuProfileRate() int {
+	base := p.cfg.cpuProfileRate
+	if p.throttleLevel <= throttleBlockMutex {
+		return base
+	}
+	if base == 0 {
+		base = defaultCPUProfileRate
+	}
+	rate := base >> (p.throttleLevel - throttleBlockMutex)
+	if rate < minCPUProfileRate {
+		// don't raise rates which were configured below the minimum
+		rate = minCPUProfileRate
+		if base < rate {
+			rate = base
+		}
+	}
+	return rate
+}
+
+// throttleTag returns the tag of batches collected while throttled.
+func (p *profiler) throttleTag() string {
+	return fmt.Sprintf("profiler_throttle_level:%d", p.throttleLevel)
+}
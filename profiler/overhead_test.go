@@ -0,0 +1,160 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package profiler
+
+import (
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/telemetry"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/telemetry/telemetrytest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStopwatch(t *testing.T) {
+	// the stopwatch doesn't lock the goroutine to its thread, but its CPU
+	// time is only measured if it doesn't move to another one
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	sw := startStopwatch()
+	for start := time.Now(); time.Since(start) < 20*time.Millisecond; {
+		// burn CPU
+	}
+	c := sw.stop(42)
+	assert.GreaterOrEqual(t, c.Wall, 20*time.Millisecond)
+	assert.LessOrEqual(t, c.CPU, c.Wall)
+	assert.Equal(t, int64(42), c.Bytes)
+	if runtime.GOOS == "linux" {
+		assert.Greater(t, c.CPU, time.Duration(0))
+	}
+}
+
+func TestDeltaCosts(t *testing.T) {
+	dp := newFastDeltaProfiler(profileTypes[MutexProfile].DeltaValues...)
+	for _, text := range []string{"main;foo 1 10\n", "main;foo 3 30\nmain;bar 1 10\n"} {
+		data, err := dp.Delta(textProfile{Text: "contentions/count delay/nanoseconds\n" + text}.Protobuf())
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(data)), dp.compressionCost.Bytes)
+		assert.Greater(t, dp.deltaCost.Bytes, int64(0), "the uncompressed size is counted")
+		assert.Greater(t, dp.compressionCost.Wall, time.Duration(0))
+	}
+
+	cw := compressionWriter{n: 100, wall: 30}
+	delta, compression := cw.split(stageCost{Wall: 100, CPU: 50, Bytes: 40})
+	assert.Equal(t, stageCost{Wall: 70, CPU: 35, Bytes: 100}, delta)
+	assert.Equal(t, stageCost{Wall: 30, CPU: 15, Bytes: 40}, compression)
+}
+
+func TestOverheadRecorder(t *testing.T) {
+	var r overheadRecorder
+	assert.Nil(t, r.take())
+	r.record("heap", stageCollect, stageCost{Wall: 2, CPU: 1, Bytes: 10})
+	r.record("heap", stageCollect, stageCost{Wall: 2, CPU: 1, Bytes: 10})
+	r.record("heap", stageDelta, stageCost{Wall: 5, CPU: 5})
+	r.record(uploadCostKey, stageUpload, stageCost{Wall: 7, CPU: 3, Bytes: 20})
+	costs := r.take()
+	assert.Equal(t, overheadCosts{
+		"heap": {
+			stageCollect: {Wall: 4, CPU: 2, Bytes: 20},
+			stageDelta:   {Wall: 5, CPU: 5},
+		},
+		uploadCostKey: {stageUpload: {Wall: 7, CPU: 3, Bytes: 20}},
+	}, costs)
+	assert.Equal(t, time.Duration(10), costs.cpu())
+	assert.Nil(t, r.take())
+}
+
+func TestThrottle(t *testing.T) {
+	defer runtime.SetBlockProfileRate(0)
+	defer runtime.SetMutexProfileFraction(0)
+	p, err := unstartedProfiler(
+		WithProfileTypes(CPUProfile, BlockProfile, MutexProfile),
+		WithOverheadBudget(0.1),
+		CPUProfileRate(200),
+	)
+	require.NoError(t, err)
+	over := overheadCosts{"cpu": {stageCollect: {CPU: 2 * time.Second}}}
+	under := overheadCosts{"cpu": {stageCollect: {CPU: time.Second}}}
+	const processCPU = 10 * time.Second
+
+	p.adjustThrottle(under, processCPU)
+	assert.Equal(t, throttleNone, p.throttleLevel, "within budget")
+
+	p.adjustThrottle(over, processCPU)
+	assert.Equal(t, throttleTraces, p.throttleLevel)
+	assert.True(t, p.throttled(executionTrace))
+	assert.False(t, p.throttled(BlockProfile))
+	assert.Equal(t, 200, p.cpuProfileRate())
+
+	p.adjustThrottle(over, processCPU)
+	assert.True(t, p.throttled(BlockProfile))
+	assert.True(t, p.throttled(MutexProfile))
+	assert.Equal(t, 0, runtime.SetMutexProfileFraction(-1))
+	assert.Equal(t, 200, p.cpuProfileRate())
+
+	var rates []int
+	for i := 0; i < 5; i++ {
+		p.adjustThrottle(over, processCPU)
+		rates = append(rates, p.cpuProfileRate())
+	}
+	assert.Equal(t, []int{100, 50, 25, 25, 25}, rates, "the rate is halved down to the max throttle level")
+	assert.Equal(t, maxThrottleLevel, p.throttleLevel)
+
+	p.adjustThrottle(under, processCPU)
+	assert.Equal(t, maxThrottleLevel, p.throttleLevel, "not below half of the budget")
+	for p.throttleLevel > throttleNone {
+		p.adjustThrottle(overheadCosts{}, processCPU)
+	}
+	assert.False(t, p.throttled(BlockProfile))
+	assert.Equal(t, DefaultMutexFraction, runtime.SetMutexProfileFraction(-1))
+	assert.Equal(t, 200, p.cpuProfileRate())
+
+	p.cfg.cpuProfileRate = 0
+	p.setThrottleLevel(maxThrottleLevel)
+	assert.Equal(t, 12, p.cpuProfileRate(), "the default rate is throttled")
+
+	_, err = unstartedProfiler(WithOverheadBudget(2))
+	assert.Error(t, err)
+}
+
+func TestOverheadReported(t *testing.T) {
+	telemetryClient := new(telemetrytest.MockClient)
+	telemetryClient.On("Record", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	defer telemetry.MockGlobalClient(telemetryClient)()
+
+	got := make(chan profileMeta)
+	server := httptest.NewServer(&mockBackend{t: t, profiles: got})
+	defer server.Close()
+	t.Setenv("DD_PROFILING_EXECUTION_TRACE_ENABLED", "false")
+	err := Start(
+		WithAgentAddr(server.Listener.Addr().String()),
+		WithProfileTypes(HeapProfile),
+		WithPeriod(10*time.Millisecond),
+	)
+	require.NoError(t, err)
+	defer Stop()
+
+	first := <-got
+	assert.Contains(t, first.event.Overhead, "heap")
+	for _, stage := range []string{stageCollect, stageDelta, stageCompression} {
+		assert.Contains(t, first.event.Overhead["heap"], stage)
+	}
+	assert.Greater(t, first.event.Overhead["heap"][stageCollect].Bytes, int64(0))
+	// the upload of a batch is reported with the batches collected after it
+	for {
+		next := <-got
+		if upload, ok := next.event.Overhead[uploadCostKey][stageUpload]; ok {
+			assert.Greater(t, upload.Bytes, int64(0))
+			break
+		}
+	}
+	telemetryClient.AssertCalled(t, "Record", telemetry.NamespaceProfilers, "overhead.cpu_ns", mock.Anything, []string{"profile_type:heap", "stage:delta"}, false)
+}
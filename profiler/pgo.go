@@ -0,0 +1,243 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package profiler
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+
+	pprofile "github.com/google/pprof/profile"
+)
+
+const (
+	// DefaultPGOWindow is the default amount of time covered by the
+	// aggregated CPU profile, see PGOConfig.
+	DefaultPGOWindow = 24 * time.Hour
+
+	// DefaultPGOMaxSamples is the default maximum number of samples of the
+	// aggregated CPU profile, see PGOConfig.
+	DefaultPGOMaxSamples = 10000
+)
+
+// pgoBuckets is the number of buckets the window of the aggregate is split
+// into. The CPU profiles of a bucket are dropped all at once, when the whole
+// bucket is older than the window.
+const pgoBuckets = 12
+
+// PGOConfig configures the aggregated CPU profile for Go profile-guided
+// optimization, see WithPGO.
+type PGOConfig struct {
+	// File is the path the aggregated profile is written to after each
+	// profiling period, e.g. "default.pgo". The file is replaced atomically.
+	// If empty, the profile is only served by PGOHandler.
+	File string
+
+	// Window is the amount of time covered by the aggregated profile. CPU
+	// profiles older than that are dropped from it, so that it reflects the
+	// recent behavior of the program. If 0, DefaultPGOWindow is used.
+	Window time.Duration
+
+	// MaxSamples bounds the number of samples of the aggregated profile,
+	// keeping the ones with the most CPU time, which are the ones that
+	// matter for optimization. If 0, DefaultPGOMaxSamples is used.
+	MaxSamples int
+}
+
+// WithPGO enables aggregating the CPU profiles collected by the profiler into
+// a profile suitable for Go profile-guided optimization, i.e. to be used as
+// "default.pgo" when building the program. The CPU profiles of each profiling
+// period are merged into a rolling aggregate covering the configured window,
+// stripped of their labels, and bounded in size. The aggregate is written to
+// the configured file, if any, and served by PGOHandler. The CPU profile must
+// be enabled. CPU profiles collected by captures are not aggregated.
+func WithPGO(cfg PGOConfig) Option {
+	return func(c *config) {
+		if cfg.Window == 0 {
+			cfg.Window = DefaultPGOWindow
+		}
+		if cfg.MaxSamples == 0 {
+			cfg.MaxSamples = DefaultPGOMaxSamples
+		}
+		c.pgo = &cfg
+	}
+}
+
+// pgoBucket holds the CPU profiles collected during a part of the window,
+// merged.
+type pgoBucket struct {
+	start, end time.Time
+	prof       *pprofile.Profile
+}
+
+// pgoAggregate is the rolling aggregate of the CPU profiles.
+type pgoAggregate struct {
+	cfg PGOConfig
+
+	mu      sync.Mutex
+	buckets []*pgoBucket // oldest first
+	data    []byte       // the encoded aggregate
+}
+
+func newPGOAggregate(cfg PGOConfig) *pgoAggregate {
+	return &pgoAggregate{cfg: cfg}
+}
+
+// add merges the given CPU profile, collected from start to end, into the
+// aggregate, and drops the buckets older than the window.
+func (a *pgoAggregate) add(data []byte, start, end time.Time) error {
+	prof, err := pprofile.ParseData(data)
+	if err != nil {
+		return err
+	}
+	for _, s := range prof.Sample {
+		s.Label, s.NumLabel, s.NumUnit = nil, nil, nil
+	}
+	prof.Comments = nil
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var last *pgoBucket
+	if n := len(a.buckets); n > 0 {
+		last = a.buckets[n-1]
+	}
+	if last == nil || end.Sub(last.start) > a.cfg.Window/pgoBuckets {
+		last = &pgoBucket{start: start}
+		a.buckets = append(a.buckets, last)
+	}
+	last.end = end
+	if last.prof != nil {
+		prof, err = pprofile.Merge([]*pprofile.Profile{last.prof, prof})
+	} else {
+		// merging a single profile aggregates the samples which only
+		// differed by their labels
+		prof, err = pprofile.Merge([]*pprofile.Profile{prof})
+	}
+	if err != nil {
+		return err
+	}
+	last.prof = trimSamples(prof, a.cfg.MaxSamples)
+	for len(a.buckets) > 0 && end.Sub(a.buckets[0].end) > a.cfg.Window {
+		a.buckets = a.buckets[1:]
+	}
+
+	profs := make([]*pprofile.Profile, 0, len(a.buckets))
+	for _, b := range a.buckets {
+		profs = append(profs, b.prof)
+	}
+	merged, err := pprofile.Merge(profs)
+	if err != nil {
+		return err
+	}
+	merged = trimSamples(merged, a.cfg.MaxSamples)
+	merged.TimeNanos = a.buckets[0].start.UnixNano()
+	merged.DurationNanos = end.Sub(a.buckets[0].start).Nanoseconds()
+	var buf bytes.Buffer
+	if err := merged.Write(&buf); err != nil {
+		return err
+	}
+	a.data = buf.Bytes()
+	return nil
+}
+
+// trimSamples keeps the n samples of p with the most CPU time.
+func trimSamples(p *pprofile.Profile, n int) *pprofile.Profile {
+	if len(p.Sample) <= n {
+		return p
+	}
+	idx := sampleTypeIndex(p, "cpu")
+	if idx < 0 {
+		idx = len(p.SampleType) - 1
+	}
+	sort.SliceStable(p.Sample, func(i, j int) bool {
+		return p.Sample[i].Value[idx] > p.Sample[j].Value[idx]
+	})
+	p.Sample = p.Sample[:n]
+	return p.Compact()
+}
+
+// profile returns the encoded aggregate, or nil if no CPU profile was added
+// yet.
+func (a *pgoAggregate) profile() []byte {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.data
+}
+
+// write writes the aggregate to the configured file, replacing it
+// atomically.
+func (a *pgoAggregate) write() error {
+	data := a.profile()
+	if a.cfg.File == "" || data == nil {
+		return nil
+	}
+	f, err := os.CreateTemp(filepath.Dir(a.cfg.File), filepath.Base(a.cfg.File)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), a.cfg.File)
+}
+
+// aggregatePGO adds the CPU profile among profs, collected during bat, to
+// the PGO aggregate and writes it.
+func (p *profiler) aggregatePGO(bat *batch, profs []*profile) {
+	for _, prof := range profs {
+		if prof.pt != CPUProfile {
+			continue
+		}
+		err := p.pgo.add(prof.data, bat.start, now())
+		if err == nil {
+			err = p.pgo.write()
+		}
+		if err != nil {
+			log.Error("Failed to aggregate the CPU profile for PGO: %v", err)
+			p.cfg.statsd.Count("datadog.profiling.go.pgo_error", 1, p.cfg.tags.Slice(), 1)
+		}
+	}
+}
+
+// PGOHandler returns an http.Handler serving the CPU profile aggregated for Go
+// profile-guided optimization by the running profiler, see WithPGO. For
+// example:
+//
+//	http.Handle("/debug/pgo", profiler.PGOHandler())
+//
+// and then:
+//
+//	curl -o default.pgo http://localhost:8080/debug/pgo
+func PGOHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		p := activeProfiler
+		mu.Unlock()
+		if p == nil || p.pgo == nil {
+			http.Error(w, "the profiler is not running with WithPGO", http.StatusNotFound)
+			return
+		}
+		data := p.pgo.profile()
+		if data == nil {
+			http.Error(w, "no cpu profile collected yet", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", `attachment; filename="default.pgo"`)
+		w.Write(data)
+	})
+}
@@ -0,0 +1,114 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package profiler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	pprofile "github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPGOAggregate(t *testing.T) {
+	cpu := func(samples map[string]int64) []byte {
+		sp := newStackProfile("samples/count", "cpu/nanoseconds")
+		sp.prof.PeriodType = &pprofile.ValueType{Type: "cpu", Unit: "nanoseconds"}
+		for stack, ns := range samples {
+			sp.add(stack, map[string][]string{"span id": {stack}}, 1, ns)
+			sp.add(stack, map[string][]string{"span id": {"other"}}, 1, ns)
+		}
+		return sp.bytes(t)
+	}
+	parse := func(t *testing.T, data []byte) map[string]int64 {
+		p, err := pprofile.ParseData(data)
+		require.NoError(t, err)
+		got := make(map[string]int64)
+		for _, s := range p.Sample {
+			assert.Empty(t, s.Label)
+			var stack []string
+			for _, loc := range s.Location {
+				stack = append(stack, loc.Line[0].Function.Name)
+			}
+			got[strings.Join(stack, ";")] += s.Value[1]
+		}
+		assert.Len(t, p.Sample, len(got), "samples only differing by labels are merged")
+		return got
+	}
+
+	a := newPGOAggregate(PGOConfig{Window: 12 * time.Minute, MaxSamples: 2})
+	assert.Nil(t, a.profile())
+	start := time.Now()
+	minute := func(n int) time.Time { return start.Add(time.Duration(n) * time.Minute) }
+
+	require.NoError(t, a.add(cpu(map[string]int64{"main.a": 10, "main.b": 20}), minute(0), minute(1)))
+	assert.Equal(t, map[string]int64{"main.a": 20, "main.b": 40}, parse(t, a.profile()))
+
+	require.NoError(t, a.add(cpu(map[string]int64{"main.a": 30, "main.c": 5}), minute(1), minute(2)))
+	assert.Equal(t, map[string]int64{"main.a": 80, "main.b": 40}, parse(t, a.profile()), "the samples with the least CPU time are dropped")
+	assert.Len(t, a.buckets, 2)
+
+	// 13 minutes later, the first bucket is out of the window
+	require.NoError(t, a.add(cpu(map[string]int64{"main.d": 1}), minute(13), minute(14)))
+	assert.Equal(t, map[string]int64{"main.a": 60, "main.c": 10}, parse(t, a.profile()))
+	assert.Len(t, a.buckets, 2)
+
+	p, err := pprofile.ParseData(a.profile())
+	require.NoError(t, err)
+	assert.Equal(t, minute(1).UnixNano(), p.TimeNanos)
+	assert.Equal(t, (13 * time.Minute).Nanoseconds(), p.DurationNanos)
+
+	assert.Error(t, a.add([]byte("invalid"), minute(14), minute(15)))
+}
+
+func TestPGO(t *testing.T) {
+	got := make(chan profileMeta)
+	server := httptest.NewServer(&mockBackend{t: t, profiles: got})
+	defer server.Close()
+	handler := httptest.NewServer(PGOHandler())
+	defer handler.Close()
+
+	resp, err := http.Get(handler.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode, "not running")
+
+	file := filepath.Join(t.TempDir(), "default.pgo")
+	t.Setenv("DD_PROFILING_EXECUTION_TRACE_ENABLED", "false")
+	err = Start(
+		WithAgentAddr(server.Listener.Addr().String()),
+		WithProfileTypes(CPUProfile),
+		WithPeriod(10*time.Millisecond),
+		WithPGO(PGOConfig{File: file}),
+	)
+	require.NoError(t, err)
+	defer Stop()
+	<-got
+
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	_, err = pprofile.ParseData(data)
+	require.NoError(t, err)
+
+	resp, err = http.Get(handler.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	served, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	_, err = pprofile.ParseData(served)
+	require.NoError(t, err)
+
+	_, err = unstartedProfiler(WithProfileTypes(HeapProfile), WithPGO(PGOConfig{}))
+	assert.Error(t, err, "the CPU profile is required")
+}
@@ -14,6 +14,7 @@ import (
 	"io"
 	"runtime"
 	"runtime/trace"
+	"sync"
 	"time"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/profiler/internal/fastdelta"
@@ -55,6 +56,25 @@ const (
 	// This is private, as this trace requires special explicit configuration and
 	// shouldn't just be added to WithProfileTypes
 	executionTrace
+
+	// EndpointAllocationProfile reports an estimate of the memory allocated by
+	// each endpoint, to find which endpoints drive GC pressure. The Go runtime
+	// doesn't label heap samples, so it is derived from the heap and CPU
+	// profiles of each profiling cycle by splitting the allocations of each
+	// site according to the CPU time endpoints spent allocating there, see
+	// endpointAllocations. Its uploads are tagged with
+	// "endpoint_alloc:estimated". It is skipped unless the heap and CPU
+	// profiles are enabled, and endpoint profiling must be enabled in the
+	// tracer.
+	EndpointAllocationProfile
+
+	// GoroutineLeakProfile reports the goroutines suspected of leaking:
+	// the goroutines created by a call site whose number of goroutines grew
+	// during each of the last profiling periods, and goroutines blocked for
+	// a long time. See WithGoroutineLeakThresholds. Like the goroutine wait
+	// profile, whose goroutine dump it reuses when both are enabled, it is
+	// skipped when there are too many goroutines.
+	GoroutineLeakProfile
 )
 
 // profileType holds the implementation details of a ProfileType.
@@ -91,25 +111,27 @@ var profileTypes = map[ProfileType]profileType{
 			// Start the CPU profiler at the end of the profiling
 			// period so that we're sure to capture the CPU usage of
 			// this library, which mostly happens at the end
-			p.interruptibleSleep(p.cfg.period - p.cfg.cpuDuration)
-			if p.cfg.cpuProfileRate != 0 {
+			p.cycleSleep(p.cycle.period - p.cycle.cpuDuration)
+			if rate := p.cpuProfileRate(); rate != 0 {
 				// The profile has to be set each time before
 				// profiling is started. Otherwise,
 				// runtime/pprof.StartCPUProfile will set the
 				// rate itself.
-				runtime.SetCPUProfileRate(p.cfg.cpuProfileRate)
+				runtime.SetCPUProfileRate(rate)
 			}
 
 			if err := p.startCPUProfile(&buf); err != nil {
 				return nil, err
 			}
-			p.interruptibleSleep(p.cfg.cpuDuration)
+			p.cycleSleep(p.cycle.cpuDuration)
 
 			// We want the CPU profiler to finish last so that it can
 			// properly record all of our profile processing work for
 			// the other profile types
 			p.pendingProfiles.Wait()
+			sw := startStopwatch()
 			p.stopCPUProfile()
+			p.overhead.record("cpu", stageCollect, sw.stop(buf.Len()))
 			return buf.Bytes(), nil
 		},
 	},
@@ -158,17 +180,17 @@ var profileTypes = map[ProfileType]profileType{
 				return nil, fmt.Errorf("skipping goroutines wait profile: %d goroutines exceeds DD_PROFILING_WAIT_PROFILE_MAX_GOROUTINES limit of %d", n, p.cfg.maxGoroutinesWait)
 			}
 
-			p.interruptibleSleep(p.cfg.period)
+			p.cycleSleep(p.cycle.period)
 
-			var (
-				now   = now()
-				text  = &bytes.Buffer{}
-				pprof = &bytes.Buffer{}
-			)
-			if err := p.lookupProfile("goroutine", text, 2); err != nil {
+			pprof := &bytes.Buffer{}
+			sw := startStopwatch()
+			text, now, err := p.lookupGoroutineDump()
+			if err != nil {
+				sw.stop(0)
 				return nil, err
 			}
-			err := goroutineDebug2ToPprof(text, pprof, now)
+			err = goroutineDebug2ToPprof(bytes.NewReader(text), pprof, now)
+			p.overhead.record("goroutinewait", stageCollect, sw.stop(pprof.Len()))
 			return pprof.Bytes(), err
 		},
 	},
@@ -177,8 +199,10 @@ var profileTypes = map[ProfileType]profileType{
 		Filename: "metrics.json",
 		Collect: func(p *profiler) ([]byte, error) {
 			var buf bytes.Buffer
-			p.interruptibleSleep(p.cfg.period)
+			p.cycleSleep(p.cycle.period)
+			sw := startStopwatch()
 			err := p.met.report(now(), &buf)
+			p.overhead.record("metrics", stageCollect, sw.stop(buf.Len()))
 			return buf.Bytes(), err
 		},
 	},
@@ -186,7 +210,9 @@ var profileTypes = map[ProfileType]profileType{
 		Name:     "execution-trace",
 		Filename: "go.trace",
 		Collect: func(p *profiler) ([]byte, error) {
-			if !p.shouldTrace() {
+			// Captures are explicitly requested, so they are not subject
+			// to the execution trace period.
+			if !p.cycle.isCapture() && !p.shouldTrace() {
 				return nil, errors.New("started tracing erroneously, indicating a bug in the profiler")
 			}
 			p.lastTrace = time.Now()
@@ -195,16 +221,32 @@ var profileTypes = map[ProfileType]profileType{
 			if err := trace.Start(lt); err != nil {
 				return nil, err
 			}
-			traceLogCPUProfileRate(p.cfg.cpuProfileRate)
+			traceLogCPUProfileRate(p.cpuProfileRate())
 			select {
 			case <-p.exit: // Profiling was stopped
-			case <-time.After(p.cfg.period): // The profiling cycle has ended
+			case <-p.cycle.cut: // The profiling cycle was cut short for a capture
+			case <-time.After(p.cycle.period): // The profiling cycle has ended
 			case <-lt.done: // The trace size limit was exceeded
 			}
+			sw := startStopwatch()
 			trace.Stop()
+			p.overhead.record("execution-trace", stageCollect, sw.stop(buf.Len()))
 			return buf.Bytes(), nil
 		},
 	},
+	GoroutineLeakProfile: {
+		Name:     "goroutineleak",
+		Filename: "goroutineleaks.pprof",
+		Collect:  (*profiler).collectGoroutineLeaks,
+	},
+	EndpointAllocationProfile: {
+		Name:     "endpoint-alloc",
+		Filename: "endpoint-allocs.pprof",
+		Collect: func(_ *profiler) ([]byte, error) {
+			// derived from the other profiles by collectProfiles
+			return nil, errors.New("endpoint allocation profiles can not be collected on their own")
+		},
+	},
 }
 
 // traceLogCPUProfileRate logs the cpuProfileRate to the execution tracer if
@@ -261,12 +303,28 @@ func (l *limitedTraceCollector) Write(p []byte) (n int, err error) {
 
 func collectGenericProfile(name string, pt ProfileType) func(p *profiler) ([]byte, error) {
 	return func(p *profiler) ([]byte, error) {
-		p.interruptibleSleep(p.cfg.period)
+		dp, ok := p.deltas[pt]
+		if ok && p.cfg.deltaProfiles && p.cycle.isCapture() {
+			// Captures are computed against a baseline of their own, taken
+			// when they start. Using the regular one would move it forward
+			// and shorten the window of the next regular profile.
+			var base bytes.Buffer
+			if err := p.lookupProfile(name, &base, 0); err != nil {
+				return nil, err
+			}
+			dp = newFastDeltaProfiler(dp.values...)
+			if _, err := dp.Delta(base.Bytes()); err != nil {
+				return nil, fmt.Errorf("delta profile error: %s", err)
+			}
+		}
+
+		p.cycleSleep(p.cycle.period)
 
 		var buf bytes.Buffer
+		sw := startStopwatch()
 		err := p.lookupProfile(name, &buf, 0)
+		p.overhead.record(name, stageCollect, sw.stop(buf.Len()))
 		data := buf.Bytes()
-		dp, ok := p.deltas[pt]
 		if !ok || !p.cfg.deltaProfiles {
 			return data, err
 		}
@@ -275,6 +333,8 @@ func collectGenericProfile(name string, pt ProfileType) func(p *profiler) ([]byt
 		delta, err := dp.Delta(data)
 		tags := append(p.cfg.tags.Slice(), fmt.Sprintf("profile_type:%s", name))
 		p.cfg.statsd.Timing("datadog.profiling.go.delta_time", time.Since(start), tags, 1)
+		p.overhead.record(name, stageDelta, dp.deltaCost)
+		p.overhead.record(name, stageCompression, dp.compressionCost)
 		if err != nil {
 			return nil, fmt.Errorf("delta profile error: %s", err)
 		}
@@ -333,6 +393,12 @@ type batch struct {
 	// extraTags are tags which might vary depending on which profile types
 	// actually run in a given profiling cycle
 	extraTags []string
+	// spanIDs are the IDs of the spans which armed the trace window of the
+	// batch, or started while it was armed, see WithExecutionTraceWindows.
+	spanIDs []uint64
+	// overhead holds the cost of the profiler's work recorded while the
+	// batch was collected, including the upload of the previous batch.
+	overhead overheadCosts
 }
 
 func (b *batch) addProfile(p *profile) {
@@ -350,7 +416,9 @@ func (p *profiler) runProfile(pt ProfileType) ([]*profile, error) {
 	tags := append(p.cfg.tags.Slice(), pt.Tag())
 	filename := t.Filename
 	// TODO(fg): Consider making Collect() return the filename.
-	if p.cfg.deltaProfiles && len(t.DeltaValues) > 0 {
+	// Profile types which are only collected by captures have no delta
+	// profiler, see newProfiler.
+	if _, ok := p.deltas[pt]; ok && p.cfg.deltaProfiles {
 		filename = "delta-" + filename
 	}
 	p.cfg.statsd.Timing("datadog.profiling.go.collect_time", end.Sub(start), tags, 1)
@@ -358,15 +426,21 @@ func (p *profiler) runProfile(pt ProfileType) ([]*profile, error) {
 }
 
 type fastDeltaProfiler struct {
-	dc  *fastdelta.DeltaComputer
-	buf bytes.Buffer
-	gzr gzip.Reader
-	gzw *gzip.Writer
+	values []pprofutils.ValueType
+	dc     *fastdelta.DeltaComputer
+	buf    bytes.Buffer
+	gzr    gzip.Reader
+	gzw    *gzip.Writer
+
+	// deltaCost and compressionCost are the costs of the stages of the
+	// last call to Delta.
+	deltaCost, compressionCost stageCost
 }
 
 func newFastDeltaProfiler(v ...pprofutils.ValueType) *fastDeltaProfiler {
 	fd := &fastDeltaProfiler{
-		dc: fastdelta.NewDeltaComputer(v...),
+		values: v,
+		dc:     fastdelta.NewDeltaComputer(v...),
 	}
 	fd.gzw = gzip.NewWriter(&fd.buf)
 	return fd
@@ -377,23 +451,32 @@ func isGzipData(data []byte) bool {
 }
 
 func (fdp *fastDeltaProfiler) Delta(data []byte) (b []byte, err error) {
+	fdp.deltaCost, fdp.compressionCost = stageCost{}, stageCost{}
+	sw := startStopwatch()
 	if isGzipData(data) {
 		if err := fdp.gzr.Reset(bytes.NewReader(data)); err != nil {
+			sw.stop(0)
 			return nil, err
 		}
 		data, err = io.ReadAll(&fdp.gzr)
 		if err != nil {
+			sw.stop(0)
 			return nil, fmt.Errorf("decompressing profile: %v", err)
 		}
 	}
 
 	fdp.buf.Reset()
 	fdp.gzw.Reset(&fdp.buf)
-
-	if err = fdp.dc.Delta(data, fdp.gzw); err != nil {
+	cw := compressionWriter{w: fdp.gzw}
+	if err = fdp.dc.Delta(data, &cw); err != nil {
+		sw.stop(0)
 		return nil, fmt.Errorf("error computing delta: %v", err)
 	}
-	if err = fdp.gzw.Close(); err != nil {
+	start := time.Now()
+	err = fdp.gzw.Close()
+	cw.wall += time.Since(start)
+	fdp.deltaCost, fdp.compressionCost = cw.split(sw.stop(fdp.buf.Len()))
+	if err != nil {
 		return nil, fmt.Errorf("error flushing gzip writer: %v", err)
 	}
 	// The returned slice will be retained in case the profile upload fails,
@@ -404,6 +487,63 @@ func (fdp *fastDeltaProfiler) Delta(data []byte) (b []byte, err error) {
 	return b, nil
 }
 
+// compressionWriter passes the delta profile to the gzip writer as it is
+// computed, counting its uncompressed size and the wall time spent compressing
+// it.
+type compressionWriter struct {
+	w    io.Writer
+	n    int
+	wall time.Duration
+}
+
+func (c *compressionWriter) Write(p []byte) (int, error) {
+	start := time.Now()
+	n, err := c.w.Write(p)
+	c.wall += time.Since(start)
+	c.n += n
+	return n, err
+}
+
+// split splits the given cost of computing and compressing a delta profile
+// into the costs of both stages. The CPU time can't be measured for each
+// write, so it is split in proportion to the wall time of the stages.
+func (c *compressionWriter) split(total stageCost) (delta, compression stageCost) {
+	compression = stageCost{Wall: c.wall, Bytes: total.Bytes}
+	if total.Wall > 0 {
+		compression.CPU = time.Duration(float64(total.CPU) * float64(c.wall) / float64(total.Wall))
+	}
+	delta = stageCost{Wall: total.Wall - compression.Wall, CPU: total.CPU - compression.CPU, Bytes: int64(c.n)}
+	return delta, compression
+}
+
+// goroutineDump holds the debug=2 goroutine dump taken while a batch is being
+// collected, which is shared by the goroutine wait and leak profiles so that
+// the program is only stopped once to take it.
+type goroutineDump struct {
+	once sync.Once
+	text []byte
+	at   time.Time
+	err  error
+}
+
+// lookupGoroutineDump returns a debug=2 goroutine dump along with the time it
+// was taken. The dump is shared with the other profile types of the batch
+// being collected, see collectProfiles.
+func (p *profiler) lookupGoroutineDump() (text []byte, at time.Time, err error) {
+	lookup := func() ([]byte, time.Time, error) {
+		var buf bytes.Buffer
+		at := now()
+		err := p.lookupProfile("goroutine", &buf, 2)
+		return buf.Bytes(), at, err
+	}
+	d := p.goroutineDump
+	if d == nil {
+		return lookup()
+	}
+	d.once.Do(func() { d.text, d.at, d.err = lookup() })
+	return d.text, d.at, d.err
+}
+
 func goroutineDebug2ToPprof(r io.Reader, w io.Writer, t time.Time) (err error) {
 	// gostackparse.Parse() has been extensively tested and should not crash
 	// under any circumstances, but we really want to avoid crashing a customers
@@ -10,7 +10,6 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
 	"runtime"
 	"runtime/pprof"
 	"strings"
@@ -20,6 +19,7 @@ import (
 	"gopkg.in/DataDog/dd-trace-go.v1/internal"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/traceprof"
+	pinternal "gopkg.in/DataDog/dd-trace-go.v1/profiler/internal"
 	"gopkg.in/DataDog/dd-trace-go.v1/profiler/internal/immutable"
 )
 
@@ -84,6 +84,38 @@ type profiler struct {
 
 	// lastTrace is the last time an execution trace was collected
 	lastTrace time.Time
+
+	// cycle is the profiling cycle currently being collected. It is only
+	// replaced by the collect goroutine, under captureMu, while no
+	// profiles are being collected.
+	cycle *cycle
+
+	captureMu      sync.Mutex      // guards the fields below and writes to cycle
+	pendingCapture *captureRequest // pendingCapture is the next capture to take, see CaptureNow
+	lastCapture    time.Time       // lastCapture is the time the last capture was requested
+
+	// contention computes the contention reports, if enabled using
+	// WithContentionReport.
+	contention *contentionReport
+
+	// leaks finds leaking goroutines, if GoroutineLeakProfile is enabled.
+	leaks *leakDetector
+	// goroutineDump is shared by the profile types which need a goroutine
+	// dump while a batch is being collected, if there are several of them.
+	goroutineDump *goroutineDump
+
+	// removeSpanStartObserver removes the span start observer arming trace
+	// windows, if enabled using WithExecutionTraceWindows.
+	removeSpanStartObserver func()
+
+	// pgo aggregates the CPU profiles for PGO, if enabled using WithPGO.
+	pgo *pgoAggregate
+
+	// overhead records the cost of the profiler's work.
+	overhead overheadRecorder
+	// throttleLevel is the current throttle level, see WithOverheadBudget.
+	// It is only used by the collect goroutine.
+	throttleLevel int
 }
 
 func (p *profiler) shouldTrace() bool {
@@ -188,6 +220,39 @@ func newProfiler(opts ...Option) (*profiler, error) {
 			return nil, fmt.Errorf("unknown profile type: %d", pt)
 		}
 	}
+	if _, ok := cfg.types[EndpointAllocationProfile]; ok {
+		_, cpu := cfg.types[CPUProfile]
+		_, heap := cfg.types[HeapProfile]
+		if !cpu || !heap {
+			log.Warn("Profile type %s requires the %s and %s profile types; disabling it.", EndpointAllocationProfile, CPUProfile, HeapProfile)
+			delete(cfg.types, EndpointAllocationProfile)
+		}
+	}
+	for _, pt := range cfg.capture.types {
+		if !canCapture(pt) {
+			return nil, fmt.Errorf("profile type %s can not be captured", pt)
+		}
+	}
+	if cfg.leakGrowthPeriods < 1 {
+		return nil, fmt.Errorf("invalid goroutine leak growth periods, must be >= 1: %d", cfg.leakGrowthPeriods)
+	}
+	if cfg.traceWindow.duration < 0 {
+		return nil, fmt.Errorf("invalid trace window duration, must be > 0: %s", cfg.traceWindow.duration)
+	}
+	if cfg.pgo != nil {
+		if _, ok := cfg.types[CPUProfile]; !ok {
+			return nil, errors.New("the PGO profile requires the CPU profile to be enabled")
+		}
+		if cfg.pgo.Window < 0 || cfg.pgo.MaxSamples < 0 {
+			return nil, fmt.Errorf("invalid PGO config, window and max samples must be > 0: %+v", *cfg.pgo)
+		}
+	}
+	if cfg.overheadBudget < 0 || cfg.overheadBudget > 1 {
+		return nil, fmt.Errorf("invalid overhead budget, must be between 0 and 1: %v", cfg.overheadBudget)
+	}
+	if cfg.capture.duration <= 0 {
+		return nil, fmt.Errorf("invalid capture duration, must be > 0: %s", cfg.capture.duration)
+	}
 	if cfg.cpuDuration > cfg.period {
 		cfg.cpuDuration = cfg.period
 	}
@@ -221,12 +286,22 @@ func newProfiler(opts ...Option) (*profiler, error) {
 		exit:   make(chan struct{}),
 		met:    newMetrics(),
 		deltas: make(map[ProfileType]*fastDeltaProfiler),
+		cycle:  newCycle(cfg.period, cfg.cpuDuration),
 	}
 	for pt := range cfg.types {
 		if d := profileTypes[pt].DeltaValues; len(d) > 0 {
 			p.deltas[pt] = newFastDeltaProfiler(d...)
 		}
 	}
+	if _, ok := cfg.types[GoroutineLeakProfile]; ok {
+		p.leaks = newLeakDetector(cfg.leakGrowthPeriods, cfg.leakBlockedFor)
+	}
+	if cfg.pgo != nil {
+		p.pgo = newPGOAggregate(*cfg.pgo)
+	}
+	if cfg.contentionTopN > 0 {
+		p.contention = newContentionReport(cfg.contentionTopN)
+	}
 	p.uploadFunc = p.upload
 	return &p, nil
 }
@@ -244,6 +319,10 @@ func (p *profiler) run() {
 		runtime.SetBlockProfileRate(p.cfg.blockRate)
 	}
 	startTelemetry(p.cfg)
+	if len(p.cfg.traceWindow.triggers) > 0 {
+		w := &traceWindows{p: p, triggers: p.cfg.traceWindow.triggers}
+		p.removeSpanStartObserver = traceprof.SetSpanStartObserver(w.observe)
+	}
 	p.wg.Add(1)
 	go func() {
 		defer p.wg.Done()
@@ -257,18 +336,19 @@ func (p *profiler) run() {
 		defer p.wg.Done()
 		p.send()
 	}()
+	if len(p.cfg.capture.triggers) > 0 {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.watchTriggers()
+		}()
+	}
 }
 
 // collect runs the profile types found in the configuration whenever the ticker receives
 // an item.
 func (p *profiler) collect(ticker <-chan time.Time) {
 	defer close(p.out)
-	var (
-		// mu guards completed
-		mu        sync.Mutex
-		completed []*profile
-		wg        sync.WaitGroup
-	)
 
 	// Enable endpoint counting (if configured). This causes some minimal
 	// overhead to the tracer, see BenchmarkEndpointCounter.
@@ -282,6 +362,8 @@ func (p *profiler) collect(ticker <-chan time.Time) {
 	}()
 
 	for {
+		c := newCycle(p.cfg.period, p.cfg.cpuDuration)
+		p.setCycle(c)
 		bat := batch{
 			seq:   p.seq,
 			host:  p.cfg.hostname,
@@ -296,48 +378,21 @@ func (p *profiler) collect(ticker <-chan time.Time) {
 		}
 		p.seq++
 
-		completed = completed[:0]
-		// We need to increment pendingProfiles for every non-CPU
-		// profile _before_ entering the next loop so that we know CPU
-		// profiling will not complete until every other profile is
-		// finished (because p.pendingProfiles will have been
-		// incremented to count every non-CPU profile before CPU
-		// profiling starts)
-		profileTypes := p.enabledProfileTypes()
-		if p.shouldTrace() {
-			profileTypes = append(profileTypes, executionTrace)
-		}
-		for _, t := range profileTypes {
-			if t != CPUProfile {
-				p.pendingProfiles.Add(1)
+		var profileTypes []ProfileType
+		for _, t := range p.enabledProfileTypes() {
+			// Execution traces are only collected when they are due, or
+			// by captures, even when enabled with WithProfileTypes.
+			if t != executionTrace && !p.throttled(t) {
+				profileTypes = append(profileTypes, t)
 			}
 		}
-		for _, t := range profileTypes {
-			wg.Add(1)
-			go func(t ProfileType) {
-				defer wg.Done()
-				if t != CPUProfile {
-					defer p.pendingProfiles.Done()
-				}
-				profs, err := p.runProfile(t)
-				if err != nil {
-					log.Error("Error getting %s profile: %v; skipping.", t, err)
-					tags := append(p.cfg.tags.Slice(), t.Tag())
-					p.cfg.statsd.Count("datadog.profiling.go.collect_error", 1, tags, 1)
-				}
-				mu.Lock()
-				defer mu.Unlock()
-				completed = append(completed, profs...)
-			}(t)
+		if !p.throttled(executionTrace) && p.shouldTrace() {
+			profileTypes = append(profileTypes, executionTrace)
 		}
-		wg.Wait()
-		for _, prof := range completed {
-			if prof.pt == executionTrace {
-				// If the profile batch includes a runtime execution trace, add a tag so
-				// that the uploads are more easily discoverable in the UI.
-				bat.extraTags = append(bat.extraTags, "go_execution_traced:yes")
-			}
-			bat.addProfile(prof)
+		processCPU, measured := pinternal.ProcessCPUTime()
+		p.collectProfiles(&bat, profileTypes)
+		if end, ok := pinternal.ProcessCPUTime(); ok && measured && p.cfg.overheadBudget > 0 {
+			p.adjustThrottle(bat.overhead, end-processCPU)
 		}
 
 		// Wait until the next profiling period starts or the profiler is stopped.
@@ -348,6 +403,9 @@ func (p *profiler) collect(ticker <-chan time.Time) {
 			// Edge case: If only the CPU profile is enabled, and the cpu duration is
 			// is less than the configured profiling period, the ticker will block
 			// until the end of the profiling period.
+		case <-c.cut:
+			// A capture was requested, so the cycle ended early. The capture
+			// is taken right after uploading this batch.
 		case <-p.exit:
 			return
 		}
@@ -367,6 +425,109 @@ func (p *profiler) collect(ticker <-chan time.Time) {
 		bat.end = time.Now()
 		// Upload profiling data.
 		p.enqueueUpload(bat)
+
+		if req := p.takeCapture(); req != nil {
+			p.capture(req)
+		}
+	}
+}
+
+// collectProfiles runs the given profile types concurrently for the current
+// cycle and adds the resulting profiles to bat.
+func (p *profiler) collectProfiles(bat *batch, profileTypes []ProfileType) {
+	var (
+		// mu guards completed
+		mu        sync.Mutex
+		completed []*profile
+		wg        sync.WaitGroup
+	)
+	// Derived profiles are computed from the other profiles once they are
+	// collected.
+	var collected, derived []ProfileType
+	var goroutineDumps int
+	for _, t := range profileTypes {
+		switch t {
+		case EndpointAllocationProfile:
+			derived = append(derived, t)
+			continue
+		case expGoroutineWaitProfile, GoroutineLeakProfile:
+			goroutineDumps++
+		}
+		collected = append(collected, t)
+	}
+	profileTypes = collected
+	if goroutineDumps > 1 {
+		p.goroutineDump = new(goroutineDump)
+		defer func() { p.goroutineDump = nil }()
+	}
+	// We need to increment pendingProfiles for every non-CPU
+	// profile _before_ entering the next loop so that we know CPU
+	// profiling will not complete until every other profile is
+	// finished (because p.pendingProfiles will have been
+	// incremented to count every non-CPU profile before CPU
+	// profiling starts)
+	for _, t := range profileTypes {
+		if t != CPUProfile {
+			p.pendingProfiles.Add(1)
+		}
+	}
+	for _, t := range profileTypes {
+		wg.Add(1)
+		go func(t ProfileType) {
+			defer wg.Done()
+			if t != CPUProfile {
+				defer p.pendingProfiles.Done()
+			}
+			profs, err := p.runProfile(t)
+			if err != nil {
+				log.Error("Error getting %s profile: %v; skipping.", t, err)
+				tags := append(p.cfg.tags.Slice(), t.Tag())
+				p.cfg.statsd.Count("datadog.profiling.go.collect_error", 1, tags, 1)
+			} else if t == CPUProfile && p.cfg.spanCPUMetrics {
+				if err := p.attributeEndpointCPU(profs[0].data); err != nil {
+					log.Error("Failed to attribute CPU time to endpoints: %v", err)
+				}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			completed = append(completed, profs...)
+		}(t)
+	}
+	wg.Wait()
+	for _, t := range derived {
+		prof, err := p.deriveProfile(t, completed)
+		if err != nil {
+			log.Error("Error deriving %s profile: %v; skipping.", t, err)
+			tags := append(p.cfg.tags.Slice(), t.Tag())
+			p.cfg.statsd.Count("datadog.profiling.go.collect_error", 1, tags, 1)
+			continue
+		}
+		if prof != nil {
+			completed = append(completed, prof)
+		}
+	}
+	if p.contention != nil && !p.cycle.isCapture() {
+		p.reportContention(completed)
+	}
+	if p.pgo != nil && !p.cycle.isCapture() {
+		p.aggregatePGO(bat, completed)
+	}
+	if p.throttleLevel > throttleNone {
+		bat.extraTags = append(bat.extraTags, p.throttleTag())
+	}
+	bat.overhead = p.overhead.take()
+	p.reportOverhead(bat.overhead)
+	for _, prof := range completed {
+		if prof.pt == executionTrace {
+			// If the profile batch includes a runtime execution trace, add a tag so
+			// that the uploads are more easily discoverable in the UI.
+			bat.extraTags = append(bat.extraTags, "go_execution_traced:yes")
+		}
+		if prof.pt == EndpointAllocationProfile {
+			// The endpoint allocations are estimated, see endpointAllocations.
+			bat.extraTags = append(bat.extraTags, "endpoint_alloc:estimated")
+		}
+		bat.addProfile(prof)
 	}
 }
 
@@ -383,8 +544,10 @@ func (p *profiler) enabledProfileTypes() []ProfileType {
 		MutexProfile,
 		GoroutineProfile,
 		expGoroutineWaitProfile,
+		GoroutineLeakProfile,
 		MetricsProfile,
 		executionTrace,
+		EndpointAllocationProfile,
 	}
 	enabled := []ProfileType{}
 	for _, t := range order {
@@ -417,7 +580,7 @@ func (p *profiler) enqueueUpload(bat batch) {
 	}
 }
 
-// send takes profiles from the output queue and uploads them.
+// send takes profiles from the output queue and exports them.
 func (p *profiler) send() {
 	for {
 		select {
@@ -427,9 +590,10 @@ func (p *profiler) send() {
 			if err := p.outputDir(bat); err != nil {
 				log.Error("Failed to output profile to dir: %v", err)
 			}
-			if err := p.uploadFunc(bat); err != nil {
-				log.Error("Failed to upload profile: %v", err)
+			if recent := activeRecentBatches.Load(); recent != nil {
+				recent.add(bat)
 			}
+			p.export(bat)
 		}
 	}
 }
@@ -438,22 +602,17 @@ func (p *profiler) outputDir(bat batch) error {
 	if p.cfg.outputDir == "" {
 		return nil
 	}
-	// Basic ISO 8601 Format in UTC as the name for the directories.
-	dir := bat.end.UTC().Format("20060102T150405Z")
-	dirPath := filepath.Join(p.cfg.outputDir, dir)
-	// 0755 is what mkdir does, should be reasonable for the use cases here.
-	if err := os.MkdirAll(dirPath, 0755); err != nil {
-		return err
-	}
+	return writeBatchDir(p.cfg.outputDir, *p.exportedBatch(bat), false)
+}
 
-	for _, prof := range bat.profiles {
-		filePath := filepath.Join(dirPath, prof.name)
-		// 0644 is what touch does, should be reasonable for the use cases here.
-		if err := os.WriteFile(filePath, prof.data, 0644); err != nil {
-			return err
-		}
+// cycleSleep sleeps for the given duration or until interrupted by the
+// p.exit channel being closed or the current cycle being cut short.
+func (p *profiler) cycleSleep(d time.Duration) {
+	select {
+	case <-p.exit:
+	case <-p.cycle.cut:
+	case <-time.After(d):
 	}
-	return nil
 }
 
 // interruptibleSleep sleeps for the given duration or until interrupted by the
@@ -471,6 +630,9 @@ func (p *profiler) stop() {
 		close(p.exit)
 	})
 	p.wg.Wait()
+	if p.removeSpanStartObserver != nil {
+		p.removeSpanStartObserver()
+	}
 	if p.cfg.logStartup {
 		log.Info("Profiling stopped")
 	}
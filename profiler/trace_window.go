@@ -0,0 +1,124 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package profiler
+
+import (
+	"sync"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/traceprof"
+)
+
+// DefaultTraceWindowDuration specifies the default length of the execution
+// traces collected by trace windows, see WithExecutionTraceWindows.
+const DefaultTraceWindowDuration = 5 * time.Second
+
+// traceWindowReason is the capture reason of trace windows.
+const traceWindowReason = "trace_window"
+
+// maxTraceWindowSpans bounds the number of span IDs recorded by a trace
+// window.
+const maxTraceWindowSpans = 100
+
+// A TraceWindowTrigger describes the spans whose start arms a trace window,
+// see WithExecutionTraceWindows. Empty fields match any span, and a span must
+// match every non-empty field.
+type TraceWindowTrigger struct {
+	// Service is the service of the spans.
+	Service string
+
+	// Resource is the resource of the spans, as given to tracer.ResourceName
+	// when starting them.
+	Resource string
+
+	// Tag is the name of a tag the spans are started with, e.g. using
+	// tracer.Tag(Tag, true), to hint that they should be traced. Tags set to
+	// false or 0 don't match.
+	Tag string
+}
+
+func (t TraceWindowTrigger) matches(s traceprof.StartedSpan) bool {
+	if t.Service != "" && t.Service != s.Service {
+		return false
+	}
+	if t.Resource != "" && t.Resource != s.Resource {
+		return false
+	}
+	if t.Tag != "" {
+		if v, ok := s.Meta[t.Tag]; ok {
+			return v != "false"
+		}
+		v, ok := s.Metrics[t.Tag]
+		return ok && v != 0
+	}
+	return true
+}
+
+// traceWindows arms trace windows when spans matching its triggers start. A
+// trace window is a capture of an execution trace, which records the IDs of
+// the matching spans started until it is uploaded.
+type traceWindows struct {
+	p        *profiler
+	triggers []TraceWindowTrigger
+
+	mu      sync.Mutex
+	armed   bool      // whether a window was requested and not uploaded yet
+	last    time.Time // time of the last window request
+	spanIDs []uint64  // IDs of the matching spans of the armed window
+}
+
+// observe is the span start observer of the profiler, when trace windows are
+// enabled.
+func (w *traceWindows) observe(s traceprof.StartedSpan) {
+	matched := false
+	for _, t := range w.triggers {
+		if t.matches(s) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.armed {
+		if len(w.spanIDs) < maxTraceWindowSpans {
+			w.spanIDs = append(w.spanIDs, s.SpanID)
+		}
+		return
+	}
+	// Don't request windows which would be rate limited anyway, as
+	// matching spans may start often.
+	if !w.last.IsZero() && time.Since(w.last) < w.p.cfg.capture.rateLimit {
+		return
+	}
+	w.last = time.Now()
+	err := w.p.scheduleCapture(&captureRequest{
+		reason:   traceWindowReason,
+		types:    []ProfileType{executionTrace},
+		duration: w.p.cfg.traceWindow.duration,
+		window:   w,
+	})
+	if err != nil {
+		log.Debug("Trace window armed by span %d not taken: %v", s.SpanID, err)
+		return
+	}
+	w.armed = true
+	w.spanIDs = []uint64{s.SpanID}
+}
+
+// take returns the IDs of the spans recorded by the armed window, and disarms
+// it.
+func (w *traceWindows) take() []uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	ids := w.spanIDs
+	w.armed = false
+	w.spanIDs = nil
+	return ids
+}
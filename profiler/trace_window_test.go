@@ -0,0 +1,79 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package profiler
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/traceprof"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraceWindowTrigger(t *testing.T) {
+	span := traceprof.StartedSpan{
+		Service:  "web",
+		Resource: "GET /slow",
+		Meta:     map[string]string{"trace.me": "true", "off": "false"},
+		Metrics:  map[string]float64{"sampled": 1, "zero": 0},
+	}
+	for _, tt := range []struct {
+		trigger TraceWindowTrigger
+		want    bool
+	}{
+		{TraceWindowTrigger{}, true},
+		{TraceWindowTrigger{Service: "web"}, true},
+		{TraceWindowTrigger{Service: "db"}, false},
+		{TraceWindowTrigger{Service: "web", Resource: "GET /slow"}, true},
+		{TraceWindowTrigger{Service: "web", Resource: "GET /fast"}, false},
+		{TraceWindowTrigger{Tag: "trace.me"}, true},
+		{TraceWindowTrigger{Tag: "sampled"}, true},
+		{TraceWindowTrigger{Tag: "off"}, false},
+		{TraceWindowTrigger{Tag: "zero"}, false},
+		{TraceWindowTrigger{Tag: "missing"}, false},
+	} {
+		assert.Equal(t, tt.want, tt.trigger.matches(span), "%+v", tt.trigger)
+	}
+}
+
+func TestTraceWindows(t *testing.T) {
+	got := make(chan profileMeta)
+	server := httptest.NewServer(&mockBackend{t: t, profiles: got})
+	defer server.Close()
+
+	t.Setenv("DD_PROFILING_EXECUTION_TRACE_ENABLED", "false")
+	err := Start(
+		WithAgentAddr(server.Listener.Addr().String()),
+		WithProfileTypes(HeapProfile),
+		WithPeriod(time.Hour),
+		WithExecutionTraceWindows(10*time.Millisecond, TraceWindowTrigger{Resource: "GET /slow"}),
+	)
+	require.NoError(t, err)
+	defer Stop()
+	require.True(t, traceprof.ObservesSpanStart())
+
+	traceprof.ObserveSpanStart(traceprof.StartedSpan{Resource: "GET /fast", SpanID: 1})
+	traceprof.ObserveSpanStart(traceprof.StartedSpan{Resource: "GET /slow", SpanID: 2})
+	traceprof.ObserveSpanStart(traceprof.StartedSpan{Resource: "GET /slow", SpanID: 3})
+
+	regular := <-got
+	assert.Empty(t, regular.event.SpanIDs)
+	window := <-got
+	assert.Equal(t, []string{"go.trace"}, window.event.Attachments)
+	assert.Contains(t, window.tags, "capture_reason:trace_window")
+	assert.Contains(t, window.tags, "go_execution_traced:yes")
+	assert.Equal(t, []string{"2", "3"}, window.event.SpanIDs)
+
+	// rate limited
+	traceprof.ObserveSpanStart(traceprof.StartedSpan{Resource: "GET /slow", SpanID: 4})
+	assert.Equal(t, ErrCaptureRateLimited, CaptureNow("test"))
+
+	Stop()
+	assert.False(t, traceprof.ObservesSpanStart())
+}
@@ -7,7 +7,6 @@ package profiler
 
 import (
 	"bytes"
-	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -16,6 +15,7 @@ import (
 	"mime/multipart"
 	"net/http"
 	"net/textproto"
+	"strconv"
 	"strings"
 	"time"
 
@@ -71,35 +71,19 @@ func (e retriableError) Error() string { return e.err.Error() }
 // doRequest makes an HTTP POST request to the Datadog Profiling API with the
 // given profile.
 func (p *profiler) doRequest(bat batch) error {
-	tags := append(p.cfg.tags.Slice(),
-		fmt.Sprintf("service:%s", p.cfg.service),
-		// The profile_seq tag can be used to identify the first profile
-		// uploaded by a given runtime-id, identify missing profiles, etc.. See
-		// PROF-5612 (internal) for more details.
-		fmt.Sprintf("profile_seq:%d", bat.seq),
-	)
-	tags = append(tags, bat.extraTags...)
-	// If the user did not configure an "env" in the client, we should omit
-	// the tag so that the agent has a chance to supply a default tag.
-	// Otherwise, the tag supplied by the client will have priority.
-	if p.cfg.env != "" {
-		tags = append(tags, fmt.Sprintf("env:%s", p.cfg.env))
-	}
+	var size int
+	sw := startStopwatch()
+	defer func() { p.overhead.record(uploadCostKey, stageUpload, sw.stop(size)) }()
+	tags := p.batchTags(bat)
 	contentType, body, err := encode(bat, tags)
 	if err != nil {
 		return err
 	}
-	funcExit := make(chan struct{})
-	defer close(funcExit)
-	// uploadTimeout is guaranteed to be >= 0, see newProfiler.
-	ctx, cancel := context.WithTimeout(context.Background(), p.cfg.uploadTimeout)
-	go func() {
-		select {
-		case <-p.exit:
-		case <-funcExit:
-		}
-		cancel()
-	}()
+	if b, ok := body.(*bytes.Buffer); ok {
+		size = b.Len()
+	}
+	ctx, cancel := p.uploadContext()
+	defer cancel()
 	req, err := http.NewRequestWithContext(ctx, "POST", p.cfg.targetURL, body)
 	if err != nil {
 		return err
@@ -140,6 +124,31 @@ type uploadEvent struct {
 	Family         string            `json:"family"`
 	Version        string            `json:"version"`
 	EndpointCounts map[string]uint64 `json:"endpoint_counts,omitempty"`
+	SpanIDs        []string          `json:"span_ids,omitempty"`
+	Overhead       overheadCosts     `json:"profiler_overhead,omitempty"`
+}
+
+// batchTags returns the tags of the given batch, including the tags of the
+// profiler configuration.
+func (p *profiler) batchTags(bat batch) []string {
+	tags := append(p.cfg.tags.Slice(),
+		fmt.Sprintf("service:%s", p.cfg.service),
+		// The profile_seq tag can be used to identify the first profile
+		// uploaded by a given runtime-id, identify missing profiles, etc.. See
+		// PROF-5612 (internal) for more details.
+		fmt.Sprintf("profile_seq:%d", bat.seq),
+	)
+	tags = append(tags, bat.extraTags...)
+	// If the user did not configure an "env" in the client, we should omit
+	// the tag so that the agent has a chance to supply a default tag.
+	// Otherwise, the tag supplied by the client will have priority.
+	if p.cfg.env != "" {
+		tags = append(tags, fmt.Sprintf("env:%s", p.cfg.env))
+	}
+	if bat.host != "" {
+		tags = append(tags, fmt.Sprintf("host:%s", bat.host))
+	}
+	return append(tags, "runtime:go")
 }
 
 // encode encodes the profile as a multipart mime request.
@@ -148,11 +157,6 @@ func encode(bat batch, tags []string) (contentType string, body io.Reader, err e
 
 	mw := multipart.NewWriter(&buf)
 
-	if bat.host != "" {
-		tags = append(tags, fmt.Sprintf("host:%s", bat.host))
-	}
-	tags = append(tags, "runtime:go")
-
 	event := &uploadEvent{
 		Version:        "4",
 		Family:         "go",
@@ -160,6 +164,8 @@ func encode(bat batch, tags []string) (contentType string, body io.Reader, err e
 		End:            bat.end.Format(time.RFC3339Nano),
 		Tags:           strings.Join(tags, ","),
 		EndpointCounts: bat.endpointCounts,
+		SpanIDs:        formatSpanIDs(bat.spanIDs),
+		Overhead:       bat.overhead,
 	}
 
 	for _, p := range bat.profiles {
@@ -189,3 +195,13 @@ func encode(bat batch, tags []string) (contentType string, body io.Reader, err e
 	}
 	return mw.FormDataContentType(), &buf, nil
 }
+
+// formatSpanIDs formats span IDs as decimal strings, as their precision
+// would be lost by JSON parsers using float64 numbers.
+func formatSpanIDs(ids []uint64) []string {
+	var s []string
+	for _, id := range ids {
+		s = append(s, strconv.FormatUint(id, 10))
+	}
+	return s
+}